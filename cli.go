@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
+
+const usage = `usage: %[1]s [command]
+
+Commands:
+  serve                              start the HTTP API (default)
+  migrate up|down|status             manage the database schema
+  migrate baseline VERSION           adopt a database created before migrations
+                                     were tracked, then apply the rest
+  user create -username NAME -email EMAIL [-role user|admin]
+                                     create a user, the password is read from stdin
+  user set-password -username NAME  replace a password and end the user's sessions
+  tape import -file tapes.csv        add tapes from a CSV file ("-" for stdin) with
+                                     the header title,director,genre,quantity
+  rental list [-overdue]             list active rentals, or only the overdue ones
+`
+
+// Entry point of the binary, args exclude the program name
+func run(args []string) error {
+	if len(args) == 0 {
+		return serve()
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return serve()
+	case "migrate":
+		return runMigrate(args)
+	case "user":
+		return runUser(args)
+	case "tape":
+		return runTape(args)
+	case "rental":
+		return runRental(args)
+	case "help", "-h", "--help":
+		fmt.Printf(usage, os.Args[0])
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, run %s help", command, os.Args[0])
+	}
+}
+
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: user create|set-password")
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("user create", flag.ContinueOnError)
+		username := flags.String("username", "", "login name, 4 to 20 letters or digits")
+		email := flags.String("email", "", "email address")
+		role := flags.String("role", model.RoleUser, "user or admin")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *username == "" || *email == "" {
+			return errors.New("user create needs -username and -email")
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+
+		app, err := newApp()
+		if err != nil {
+			return err
+		}
+		defer app.Close()
+		user, err := app.userService.CreateUser(context.Background(), &model.User{
+			Username: *username,
+			Email:    *email,
+			Role:     *role,
+			Password: password,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s %s (%s)\n", user.Role, user.Username, user.PublicID)
+		return nil
+	case "set-password":
+		flags := flag.NewFlagSet("user set-password", flag.ContinueOnError)
+		username := flags.String("username", "", "login name of the user")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *username == "" {
+			return errors.New("user set-password needs -username")
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+
+		app, err := newApp()
+		if err != nil {
+			return err
+		}
+		defer app.Close()
+		if err := app.userService.SetPassword(context.Background(), *username, password); err != nil {
+			return err
+		}
+		fmt.Printf("password of %s updated, existing sessions were logged out\n", *username)
+		return nil
+	default:
+		return fmt.Errorf("unknown user command %q, expected create or set-password", args[0])
+	}
+}
+
+func runTape(args []string) error {
+	if len(args) == 0 || args[0] != "import" {
+		return errors.New("usage: tape import -file tapes.csv")
+	}
+
+	flags := flag.NewFlagSet("tape import", flag.ContinueOnError)
+	file := flags.String("file", "", `CSV file to import, "-" reads stdin`)
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("tape import needs -file")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	tapes, err := readTapesCSV(r)
+	if err != nil {
+		return err
+	}
+
+	app, err := newApp()
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+	created, existing, err := app.tapeService.CreateTapeBatch(context.Background(), tapes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d tapes, %d were already in the catalog\n", len(created), *existing)
+	return nil
+}
+
+func runRental(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("usage: rental list [-overdue]")
+	}
+
+	flags := flag.NewFlagSet("rental list", flag.ContinueOnError)
+	overdue := flags.Bool("overdue", false, "only rentals past their due date")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	app, err := newApp()
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+	ctx := context.Background()
+
+	var rentals []*model.Rental
+	if *overdue {
+		rentals, err = app.rentalService.GetOverdueRentals(ctx)
+	} else {
+		rentals, err = app.rentalService.GetAllActiveRentals(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RENTAL\tUSER\tTAPE\tCOPY\tRENTED AT\tDUE AT")
+	for _, rental := range rentals {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			rental.PublicID,
+			rental.Username,
+			rental.TapeTitle,
+			rental.CopyBarcode.String,
+			rental.RentedAt.Format("2006-01-02"),
+			rental.DueAt.Format("2006-01-02"),
+		)
+	}
+	return w.Flush()
+}
+
+// Reads one line from stdin so passwords stay out of the shell history.
+// Input is echoed when typed on a terminal, pipe it in to avoid that.
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	// Same bounds as the CreateUserRequest binding
+	if len(password) < 8 || len(password) > 20 {
+		return "", errors.New("password must be 8 to 20 characters long")
+	}
+	return password, nil
+}
+
+// Expects the header title,director,genre,quantity in any order, quantity defaults to 1
+func readTapesCSV(r io.Reader) ([]*model.Tape, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"title", "director", "genre"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+
+	var tapes []*model.Tape
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tape := &model.Tape{
+			Title:    strings.TrimSpace(record[columns["title"]]),
+			Director: strings.TrimSpace(record[columns["director"]]),
+			Genre:    strings.TrimSpace(record[columns["genre"]]),
+			Quantity: 1,
+		}
+		if tape.Title == "" || tape.Director == "" || tape.Genre == "" {
+			return nil, fmt.Errorf("line %d: title, director and genre are required", line)
+		}
+		if i, ok := columns["quantity"]; ok && strings.TrimSpace(record[i]) != "" {
+			quantity, err := strconv.ParseInt(strings.TrimSpace(record[i]), 10, 32)
+			if err != nil || quantity < 1 {
+				return nil, fmt.Errorf("line %d: quantity must be a positive number", line)
+			}
+			tape.Quantity = int32(quantity)
+		}
+		tapes = append(tapes, tape)
+	}
+
+	if len(tapes) == 0 {
+		return nil, errors.New("CSV file has no tapes")
+	}
+	return tapes, nil
+}
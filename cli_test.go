@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadTapesCSV(t *testing.T) {
+	stalker := &model.Tape{Title: "Stalker", Director: "Andrei Tarkovsky", Genre: "Sci-Fi", Quantity: 1}
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []*model.Tape
+		wantErr string
+	}{
+		{
+			"all columns",
+			"title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,3\n",
+			[]*model.Tape{{Title: "Stalker", Director: "Andrei Tarkovsky", Genre: "Sci-Fi", Quantity: 3}},
+			"",
+		},
+		{
+			"columns in any order and case",
+			" Genre , QUANTITY,Title,director\nSci-Fi,1,Stalker,Andrei Tarkovsky\n",
+			[]*model.Tape{stalker},
+			"",
+		},
+		{
+			"quantity column is optional",
+			"title,director,genre\nStalker,Andrei Tarkovsky,Sci-Fi\n",
+			[]*model.Tape{stalker},
+			"",
+		},
+		{
+			"empty quantity defaults to one",
+			"title,director,genre,quantity\nStalker, Andrei Tarkovsky ,Sci-Fi,\n",
+			[]*model.Tape{stalker},
+			"",
+		},
+		{"quantity not a number", "title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,three\n", nil, "line 2: quantity must be a positive number"},
+		{"quantity zero", "title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,0\n", nil, "line 2: quantity must be a positive number"},
+		{"quantity negative", "title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,-2\n", nil, "line 2: quantity must be a positive number"},
+		{"quantity overflows", "title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,4294967297\n", nil, "line 2: quantity must be a positive number"},
+		{"header without genre", "title,director,quantity\nStalker,Andrei Tarkovsky,1\n", nil, `CSV header is missing the "genre" column`},
+		{"row with a missing column", "title,director,genre\nStalker,Andrei Tarkovsky\n", nil, "wrong number of fields"},
+		{"empty required field", "title,director,genre\nStalker,,Sci-Fi\n", nil, "line 2: title, director and genre are required"},
+		{"error names the line", "title,director,genre,quantity\nStalker,Andrei Tarkovsky,Sci-Fi,1\nSolaris,Andrei Tarkovsky,Sci-Fi,x\n", nil, "line 3:"},
+		{"header only", "title,director,genre,quantity\n", nil, "CSV file has no tapes"},
+		{"empty file", "", nil, "reading CSV header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tapes, err := readTapesCSV(strings.NewReader(tt.csv))
+
+			if tt.wantErr != "" {
+				assert.Nil(t, tapes)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, tapes)
+		})
+	}
+}
+
+// Usage mistakes are reported before the database is opened
+func Test_Run_UsageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"unknown command", []string{"rewind"}, `unknown command "rewind"`},
+		{"user without subcommand", []string{"user"}, "usage: user create|set-password"},
+		{"unknown user subcommand", []string{"user", "promote"}, `unknown user command "promote"`},
+		{"user create without email", []string{"user", "create", "-username", "bob"}, "user create needs -username and -email"},
+		{"set-password without username", []string{"user", "set-password"}, "user set-password needs -username"},
+		{"tape without import", []string{"tape", "export"}, "usage: tape import -file tapes.csv"},
+		{"tape import without file", []string{"tape", "import"}, "tape import needs -file"},
+		{"tape import of a missing file", []string{"tape", "import", "-file", "does-not-exist.csv"}, "does-not-exist.csv"},
+		{"migrate without command", []string{"migrate"}, "usage: "},
+		{"migrate baseline without version", []string{"migrate", "baseline"}, "baseline VERSION"},
+		{"migrate baseline with a bad version", []string{"migrate", "baseline", "three"}, `"three" is not a valid version`},
+		{"rental without list", []string{"rental"}, "usage: rental list [-overdue]"},
+		{"unknown flag", []string{"rental", "list", "-late"}, "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(tt.args)
+
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,56 +2,388 @@ package config
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	// driver import for sqlc, only imported for its side effects (DB communication)
 	_ "github.com/lib/pq"
-	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	DB *database.Queries
-	// Needed in case we want to use transactions in our code
-	SQLDB     *sql.DB
-	JWTSecret string
+	DatabaseURL string
+	// Connection pool of the *sql.DB returned by OpenDB
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Rental rules
+	RentalPeriod       time.Duration
+	LateFeePerDayCents int32
+	MaxRenewals        int32
+	MaxRentalsPerUser  int32
+
+	// Apply pending sql/schema migrations before serving
+	AutoMigrate bool
+
+	// HTTP server
+	ServerAddr      string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxHeaderBytes  int
+	ShutdownTimeout time.Duration
+	// Time /readyz waits for the database before reporting it unavailable
+	ReadinessTimeout time.Duration
+	// Minimum level of the JSON request and server logs
+	LogLevel slog.Level
+	// Where spans go: none, stdout or otlp (endpoint set through OTEL_EXPORTER_OTLP_ENDPOINT)
+	TracingExporter    string
+	TracingServiceName string
+	TracingSampleRatio float64
+	// Browser origins allowed to call the API, CORS is off when empty
+	CORSOrigins []string
+	// Proxies whose X-Forwarded-For is believed when telling clients apart, none by default
+	TrustedProxies []string
+
+	// Login attempts allowed per LoginRatePeriod, per client IP and per username
+	LoginIPLimit       int
+	LoginUsernameLimit int
+	LoginRatePeriod    time.Duration
+	// Wrong passwords in a row before an account is locked, the lock doubles with each further one
+	LoginLockoutThreshold int
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+
+	// Requests per RateLimitPeriod to each route group, per caller kind
+	RateLimitAnonymous int
+	RateLimitUser      int
+	RateLimitAdmin     int
+	RateLimitPeriod    time.Duration
+	// Limits of single groups and roles, e.g. "tapes:anonymous" => 30
+	RateLimitOverrides map[string]int
+
+	// Page of the web app password reset links open, and how long they work
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+	// How emails go out: log, file (appended to MailFile) or smtp
+	MailDriver   string
+	MailFrom     string
+	MailFile     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
 }
 
-var AppConfig *Config
+// ValidationError lists every invalid or missing setting, so they can all be fixed in one go
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
 
-func Load() {
+// Load reads the settings from the environment (and a .env file), falling back to the YAML or TOML
+// file named by CONFIG_FILE and then to the defaults. The file uses the env var names in lower case,
+// e.g. `db_url` or `max_rentals_per_user`.
+func Load() (*Config, error) {
 	_ = godotenv.Load()
 
-	sqldb, queries, secret := getEnv("DB_URL", "JWT_SECRET")
-	AppConfig = &Config{
-		DB:        queries,
-		SQLDB:     sqldb,
-		JWTSecret: secret,
+	file, err := readFile(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{file: file}
+
+	cfg := &Config{
+		DatabaseURL:       l.required("DB_URL"),
+		DBMaxOpenConns:    l.int("DB_MAX_OPEN_CONNS", 25, 1),
+		DBMaxIdleConns:    l.int("DB_MAX_IDLE_CONNS", 25, 0),
+		DBConnMaxLifetime: l.duration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+
+		JWTSecret:       l.required("JWT_SECRET"),
+		AccessTokenTTL:  l.duration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: l.duration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+
+		RentalPeriod:       time.Duration(l.int("RENTAL_PERIOD_DAYS", 7, 1)) * 24 * time.Hour,
+		LateFeePerDayCents: int32(l.int("LATE_FEE_PER_DAY_CENTS", 100, 0)),
+		MaxRenewals:        int32(l.int("MAX_RENTAL_RENEWALS", 2, 0)),
+		MaxRentalsPerUser:  int32(l.int("MAX_RENTALS_PER_USER", 2, 1)),
+
+		AutoMigrate: l.bool("AUTO_MIGRATE", false),
+
+		ServerAddr:         l.string("SERVER_ADDR", ":8080"),
+		ReadTimeout:        l.duration("SERVER_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:       l.duration("SERVER_WRITE_TIMEOUT", 15*time.Second),
+		IdleTimeout:        l.duration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		MaxHeaderBytes:     l.int("SERVER_MAX_HEADER_BYTES", 1<<20, 1),
+		ShutdownTimeout:    l.duration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		ReadinessTimeout:   l.duration("READINESS_TIMEOUT", 2*time.Second),
+		LogLevel:           l.logLevel("LOG_LEVEL", slog.LevelInfo),
+		TracingExporter:    l.oneOf("TRACING_EXPORTER", "none", "none", "stdout", "otlp"),
+		TracingServiceName: l.string("OTEL_SERVICE_NAME", "vhs-club"),
+		TracingSampleRatio: l.ratio("TRACING_SAMPLE_RATIO", 1),
+		CORSOrigins:        l.list("CORS_ORIGINS"),
+		TrustedProxies:     l.list("TRUSTED_PROXIES"),
+
+		LoginIPLimit:          l.int("LOGIN_IP_LIMIT", 20, 1),
+		LoginUsernameLimit:    l.int("LOGIN_USERNAME_LIMIT", 5, 1),
+		LoginRatePeriod:       l.duration("LOGIN_RATE_PERIOD", time.Minute),
+		LoginLockoutThreshold: l.int("LOGIN_LOCKOUT_THRESHOLD", 5, 1),
+		LoginLockoutBase:      l.duration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:       l.duration("LOGIN_LOCKOUT_MAX", time.Hour),
+
+		RateLimitAnonymous: l.int("RATE_LIMIT_ANONYMOUS", 60, 1),
+		RateLimitUser:      l.int("RATE_LIMIT_USER", 120, 1),
+		RateLimitAdmin:     l.int("RATE_LIMIT_ADMIN", 600, 1),
+		RateLimitPeriod:    l.duration("RATE_LIMIT_PERIOD", time.Minute),
+		RateLimitOverrides: l.limits("RATE_LIMIT_OVERRIDES"),
+
+		PasswordResetURL: l.string("PASSWORD_RESET_URL", "http://localhost:5173/reset-password"),
+		PasswordResetTTL: l.duration("PASSWORD_RESET_TTL", 30*time.Minute),
+		MailDriver:       l.oneOf("MAIL_DRIVER", "log", "log", "file", "smtp"),
+		MailFrom:         l.string("MAIL_FROM", "VHS Club <no-reply@vhsclub.local>"),
+		MailFile:         l.string("MAIL_FILE", "mail.log"),
+		SMTPHost:         l.string("SMTP_HOST", ""),
+		SMTPPort:         l.int("SMTP_PORT", 587, 1),
+		SMTPUsername:     l.string("SMTP_USERNAME", ""),
+		SMTPPassword:     l.string("SMTP_PASSWORD", ""),
+	}
+
+	// Checks across settings
+	if cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		l.problem("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns)
+	}
+	if cfg.RefreshTokenTTL <= cfg.AccessTokenTTL {
+		l.problem("REFRESH_TOKEN_TTL (%s) must be longer than ACCESS_TOKEN_TTL (%s)", cfg.RefreshTokenTTL, cfg.AccessTokenTTL)
+	}
+	if cfg.LoginLockoutBase > cfg.LoginLockoutMax {
+		l.problem("LOGIN_LOCKOUT_BASE (%s) must not exceed LOGIN_LOCKOUT_MAX (%s)", cfg.LoginLockoutBase, cfg.LoginLockoutMax)
+	}
+
+	if resetURL, err := url.Parse(cfg.PasswordResetURL); err != nil || resetURL.Scheme == "" || resetURL.Host == "" {
+		l.problem("PASSWORD_RESET_URL must be an absolute URL like https://vhsclub.example/reset-password, got %q", cfg.PasswordResetURL)
+	}
+	if cfg.MailDriver == "smtp" && cfg.SMTPHost == "" {
+		l.problem("SMTP_HOST must be set when MAIL_DRIVER is smtp")
+	}
+
+	if len(l.problems) > 0 {
+		return nil, &ValidationError{Problems: l.problems}
+	}
+	return cfg, nil
+}
+
+// Opens the pool and checks the database is reachable
+func OpenDB(cfg *Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to the db: %w", err)
+	}
+	return db, nil
+}
+
+// Helpers
+
+// Flattens the YAML or TOML file into lower case keys, lists are joined with commas like their
+// env var form. The format is picked by the file extension.
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var unmarshal func([]byte, any) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".toml":
+		unmarshal = toml.Unmarshal
+	default:
+		return nil, fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	file := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if values, ok := value.([]any); ok {
+			items := make([]string, 0, len(values))
+			for _, item := range values {
+				items = append(items, fmt.Sprint(item))
+			}
+			file[strings.ToLower(key)] = strings.Join(items, ",")
+			continue
+		}
+		file[strings.ToLower(key)] = fmt.Sprint(value)
+	}
+	return file, nil
+}
+
+// Looks settings up and collects problems instead of stopping at the first one
+type loader struct {
+	file     map[string]string
+	problems []string
+}
+
+func (l *loader) lookup(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return l.file[strings.ToLower(key)]
+}
+
+func (l *loader) problem(format string, args ...any) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+func (l *loader) required(key string) string {
+	value := l.lookup(key)
+	if value == "" {
+		l.problem("%s must be set", key)
 	}
+	return value
 }
 
-func getEnv(dbString, jwtSecret string) (*sql.DB, *database.Queries, string) {
-	dbURL := os.Getenv(dbString)
-	if dbURL == "" {
-		log.Fatal("DB_URL must be set")
+func (l *loader) string(key, def string) string {
+	if value := l.lookup(key); value != "" {
+		return value
 	}
+	return def
+}
 
-	secret := os.Getenv(jwtSecret)
-	if secret == "" {
-		log.Fatal("JWT_SECRET must be set")
+func (l *loader) int(key string, def, min int) int {
+	value := l.lookup(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min {
+		l.problem("%s must be an integer of at least %d, got %q", key, min, value)
+		return def
 	}
+	return n
+}
 
-	dbConn, err := sql.Open("postgres", dbURL)
+func (l *loader) bool(key string, def bool) bool {
+	value := l.lookup(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
 	if err != nil {
-		log.Fatalf("error opening database: %v", err)
+		l.problem("%s must be true or false, got %q", key, value)
+		return def
+	}
+	return b
+}
+
+// Values use time.ParseDuration syntax like "15s"
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	value := l.lookup(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		l.problem("%s must be a positive duration like 15s, got %q", key, value)
+		return def
+	}
+	return d
+}
+
+func (l *loader) oneOf(key, def string, allowed ...string) string {
+	value := l.lookup(key)
+	if value == "" {
+		return def
+	}
+	if !slices.Contains(allowed, value) {
+		l.problem("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+		return def
 	}
+	return value
+}
+
+// A number between 0 and 1
+func (l *loader) ratio(key string, def float64) float64 {
+	value := l.lookup(key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || f > 1 {
+		l.problem("%s must be a number between 0 and 1, got %q", key, value)
+		return def
+	}
+	return f
+}
 
-	if err := dbConn.Ping(); err != nil {
-		log.Fatalf("error connecting to the db: %v", err)
+// One of debug, info, warn or error
+func (l *loader) logLevel(key string, def slog.Level) slog.Level {
+	value := l.lookup(key)
+	if value == "" {
+		return def
 	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		l.problem("%s must be debug, info, warn or error, got %q", key, value)
+		return def
+	}
+	return level
+}
 
-	dbQueries := database.New(dbConn)
+// Comma separated, empty items are dropped
+func (l *loader) list(key string) []string {
+	var items []string
+	for _, item := range strings.Split(l.lookup(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	return dbConn, dbQueries, secret
+// Comma separated name=limit pairs such as "tapes:anonymous=30,rentals:user=20"
+func (l *loader) limits(key string) map[string]int {
+	limits := make(map[string]int)
+	for _, item := range l.list(key) {
+		name, value, _ := strings.Cut(item, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if name = strings.TrimSpace(name); name == "" || err != nil || n < 1 {
+			l.problem("%s entries must look like group:role=limit with a limit of at least 1, got %q", key, item)
+			continue
+		}
+		limits[name] = n
+	}
+	return limits
 }
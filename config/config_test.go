@@ -0,0 +1,137 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Clears every variable Load reads so values from the developer's shell don't leak in
+func unsetEnv(t *testing.T) {
+	for _, key := range []string{
+		"CONFIG_FILE", "DB_URL", "JWT_SECRET", "ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL",
+		"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME",
+		"RENTAL_PERIOD_DAYS", "LATE_FEE_PER_DAY_CENTS", "MAX_RENTAL_RENEWALS", "MAX_RENTALS_PER_USER",
+		"AUTO_MIGRATE", "SERVER_ADDR", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT",
+		"SERVER_IDLE_TIMEOUT", "SERVER_MAX_HEADER_BYTES", "SHUTDOWN_TIMEOUT", "READINESS_TIMEOUT", "LOG_LEVEL",
+		"TRACING_EXPORTER", "OTEL_SERVICE_NAME", "TRACING_SAMPLE_RATIO", "CORS_ORIGINS",
+		"TRUSTED_PROXIES", "LOGIN_IP_LIMIT", "LOGIN_USERNAME_LIMIT", "LOGIN_RATE_PERIOD",
+		"LOGIN_LOCKOUT_THRESHOLD", "LOGIN_LOCKOUT_BASE", "LOGIN_LOCKOUT_MAX",
+		"RATE_LIMIT_ANONYMOUS", "RATE_LIMIT_USER", "RATE_LIMIT_ADMIN", "RATE_LIMIT_PERIOD", "RATE_LIMIT_OVERRIDES",
+		"PASSWORD_RESET_URL", "PASSWORD_RESET_TTL", "MAIL_DRIVER", "MAIL_FROM", "MAIL_FILE",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func Test_Load_Defaults(t *testing.T) {
+	unsetEnv(t)
+	t.Setenv("DB_URL", "postgres://localhost/vhs_club")
+	t.Setenv("JWT_SECRET", "secret")
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 15*time.Minute, cfg.AccessTokenTTL)
+	assert.Equal(t, 7*24*time.Hour, cfg.RefreshTokenTTL)
+	assert.Equal(t, int32(2), cfg.MaxRentalsPerUser)
+	assert.Equal(t, 25, cfg.DBMaxOpenConns)
+	assert.Equal(t, ":8080", cfg.ServerAddr)
+	assert.Empty(t, cfg.CORSOrigins)
+	assert.Equal(t, 5, cfg.LoginUsernameLimit)
+	assert.Equal(t, time.Hour, cfg.LoginLockoutMax)
+	assert.Equal(t, "log", cfg.MailDriver)
+	assert.Equal(t, 30*time.Minute, cfg.PasswordResetTTL)
+}
+
+func Test_Load_SMTPNeedsHost(t *testing.T) {
+	unsetEnv(t)
+	t.Setenv("DB_URL", "postgres://localhost/vhs_club")
+	t.Setenv("JWT_SECRET", "secret")
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("PASSWORD_RESET_URL", "/reset-password")
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "SMTP_HOST must be set when MAIL_DRIVER is smtp")
+	assert.Contains(t, err.Error(), `PASSWORD_RESET_URL must be an absolute URL`)
+}
+
+func Test_Load_ReportsEveryProblem(t *testing.T) {
+	unsetEnv(t)
+	t.Setenv("MAX_RENTALS_PER_USER", "zero")
+	t.Setenv("ACCESS_TOKEN_TTL", "1h")
+	t.Setenv("REFRESH_TOKEN_TTL", "30m")
+	t.Setenv("DB_MAX_OPEN_CONNS", "5")
+	t.Setenv("DB_MAX_IDLE_CONNS", "10")
+	t.Setenv("TRACING_EXPORTER", "jaeger")
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, cfg)
+	var validationErr *config.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Problems, 6)
+	assert.Contains(t, err.Error(), "DB_URL must be set")
+	assert.Contains(t, err.Error(), "JWT_SECRET must be set")
+	assert.Contains(t, err.Error(), "MAX_RENTALS_PER_USER")
+	assert.Contains(t, err.Error(), `TRACING_EXPORTER must be one of none, stdout, otlp, got "jaeger"`)
+	assert.Contains(t, err.Error(), "DB_MAX_IDLE_CONNS (10) must not exceed DB_MAX_OPEN_CONNS (5)")
+	assert.Contains(t, err.Error(), "REFRESH_TOKEN_TTL (30m0s) must be longer than ACCESS_TOKEN_TTL (1h0m0s)")
+}
+
+func Test_Load_FileWithEnvOverride(t *testing.T) {
+	unsetEnv(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "db_url: postgres://file/vhs_club\njwt_secret: from-file\nmax_rentals_per_user: 4\ncors_origins:\n  - http://localhost:5173\n  - http://localhost:5174\nrate_limit_overrides:\n  - tapes:anonymous=30\n  - rentals:user=20\n"
+	assert.Nil(t, os.WriteFile(path, []byte(file), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("JWT_SECRET", "from-env")
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "postgres://file/vhs_club", cfg.DatabaseURL)
+	assert.Equal(t, "from-env", cfg.JWTSecret)
+	assert.Equal(t, int32(4), cfg.MaxRentalsPerUser)
+	assert.Equal(t, []string{"http://localhost:5173", "http://localhost:5174"}, cfg.CORSOrigins)
+	assert.Equal(t, map[string]int{"tapes:anonymous": 30, "rentals:user": 20}, cfg.RateLimitOverrides)
+}
+
+func Test_Load_TOMLFile(t *testing.T) {
+	unsetEnv(t)
+	path := filepath.Join(t.TempDir(), "config.toml")
+	file := "db_url = \"postgres://file/vhs_club\"\njwt_secret = \"from-file\"\naccess_token_ttl = \"30m\"\nmax_rentals_per_user = 4\ntracing_sample_ratio = 0.5\nauto_migrate = true\ncors_origins = [\"http://localhost:5173\", \"http://localhost:5174\"]\n"
+	assert.Nil(t, os.WriteFile(path, []byte(file), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "postgres://file/vhs_club", cfg.DatabaseURL)
+	assert.Equal(t, "from-file", cfg.JWTSecret)
+	assert.Equal(t, 30*time.Minute, cfg.AccessTokenTTL)
+	assert.Equal(t, int32(4), cfg.MaxRentalsPerUser)
+	assert.Equal(t, 0.5, cfg.TracingSampleRatio)
+	assert.True(t, cfg.AutoMigrate)
+	assert.Equal(t, []string{"http://localhost:5173", "http://localhost:5174"}, cfg.CORSOrigins)
+}
+
+func Test_Load_UnknownFileExtension(t *testing.T) {
+	unsetEnv(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"db_url": "postgres://file/vhs_club"}`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+
+	assert.Nil(t, cfg)
+	assert.ErrorContains(t, err, "must end in .yaml, .yml or .toml")
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+	"github.com/rigofekete/vhs-club-mvc/internal/migrate"
+)
+
+// Probes for the orchestrator, they talk to the pool directly since there is no business logic involved
+type HealthHandler struct {
+	db       *sql.DB
+	migrator *migrate.Migrator
+	timeout  time.Duration
+}
+
+func NewHealthHandler(db *sql.DB, migrator *migrate.Migrator, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{
+		db:       db,
+		migrator: migrator,
+		timeout:  timeout,
+	}
+}
+
+func (h *HealthHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/healthz", h.Liveness)
+	r.GET("/readyz", h.Readiness)
+}
+
+// The process is up and serving requests, dependencies are not checked
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+	})
+}
+
+// Ready once the database answers within the timeout and has every migration this binary knows of
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	response := ReadinessResponse{
+		Status:   "ready",
+		Database: "ok",
+		Migration: MigrationStatus{
+			Latest: h.migrator.LatestVersion(),
+		},
+	}
+
+	if err := h.db.PingContext(ctx); err != nil {
+		logging.FromContext(ctx).Error("readiness: database ping failed", "error", err)
+		response.Status = "unavailable"
+		response.Database = "unreachable"
+	} else {
+		current, err := h.migrator.CurrentVersion(ctx)
+		if err != nil {
+			logging.FromContext(ctx).Error("readiness: reading the schema version failed", "error", err)
+			response.Status = "unavailable"
+			response.Database = "schema version unknown"
+		}
+		response.Migration.Current = current
+		if current < response.Migration.Latest {
+			response.Status = "unavailable"
+		}
+	}
+
+	// Read after the checks so the pool reflects the connection they used
+	stats := h.db.Stats()
+	response.Pool = ConnectionPoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+	}
+
+	status := http.StatusOK
+	if response.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,24 @@
+package handler
+
+type ReadinessResponse struct {
+	Status    string              `json:"status"`
+	Database  string              `json:"database"`
+	Migration MigrationStatus     `json:"migration"`
+	Pool      ConnectionPoolStats `json:"pool"`
+}
+
+type MigrationStatus struct {
+	// Highest version applied to the database
+	Current int64 `json:"current"`
+	// Highest version shipped with this binary
+	Latest int64 `json:"latest"`
+}
+
+type ConnectionPoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+}
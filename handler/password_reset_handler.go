@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/rigofekete/vhs-club-mvc/service"
+)
+
+type PasswordResetHandler struct {
+	resetService service.PasswordResetService
+	// Per client IP limit, each accepted request can send an email
+	resetLimit gin.HandlerFunc
+}
+
+func NewPasswordResetHandler(s service.PasswordResetService, resetLimit gin.HandlerFunc) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		resetService: s,
+		resetLimit:   resetLimit,
+	}
+}
+
+func (h *PasswordResetHandler) RegisterRoutes(r *gin.Engine, limiter *middleware.RateLimiter) {
+	reset := r.Group("/api/users/password-reset", limiter.Group("users"), h.resetLimit)
+	reset.POST("", h.RequestReset)
+	reset.POST("/confirm", h.ConfirmReset)
+}
+
+// Always answers 202 for a valid email, whether or not an account uses it
+func (h *PasswordResetHandler) RequestReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	if err := h.resetService.RequestReset(c.Request.Context(), req.Email); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (h *PasswordResetHandler) ConfirmReset(c *gin.Context) {
+	var req ConfirmPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	if err := h.resetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
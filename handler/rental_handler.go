@@ -17,22 +17,34 @@ func NewRentalHandler(s service.RentalService) *RentalHandler {
 	return &RentalHandler{rentalService: s}
 }
 
-func (h *RentalHandler) RegisterRoutes(r *gin.Engine) {
-	app := r.Group("/api/rentals")
+func (h *RentalHandler) RegisterRoutes(r *gin.Engine, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limit := limiter.Group("rentals")
+
+	app := r.Group("/api/rentals", authn.OptionalAuth(), limit)
 	app.GET("/", h.GetAllActiveRentals)
 
 	user := r.Group("/api/rentals")
-	user.Use(middleware.UserAuth())
+	user.Use(authn.OptionalAuth(), limit, authn.UserAuth())
 	{
+		user.GET("/me", h.GetMyRentals)
 		user.POST("/:id", h.CreateRental)
 		user.PATCH("/:id", h.ReturnRental)
+		user.POST("/:id/renew", h.RenewRental)
 	}
 
 	admin := r.Group("/api/rentals")
-	admin.Use(middleware.AdminAuth())
+	admin.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
 	{
+		admin.GET("/overdue", h.GetOverdueRentals)
+		admin.POST("/:id/fee", h.PayLateFee)
 		admin.DELETE("/", h.DeleteAllRentals)
 	}
+
+	adminUsers := r.Group("/api/users")
+	adminUsers.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
+	{
+		adminUsers.GET("/:id/rentals", h.GetUserRentals)
+	}
 }
 
 func (h *RentalHandler) CreateRental(c *gin.Context) {
@@ -68,6 +80,23 @@ func (h *RentalHandler) ReturnRental(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func (h *RentalHandler) RenewRental(c *gin.Context) {
+	rentalID := c.Param("id")
+	publicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	renewedRental, err := h.rentalService.RenewRental(c.Request.Context(), publicID.String(), rentalID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RentalSingleResponse(renewedRental))
+}
+
 func (h *RentalHandler) GetAllActiveRentals(c *gin.Context) {
 	rentals, err := h.rentalService.GetAllActiveRentals(c.Request.Context())
 	if err != nil {
@@ -77,6 +106,37 @@ func (h *RentalHandler) GetAllActiveRentals(c *gin.Context) {
 	c.JSON(http.StatusOK, RentalListResponse(rentals))
 }
 
+func (h *RentalHandler) GetOverdueRentals(c *gin.Context) {
+	rentals, err := h.rentalService.GetOverdueRentals(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, RentalListResponse(rentals))
+}
+
+func (h *RentalHandler) PayLateFee(c *gin.Context) {
+	rentalID := c.Param("id")
+	if err := h.rentalService.PayLateFee(c.Request.Context(), rentalID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *RentalHandler) GetMyRentals(c *gin.Context) {
+	publicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+	h.getRentalHistory(c, publicID.String())
+}
+
+func (h *RentalHandler) GetUserRentals(c *gin.Context) {
+	h.getRentalHistory(c, c.Param("id"))
+}
+
 func (h *RentalHandler) DeleteAllRentals(c *gin.Context) {
 	if err := h.rentalService.DeleteAllRentals(c.Request.Context()); err != nil {
 		_ = c.Error(err)
@@ -84,3 +144,19 @@ func (h *RentalHandler) DeleteAllRentals(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// Helper for GetMyRentals and GetUserRentals
+func (h *RentalHandler) getRentalHistory(c *gin.Context, userID string) {
+	var query RentalHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	rentals, err := h.rentalService.GetRentalHistory(c.Request.Context(), userID, query.ToModel())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, RentalListResponse(rentals))
+}
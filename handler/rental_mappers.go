@@ -1,17 +1,35 @@
 package handler
 
-import "github.com/rigofekete/vhs-club-mvc/model"
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
 
 func RentalSingleResponse(rental *model.Rental) *RentalResponse {
-	return &RentalResponse{
-		PublicID:  rental.PublicID,
-		CreatedAt: rental.CreatedAt,
-		RentedAt:  rental.RentedAt,
-		UserID:    rental.UserID,
-		TapeID:    rental.TapeID,
-		TapeTitle: rental.TapeTitle,
-		Username:  rental.Username,
+	response := &RentalResponse{
+		PublicID:     rental.PublicID,
+		CreatedAt:    rental.CreatedAt,
+		RentedAt:     rental.RentedAt,
+		UserID:       rental.UserID,
+		TapeID:       rental.TapeID,
+		TapeTitle:    rental.TapeTitle,
+		Username:     rental.Username,
+		DueAt:        rental.DueAt,
+		LateFeeCents: rental.LateFeeCents,
+		Renewals:     rental.Renewals,
+	}
+	if rental.ReturnedAt.Valid {
+		response.ReturnedAt = &rental.ReturnedAt.Time
+	}
+	if rental.CopyBarcode.Valid {
+		response.CopyBarcode = &rental.CopyBarcode.String
 	}
+	if rental.FeePaidAt.Valid {
+		response.FeePaidAt = &rental.FeePaidAt.Time
+	}
+	return response
 }
 
 func RentalListResponse(rentals []*model.Rental) []*RentalResponse {
@@ -21,3 +39,23 @@ func RentalListResponse(rentals []*model.Rental) []*RentalResponse {
 	}
 	return rentalList
 }
+
+func (q *RentalHistoryQuery) ToModel() *model.RentalFilter {
+	filter := &model.RentalFilter{
+		From: q.From,
+	}
+	if q.To != nil {
+		// Inclusive end day, the query compares against the start of the following day
+		to := q.To.Add(24 * time.Hour)
+		filter.To = &to
+	}
+	if q.TapeID != "" {
+		// Already validated by the uuid binding
+		tapeID := uuid.MustParse(q.TapeID)
+		filter.TapePublicID = &tapeID
+	}
+	if q.Status != "all" {
+		filter.Status = q.Status
+	}
+	return filter
+}
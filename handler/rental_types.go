@@ -15,6 +15,14 @@ type ReturnRentalRequest struct {
 	UserPublicID string `json:"user_id" binding:"required"`
 }
 
+// Dates are inclusive calendar days (YYYY-MM-DD) on rented_at
+type RentalHistoryQuery struct {
+	From   *time.Time `form:"from" time_format:"2006-01-02"`
+	To     *time.Time `form:"to" time_format:"2006-01-02"`
+	TapeID string     `form:"tape_id" binding:"omitempty,uuid"`
+	Status string     `form:"status" binding:"omitempty,oneof=active returned all"`
+}
+
 type RentalResponse struct {
 	PublicID  uuid.UUID `json:"public_id"`
 	TapeID    int32     `jsong:"tape_id"`
@@ -22,5 +30,13 @@ type RentalResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	TapeTitle string    `json:"tape_title"`
 	Username  string    `json:"username"`
-	RentedAt  time.Time `json:"rented_at"`
+	// Barcode of the rented copy, null for rentals made before copies were tracked
+	CopyBarcode *string    `json:"copy_barcode"`
+	RentedAt    time.Time  `json:"rented_at"`
+	DueAt       time.Time  `json:"due_at"`
+	Renewals    int32      `json:"renewals"`
+	ReturnedAt  *time.Time `json:"returned_at"`
+	// Late fees are only charged when an overdue tape comes back
+	LateFeeCents int32      `json:"late_fee_cents"`
+	FeePaidAt    *time.Time `json:"fee_paid_at"`
 }
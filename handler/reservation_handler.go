@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/rigofekete/vhs-club-mvc/service"
+)
+
+type ReservationHandler struct {
+	reservationService service.ReservationService
+}
+
+func NewReservationHandler(s service.ReservationService) *ReservationHandler {
+	return &ReservationHandler{reservationService: s}
+}
+
+func (h *ReservationHandler) RegisterRoutes(r *gin.Engine, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limit := limiter.Group("reservations")
+
+	user := r.Group("/api/reservations")
+	user.Use(authn.OptionalAuth(), limit, authn.UserAuth())
+	{
+		user.GET("/me", h.GetMyReservations)
+		user.POST("/:id", h.CreateReservation)
+		user.DELETE("/:id", h.CancelReservation)
+	}
+}
+
+func (h *ReservationHandler) CreateReservation(c *gin.Context) {
+	tapeID := c.Param("id")
+	userPublicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	reservation, err := h.reservationService.ReserveTape(c.Request.Context(), tapeID, userPublicID.String())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ReservationSingleResponse(reservation))
+}
+
+func (h *ReservationHandler) GetMyReservations(c *gin.Context) {
+	userPublicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	reservations, err := h.reservationService.GetMyReservations(c.Request.Context(), userPublicID.String())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, ReservationListResponse(reservations))
+}
+
+func (h *ReservationHandler) CancelReservation(c *gin.Context) {
+	reservationID := c.Param("id")
+	userPublicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	if err := h.reservationService.CancelReservation(c.Request.Context(), userPublicID.String(), reservationID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import "github.com/rigofekete/vhs-club-mvc/model"
+
+func ReservationSingleResponse(reservation *model.Reservation) *ReservationResponse {
+	response := &ReservationResponse{
+		PublicID:     reservation.PublicID,
+		TapePublicID: reservation.TapePublicID,
+		TapeTitle:    reservation.TapeTitle,
+		Status:       reservation.Status,
+		CreatedAt:    reservation.CreatedAt,
+	}
+	if reservation.Status == model.ReservationStatusWaiting {
+		response.Position = &reservation.Position
+	}
+	if reservation.HoldExpiresAt.Valid {
+		response.HoldExpiresAt = &reservation.HoldExpiresAt.Time
+	}
+	return response
+}
+
+func ReservationListResponse(reservations []*model.Reservation) []*ReservationResponse {
+	reservationList := make([]*ReservationResponse, len(reservations))
+	for i, reservation := range reservations {
+		reservationList[i] = ReservationSingleResponse(reservation)
+	}
+	return reservationList
+}
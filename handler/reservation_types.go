@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReservationResponse struct {
+	PublicID     uuid.UUID `json:"public_id"`
+	TapePublicID uuid.UUID `json:"tape_id"`
+	TapeTitle    string    `json:"tape_title"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Only set while waiting in the queue
+	Position *int32 `json:"position,omitempty"`
+	// Only set once a copy is held, the tape must be rented before this time
+	HoldExpiresAt *time.Time `json:"hold_expires_at,omitempty"`
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/rigofekete/vhs-club-mvc/service"
+)
+
+type TapeCopyHandler struct {
+	copyService service.TapeCopyService
+}
+
+func NewTapeCopyHandler(s service.TapeCopyService) *TapeCopyHandler {
+	return &TapeCopyHandler{copyService: s}
+}
+
+func (h *TapeCopyHandler) RegisterRoutes(r *gin.Engine, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limit := limiter.Group("copies")
+
+	adminTapes := r.Group("/api/tapes")
+	adminTapes.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
+	{
+		adminTapes.GET("/:id/copies", h.GetTapeCopies)
+		adminTapes.POST("/:id/copies", h.CreateTapeCopy)
+	}
+
+	admin := r.Group("/api/copies")
+	admin.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
+	{
+		admin.GET("/:id", h.GetTapeCopy)
+		admin.PATCH("/:id", h.UpdateTapeCopy)
+		admin.POST("/:id/retire", h.RetireTapeCopy)
+	}
+}
+
+func (h *TapeCopyHandler) CreateTapeCopy(c *gin.Context) {
+	tapeID := c.Param("id")
+	var newCopy CreateTapeCopyRequest
+	if err := c.ShouldBindJSON(&newCopy); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	createdCopy, err := h.copyService.AddCopy(c.Request.Context(), tapeID, newCopy.ToModel())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, TapeCopySingleResponse(createdCopy))
+}
+
+func (h *TapeCopyHandler) GetTapeCopies(c *gin.Context) {
+	tapeID := c.Param("id")
+	copies, err := h.copyService.GetCopiesByTape(c.Request.Context(), tapeID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, TapeCopyListResponse(copies))
+}
+
+func (h *TapeCopyHandler) GetTapeCopy(c *gin.Context) {
+	id := c.Param("id")
+	tapeCopy, err := h.copyService.GetCopy(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, TapeCopySingleResponse(tapeCopy))
+}
+
+func (h *TapeCopyHandler) UpdateTapeCopy(c *gin.Context) {
+	id := c.Param("id")
+	var req UpdateTapeCopyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	updatedCopy, err := h.copyService.UpdateCondition(c.Request.Context(), id, req.Condition)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, TapeCopySingleResponse(updatedCopy))
+}
+
+func (h *TapeCopyHandler) RetireTapeCopy(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.copyService.RetireCopy(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import "github.com/rigofekete/vhs-club-mvc/model"
+
+func (r *CreateTapeCopyRequest) ToModel() *model.TapeCopy {
+	tapeCopy := &model.TapeCopy{
+		Barcode:   r.Barcode,
+		Condition: r.Condition,
+	}
+	if tapeCopy.Condition == "" {
+		tapeCopy.Condition = model.CopyConditionGood
+	}
+	if r.AcquiredAt != nil {
+		tapeCopy.AcquiredAt = r.AcquiredAt.UTC()
+	}
+	return tapeCopy
+}
+
+func TapeCopySingleResponse(tapeCopy *model.TapeCopy) *TapeCopyResponse {
+	return &TapeCopyResponse{
+		PublicID:     tapeCopy.PublicID,
+		TapePublicID: tapeCopy.TapePublicID,
+		Barcode:      tapeCopy.Barcode,
+		Condition:    tapeCopy.Condition,
+		Status:       tapeCopy.Status,
+		AcquiredAt:   tapeCopy.AcquiredAt,
+		CreatedAt:    tapeCopy.CreatedAt,
+		UpdatedAt:    tapeCopy.UpdatedAt,
+	}
+}
+
+func TapeCopyListResponse(copies []*model.TapeCopy) []*TapeCopyResponse {
+	copyList := make([]*TapeCopyResponse, len(copies))
+	for i, tapeCopy := range copies {
+		copyList[i] = TapeCopySingleResponse(tapeCopy)
+	}
+	return copyList
+}
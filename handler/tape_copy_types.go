@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateTapeCopyRequest struct {
+	Barcode   string `json:"barcode" binding:"required,max=50"`
+	Condition string `json:"condition" binding:"omitempty,oneof=new good worn damaged"`
+	// Defaults to the time the copy is added
+	AcquiredAt *time.Time `json:"acquired_at"`
+}
+
+type UpdateTapeCopyRequest struct {
+	Condition string `json:"condition" binding:"required,oneof=new good worn damaged"`
+}
+
+type TapeCopyResponse struct {
+	PublicID     uuid.UUID `json:"public_id"`
+	TapePublicID uuid.UUID `json:"tape_id"`
+	Barcode      string    `json:"barcode"`
+	Condition    string    `json:"condition"`
+	Status       string    `json:"status"`
+	AcquiredAt   time.Time `json:"acquired_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -18,13 +18,16 @@ func NewTapeHandler(s service.TapeService) *TapeHandler {
 	return &TapeHandler{tapeService: s}
 }
 
-func (h *TapeHandler) RegisterRoutes(r *gin.Engine) {
-	app := r.Group("/api/tapes")
+func (h *TapeHandler) RegisterRoutes(r *gin.Engine, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limit := limiter.Group("tapes")
+
+	app := r.Group("/api/tapes", authn.OptionalAuth(), limit)
 	app.GET("/", h.GetAllTapes)
+	app.GET("/search", h.SearchTapes)
 	app.GET("/:id", h.GetTapeByID)
 
 	admin := r.Group("/api/tapes")
-	admin.Use(middleware.AdminAuth())
+	admin.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
 	{
 		admin.POST("/", h.CreateTape)
 		admin.POST("/batch/", h.CreateTapeBatch)
@@ -69,9 +72,31 @@ func (h *TapeHandler) CreateTapeBatch(c *gin.Context) {
 }
 
 func (h *TapeHandler) GetAllTapes(c *gin.Context) {
-	tapes, err := h.tapeService.GetAllTapes(c.Request.Context())
+	var query ListTapesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	page, err := h.tapeService.ListTapes(c.Request.Context(), query.ToModel(), query.Cursor, query.Limit)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, TapePageListResponse(page))
+}
+
+func (h *TapeHandler) SearchTapes(c *gin.Context) {
+	var query SearchTapesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	tapes, err := h.tapeService.SearchTapes(c.Request.Context(), query.Q, query.Limit)
 	if err != nil {
 		_ = c.Error(err)
+		return
 	}
 	c.JSON(http.StatusOK, TapeListResponse(tapes))
 }
@@ -83,7 +108,7 @@ func (h *TapeHandler) GetTapeByID(c *gin.Context) {
 		_ = c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, tape)
+	c.JSON(http.StatusOK, TapeSingleResponse(tape))
 }
 
 func (h *TapeHandler) UpdateTape(c *gin.Context) {
@@ -128,6 +153,5 @@ func (h *TapeHandler) DeleteAllTapes(c *gin.Context) {
 func updateValid(req *UpdateTapeRequest) bool {
 	return (req.Title != nil ||
 		req.Director != nil ||
-		req.Genre != nil ||
-		req.Quantity != nil)
+		req.Genre != nil)
 }
@@ -28,6 +28,10 @@ func TapeSingleResponse(tape *model.Tape) TapeResponse {
 		Director:  tape.Director,
 		Genre:     tape.Genre,
 		Quantity:  tape.Quantity,
+		RentedOut: tape.RentedOut,
+		OnHold:    tape.OnHold,
+		// Retiring a copy held for a reservation must not show negative stock
+		Available: max(tape.Quantity-tape.RentedOut-tape.OnHold, 0),
 	}
 }
 
@@ -39,12 +43,36 @@ func TapeListResponse(tapes []*model.Tape) []TapeResponse {
 	return tapeList
 }
 
+func (q *ListTapesQuery) ToModel() *model.TapeFilter {
+	filter := &model.TapeFilter{
+		Sort:          q.Sort,
+		AvailableOnly: q.AvailableOnly,
+	}
+	if q.Genre != "" {
+		filter.Genre = &q.Genre
+	}
+	if q.Director != "" {
+		filter.Director = &q.Director
+	}
+	return filter
+}
+
+func TapePageListResponse(page *model.TapePage) TapePageResponse {
+	response := TapePageResponse{
+		Tapes: TapeListResponse(page.Tapes),
+		Total: page.Total,
+	}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response
+}
+
 func (r UpdateTapeRequest) ToModel() *model.UpdateTape {
 	return &model.UpdateTape{
 		Title:    r.Title,
 		Director: r.Director,
 		Genre:    r.Genre,
-		Quantity: r.Quantity,
 	}
 }
 
@@ -57,5 +85,8 @@ func TapeUpdateResponse(tape *model.Tape) TapeResponse {
 		Director:  tape.Director,
 		Genre:     tape.Genre,
 		Quantity:  tape.Quantity,
+		RentedOut: tape.RentedOut,
+		OnHold:    tape.OnHold,
+		Available: max(tape.Quantity-tape.RentedOut-tape.OnHold, 0),
 	}
 }
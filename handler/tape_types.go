@@ -10,7 +10,8 @@ type CreateTapeRequest struct {
 	Title    string `json:"title" binding:"required"`
 	Director string `json:"director" binding:"required"`
 	Genre    string `json:"genre" binding:"required"`
-	Quantity int32  `json:"quantity" binding:"required,gt=0"`
+	// Number of copies created along with the tape, more are added through the copies endpoints
+	Quantity int32 `json:"quantity" binding:"required,gt=0"`
 }
 
 type CreateTapeBatchRequest struct {
@@ -21,7 +22,20 @@ type UpdateTapeRequest struct {
 	Title    *string `json:"title" binding:"omitempty,min=1,max=100"`
 	Director *string `json:"director" binding:"omitempty,min=1,max=50"`
 	Genre    *string `json:"genre" binding:"omitempty,min=1,max=50"`
-	Quantity *int32  `json:"quantity" binding:"omitempty,gte=0"`
+}
+
+type ListTapesQuery struct {
+	Sort          string `form:"sort" binding:"omitempty,oneof=created_at -created_at title -title"`
+	Genre         string `form:"genre"`
+	Director      string `form:"director"`
+	AvailableOnly bool   `form:"available_only"`
+	Cursor        string `form:"cursor"`
+	Limit         int32  `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type SearchTapesQuery struct {
+	Q     string `form:"q" binding:"required"`
+	Limit int32  `form:"limit" binding:"omitempty,min=1,max=100"`
 }
 
 type TapeResponse struct {
@@ -32,9 +46,19 @@ type TapeResponse struct {
 	Director  string    `json:"director"`
 	Genre     string    `json:"genre"`
 	Quantity  int32     `json:"quantity"`
+	RentedOut int32     `json:"rented_out"`
+	OnHold    int32     `json:"on_hold"`
+	Available int32     `json:"available"`
 }
 
 type TapeBatchResponse struct {
 	Tapes         []TapeResponse `json:"tapes"`
 	AlreadyExists int32          `json:"already_exists"`
 }
+
+type TapePageResponse struct {
+	Tapes []TapeResponse `json:"tapes"`
+	// Null on the last page
+	NextCursor *string `json:"next_cursor"`
+	Total      int64   `json:"total"`
+}
@@ -11,24 +11,42 @@ import (
 
 type UserHandler struct {
 	userService service.UserService
+	// Per client IP limit of the unauthenticated login route
+	loginLimit gin.HandlerFunc
 }
 
-func NewUserHandler(s service.UserService) *UserHandler {
+func NewUserHandler(s service.UserService, loginLimit gin.HandlerFunc) *UserHandler {
 	return &UserHandler{
 		userService: s,
+		loginLimit:  loginLimit,
 	}
 }
 
-func (h *UserHandler) RegisterRoutes(r *gin.Engine) {
-	user := r.Group("/api/users")
-	user.POST("/login", h.UserLogin)
+func (h *UserHandler) RegisterRoutes(r *gin.Engine, authn *middleware.Authenticator, limiter *middleware.RateLimiter) {
+	limit := limiter.Group("users")
+
+	user := r.Group("/api/users", authn.OptionalAuth(), limit)
+	user.POST("/login", h.loginLimit, h.UserLogin)
+	user.POST("/refresh", h.RefreshToken)
+	user.POST("/logout", h.Logout)
 	user.POST("/", h.CreateUser)
 
+	me := r.Group("/api/users/me")
+	me.Use(authn.OptionalAuth(), limit, authn.UserAuth())
+	{
+		me.GET("", h.GetMe)
+		me.PATCH("", h.UpdateMe)
+		me.POST("/password", h.ChangePassword)
+	}
+
 	admin := r.Group("/api/users")
-	admin.Use(middleware.AdminAuth())
+	admin.Use(authn.OptionalAuth(), limit, authn.AdminAuth())
 	{
 		admin.POST("/batch", h.CreateUserBatch)
 		admin.GET("/:id", h.GetUserByID)
+		admin.PATCH("/:id", h.UpdateUserRole)
+		admin.POST("/:id/disable", h.DisableUser)
+		admin.DELETE("/:id", h.DeleteUser)
 		admin.GET("/", h.GetUsers)
 		admin.DELETE("/", h.DeleteAllUsers)
 	}
@@ -86,6 +104,103 @@ func (h *UserHandler) UserLogin(c *gin.Context) {
 	c.JSON(http.StatusOK, LoginResponse(loggedUser))
 }
 
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	refreshedUser, err := h.userService.RefreshToken(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse(refreshedUser))
+}
+
+func (h *UserHandler) Logout(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	if err := h.userService.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *UserHandler) GetMe(c *gin.Context) {
+	publicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), publicID.String())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSingleResponse(user))
+}
+
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	publicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	if !userUpdateValid(&req) {
+		_ = c.Error(apperror.ErrUserUpdateRequest)
+		return
+	}
+
+	user, err := h.userService.UpdateUser(c.Request.Context(), publicID.String(), req.ToModel())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSingleResponse(user))
+}
+
+// Answers with new tokens, the change logs out every session including the current one
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	publicID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	user, err := h.userService.ChangePassword(c.Request.Context(), publicID.String(), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse(user))
+}
+
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id := c.Param("id")
 	user, err := h.userService.GetUserByID(c.Request.Context(), id)
@@ -107,6 +222,60 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, UserListResponse(users))
 }
 
+// Promotes or demotes a user, the change is recorded with the admin who made it
+func (h *UserHandler) UpdateUserRole(c *gin.Context) {
+	adminID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	var req UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(apperror.WrapValidationError(err))
+		return
+	}
+
+	user, err := h.userService.UpdateUserRole(c.Request.Context(), adminID, c.Param("id"), req.Role)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSingleResponse(user))
+}
+
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	adminID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	user, err := h.userService.DisableUser(c.Request.Context(), adminID, c.Param("id"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, UserSingleResponse(user))
+}
+
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	adminID, ok := middleware.GetUserID(c)
+	if !ok {
+		_ = c.Error(apperror.ErrUserFieldValidation)
+		return
+	}
+
+	if err := h.userService.DeleteUser(c.Request.Context(), adminID, c.Param("id")); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func (h *UserHandler) DeleteAllUsers(c *gin.Context) {
 	err := h.userService.DeleteAllUsers(c.Request.Context())
 	if err != nil {
@@ -116,3 +285,7 @@ func (h *UserHandler) DeleteAllUsers(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+func userUpdateValid(req *UpdateUserRequest) bool {
+	return req.Email != nil
+}
@@ -17,6 +17,12 @@ func (r *UserLoginRequest) ToModel() *model.User {
 	}
 }
 
+func (r UpdateUserRequest) ToModel() *model.UpdateUser {
+	return &model.UpdateUser{
+		Email: r.Email,
+	}
+}
+
 func (r *CreateUserBatchRequest) ToModels() []*model.User {
 	users := make([]*model.User, 0, len(r.Users))
 	for _, u := range r.Users {
@@ -26,19 +32,25 @@ func (r *CreateUserBatchRequest) ToModels() []*model.User {
 }
 
 func UserSingleResponse(user *model.User) UserResponse {
-	return UserResponse{
+	response := UserResponse{
 		PublicID: user.PublicID,
 		Username: user.Username,
 		Email:    user.Email,
+		Role:     user.Role,
+	}
+	if user.DisabledAt.Valid {
+		response.DisabledAt = &user.DisabledAt.Time
 	}
+	return response
 }
 
 func LoginResponse(user *model.User) UserLoginResponse {
 	return UserLoginResponse{
-		PublicID: user.PublicID,
-		Username: user.Username,
-		Email:    user.Email,
-		Token:    user.Token,
+		PublicID:     user.PublicID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Token:        user.Token,
+		RefreshToken: user.RefreshToken,
 	}
 }
 
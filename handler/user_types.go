@@ -1,6 +1,10 @@
 package handler
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,alphanum,min=4,max=20"`
@@ -13,22 +17,42 @@ type UserLoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type UpdateUserRequest struct {
+	Email *string `json:"email" binding:"omitempty,email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=20"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 type CreateUserBatchRequest struct {
 	// dive validator needed to iterate each object of the slice and apply the CreateUserRequest binded validations
 	Users []CreateUserRequest `json:"users" binding:"required,dive"`
 }
 
 type UserResponse struct {
-	PublicID uuid.UUID `json:"public_id"`
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
+	PublicID   uuid.UUID  `json:"public_id"`
+	Username   string     `json:"username"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
 }
 
 type UserLoginResponse struct {
-	PublicID uuid.UUID `json:"public_id"`
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
-	Token    string    `json:"token"`
+	PublicID     uuid.UUID `json:"public_id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
 }
 
 type UserBatchResponse struct {
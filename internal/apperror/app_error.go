@@ -2,44 +2,102 @@ package apperror
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
 )
 
 type AppError struct {
-	Code    int
+	Status int
+	// Stable machine readable code such as TAPE_UNAVAILABLE, clients branch on it instead of Message
+	Code    string
+	Title   string
 	Message string
-	Fields  map[string]string `json:"fields,omitempty"`
+	Fields  map[string]string
 }
 
 // Sentinel Errors
 var (
 	// General
 	ErrBadRequest = errors.New("bad request")
+	ErrInvalidID  = errors.New("invalid id")
+	// Database
+	ErrConflict            = errors.New("unique constraint violation")
+	ErrReferenceViolation  = errors.New("foreign key violation")
+	ErrConstraintViolation = errors.New("check constraint violation")
+	ErrDatabaseUnavailable = errors.New("database unavailable")
 	// User
 	ErrUserNotFound        = errors.New("user not found")
 	ErrUserFieldValidation = errors.New("invalid user fields")
 	ErrUserExists          = errors.New("user already exists")
 	ErrUserInvalidPW       = errors.New("invalid password")
+	ErrInvalidRole         = errors.New("invalid user role")
+	ErrEmailExists         = errors.New("email already in use")
+	ErrUserUpdateRequest   = errors.New("bad update user request")
+	ErrOwnAccount          = errors.New("admins cannot change their own account")
+	ErrUserHasRentals      = errors.New("user has active rentals or unpaid late fees")
 	// Tape
 	ErrTapeValidation    = errors.New("invalid tape fields")
 	ErrTapeExists        = errors.New("tape already exists")
 	ErrTapeNotFound      = errors.New("tape not found")
 	ErrTapeUpdateRequest = errors.New("bad update tape request")
+	ErrInvalidCursor     = errors.New("invalid pagination cursor")
+	ErrTapeSearchQuery   = errors.New("invalid tape search query")
+	// Tape copies
+	ErrCopyNotFound = errors.New("tape copy not found")
+	ErrCopyExists   = errors.New("tape copy barcode already exists")
+	ErrCopyRented   = errors.New("tape copy is rented out")
 	// Rentals
 	ErrTapeUnavailable   = errors.New("unavailable tape")
 	ErrMaxRentalsPerUser = errors.New("cannot rent more tapes")
+	ErrRentalNotFound    = errors.New("rental not found")
+	ErrRentalBlocked     = errors.New("overdue tapes or unpaid late fees")
+	ErrRenewalLimit      = errors.New("rental renewal limit reached")
+	ErrRenewalOverdue    = errors.New("overdue rental cannot be renewed")
+	ErrRenewalReserved   = errors.New("tape reserved by another member")
+	// Reservations
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationExists   = errors.New("reservation already exists")
+	ErrTapeAvailable       = errors.New("tape available, no reservation needed")
 	// Auth
-	ErrInvalidHeader = errors.New("invalid header")
-	ErrInvalidToken  = errors.New("invalid token")
-	ErrInvalidIssuer = errors.New("invalid issuer")
-	ErrInvalidUserID = errors.New("invalid user id")
-	ErrInvalidUser   = errors.New("invalid user")
-	ErrInvalidAdmin  = errors.New("invalid admin")
+	ErrInvalidHeader     = errors.New("invalid header")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrInvalidIssuer     = errors.New("invalid issuer")
+	ErrInvalidUserID     = errors.New("invalid user id")
+	ErrInvalidUser       = errors.New("invalid user")
+	ErrInvalidAdmin      = errors.New("invalid admin")
+	ErrAccountDisabled   = errors.New("account disabled")
+	ErrTokenReused       = errors.New("refresh token reused")
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	// Throttling
+	ErrRateLimited   = errors.New("too many requests")
+	ErrAccountLocked = errors.New("account locked after failed logins")
 )
 
+// RetryAfterError tells the client when to try again, ErrorHandler sends it as the Retry-After header
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+func WithRetryAfter(err error, after time.Duration) error {
+	return &RetryAfterError{Err: err, After: after}
+}
+
 type ValidationError struct {
 	Fields map[string]string
 }
@@ -52,7 +110,8 @@ func (e ValidationError) Error() string {
 func WrapValidationError(err error) error {
 	validationErrors, ok := err.(validator.ValidationErrors)
 	if !ok {
-		return err
+		// Malformed JSON bodies or query values that can't be parsed into the request type
+		return fmt.Errorf("%w: %v", ErrBadRequest, err)
 	}
 
 	fields := make(map[string]string)
@@ -71,6 +130,10 @@ func WrapValidationError(err error) error {
 			fields[field] = "Must be at least " + fieldError.Param() + " characters"
 		case "max":
 			fields[field] = "Must be at most " + fieldError.Param() + " characters"
+		case "oneof":
+			fields[field] = "Must be one of: " + fieldError.Param()
+		case "uuid":
+			fields[field] = "Must be a valid UUID"
 		default:
 			fields[field] = "Invalid value"
 		}
@@ -83,50 +146,27 @@ func mapErrorToAppError(err error) *AppError {
 	var validationErr ValidationError
 	if errors.As(err, &validationErr) {
 		return &AppError{
-			Code:    http.StatusBadRequest,
+			Status:  http.StatusBadRequest,
+			Code:    CodeValidationFailed,
+			Title:   "Validation failed",
 			Message: "Input validation failed",
 			Fields:  validationErr.Fields,
 		}
 	}
 
-	// Check sentinel errors
-	switch {
-	case errors.Is(err, ErrBadRequest):
-		return &AppError{Code: http.StatusBadRequest, Message: "Bad request"}
-	case errors.Is(err, ErrUserNotFound):
-		return &AppError{Code: http.StatusNotFound, Message: "User not found"}
-	case errors.Is(err, ErrUserExists):
-		return &AppError{Code: http.StatusConflict, Message: "User already exists in the DB"}
-	case errors.Is(err, ErrUserFieldValidation):
-		return &AppError{Code: http.StatusUnprocessableEntity, Message: "Invalid user fields"}
-	case errors.Is(err, ErrUserInvalidPW):
-		return &AppError{Code: http.StatusUnauthorized, Message: "Invalid password"}
-	case errors.Is(err, ErrTapeValidation):
-		return &AppError{Code: http.StatusUnprocessableEntity, Message: "Invalid tape fields"}
-	case errors.Is(err, ErrTapeExists):
-		return &AppError{Code: http.StatusConflict, Message: "Tape already exists in the DB"}
-	case errors.Is(err, ErrTapeNotFound):
-		return &AppError{Code: http.StatusNotFound, Message: "Tape not found"}
-	case errors.Is(err, ErrTapeUpdateRequest):
-		return &AppError{Code: http.StatusBadRequest, Message: "Tape update request needs at least 1 non nil value"}
-	case errors.Is(err, ErrTapeUnavailable):
-		return &AppError{Code: http.StatusUnprocessableEntity, Message: "Sorry, all tapes for this movie are currently rented out."}
-	case errors.Is(err, ErrMaxRentalsPerUser):
-		return &AppError{Code: http.StatusBadRequest, Message: "Unfortunately, you cannot rent more movies at the moment. Please return one of your currently rented tapes."}
-	case errors.Is(err, ErrInvalidHeader):
-		return &AppError{Code: http.StatusUnauthorized, Message: "Missing or invalid authorization header"}
-	case errors.Is(err, ErrInvalidToken):
-		return &AppError{Code: http.StatusUnauthorized, Message: "Invalid or expired token"}
-	case errors.Is(err, ErrInvalidIssuer):
-		return &AppError{Code: http.StatusUnauthorized, Message: "Invalid issuer"}
-	case errors.Is(err, ErrInvalidUserID):
-		return &AppError{Code: http.StatusUnauthorized, Message: "Invalid user ID"}
-	case errors.Is(err, ErrInvalidAdmin):
-		return &AppError{Code: http.StatusForbidden, Message: "Admin access required"}
-	case errors.Is(err, ErrInvalidUser):
-		return &AppError{Code: http.StatusForbidden, Message: "User/Admin access required"}
-	default:
-		return &AppError{Code: http.StatusInternalServerError, Message: "Internal server error"}
+	// Check sentinel errors, in registry order
+	for _, entry := range registry {
+		if errors.Is(err, entry.err) {
+			appErr := entry.appErr
+			return &appErr
+		}
+	}
+
+	return &AppError{
+		Status:  http.StatusInternalServerError,
+		Code:    CodeInternal,
+		Title:   "Internal server error",
+		Message: "Internal server error",
 	}
 }
 
@@ -141,14 +181,32 @@ func ErrorHandler() gin.HandlerFunc {
 		}
 		appErr := mapErrorToAppError(err.Err)
 
-		response := gin.H{
-			"error": appErr.Message,
+		ctx := c.Request.Context()
+		// The client only sees "Internal server error", the cause is kept in the logs
+		if appErr.Status >= http.StatusInternalServerError {
+			logging.FromContext(ctx).Error("request failed", "error", err.Err)
+		}
+
+		problem := Problem{
+			Type:     problemType(appErr.Code),
+			Title:    appErr.Title,
+			Status:   appErr.Status,
+			Detail:   appErr.Message,
+			Instance: c.Request.URL.Path,
+			Code:     appErr.Code,
+			Fields:   appErr.Fields,
+			// Lets support find the log lines of a request a user reports
+			RequestID: logging.RequestID(ctx),
 		}
 
-		if appErr.Fields != nil {
-			response["fields"] = appErr.Fields
+		var retryErr *RetryAfterError
+		if errors.As(err.Err, &retryErr) {
+			// Whole seconds, rounded up so the client does not come back too early
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.After.Seconds()))))
 		}
 
-		c.JSON(appErr.Code, response)
+		// Set ahead of c.JSON, which only fills in the content type when it is missing
+		c.Header("Content-Type", ProblemContentType)
+		c.JSON(appErr.Status, problem)
 	}
 }
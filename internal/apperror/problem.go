@@ -0,0 +1,98 @@
+package apperror
+
+import (
+	"net/http"
+	"strings"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response
+type Problem struct {
+	// Relative URI naming the kind of problem, derived from Code
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	// Path of the request that failed
+	Instance string            `json:"instance"`
+	Code     string            `json:"code"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	// Matches the X-Request-ID response header
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Codes without a sentinel of their own
+const (
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeInternal         = "INTERNAL_ERROR"
+)
+
+// TAPE_UNAVAILABLE becomes /problems/tape-unavailable
+func problemType(code string) string {
+	return "/problems/" + strings.ToLower(strings.ReplaceAll(code, "_", "-"))
+}
+
+type registeredError struct {
+	err    error
+	appErr AppError
+}
+
+// Response of every sentinel error. Checked in order with errors.Is, a sentinel missing
+// here would be answered with a 500, the registry test fails when one is.
+var registry = []registeredError{
+	// General
+	{ErrBadRequest, AppError{Status: http.StatusBadRequest, Code: "BAD_REQUEST", Title: "Bad request", Message: "Bad request"}},
+	{ErrInvalidID, AppError{Status: http.StatusBadRequest, Code: "INVALID_ID", Title: "Invalid ID", Message: "IDs must be valid UUIDs"}},
+	// Database, for violations the repositories have no more specific sentinel for
+	{ErrConflict, AppError{Status: http.StatusConflict, Code: "CONFLICT", Title: "Conflict", Message: "A record with these values already exists"}},
+	{ErrReferenceViolation, AppError{Status: http.StatusConflict, Code: "REFERENCE_VIOLATION", Title: "Reference violation", Message: "The referenced record does not exist or is still in use"}},
+	{ErrConstraintViolation, AppError{Status: http.StatusUnprocessableEntity, Code: "CONSTRAINT_VIOLATION", Title: "Constraint violation", Message: "One of the values is not allowed"}},
+	{ErrDatabaseUnavailable, AppError{Status: http.StatusServiceUnavailable, Code: "DATABASE_UNAVAILABLE", Title: "Service unavailable", Message: "The service is temporarily unavailable, please try again later"}},
+	// User
+	{ErrUserNotFound, AppError{Status: http.StatusNotFound, Code: "USER_NOT_FOUND", Title: "User not found", Message: "User not found"}},
+	{ErrUserExists, AppError{Status: http.StatusConflict, Code: "USER_EXISTS", Title: "User already exists", Message: "User already exists in the DB"}},
+	{ErrUserFieldValidation, AppError{Status: http.StatusUnprocessableEntity, Code: "INVALID_USER_FIELDS", Title: "Invalid user fields", Message: "Invalid user fields"}},
+	{ErrUserInvalidPW, AppError{Status: http.StatusUnauthorized, Code: "INVALID_PASSWORD", Title: "Invalid password", Message: "Invalid password"}},
+	{ErrInvalidRole, AppError{Status: http.StatusUnprocessableEntity, Code: "INVALID_ROLE", Title: "Invalid role", Message: "Role must be user or admin"}},
+	{ErrEmailExists, AppError{Status: http.StatusConflict, Code: "EMAIL_EXISTS", Title: "Email already in use", Message: "Another account already uses this email"}},
+	{ErrUserUpdateRequest, AppError{Status: http.StatusBadRequest, Code: "EMPTY_USER_UPDATE", Title: "Empty user update", Message: "User update request needs at least 1 non nil value"}},
+	{ErrOwnAccount, AppError{Status: http.StatusConflict, Code: "OWN_ACCOUNT", Title: "Own account", Message: "Admins cannot change the role of, disable or delete their own account"}},
+	{ErrUserHasRentals, AppError{Status: http.StatusConflict, Code: "USER_HAS_RENTALS", Title: "User has rentals", Message: "The user has tapes out or unpaid late fees, settle them before deleting the account"}},
+	// Tape
+	{ErrTapeValidation, AppError{Status: http.StatusUnprocessableEntity, Code: "INVALID_TAPE_FIELDS", Title: "Invalid tape fields", Message: "Invalid tape fields"}},
+	{ErrTapeExists, AppError{Status: http.StatusConflict, Code: "TAPE_EXISTS", Title: "Tape already exists", Message: "Tape already exists in the DB"}},
+	{ErrTapeNotFound, AppError{Status: http.StatusNotFound, Code: "TAPE_NOT_FOUND", Title: "Tape not found", Message: "Tape not found"}},
+	{ErrTapeUpdateRequest, AppError{Status: http.StatusBadRequest, Code: "EMPTY_TAPE_UPDATE", Title: "Empty tape update", Message: "Tape update request needs at least 1 non nil value"}},
+	{ErrInvalidCursor, AppError{Status: http.StatusBadRequest, Code: "INVALID_CURSOR", Title: "Invalid cursor", Message: "Invalid pagination cursor"}},
+	{ErrTapeSearchQuery, AppError{Status: http.StatusBadRequest, Code: "INVALID_SEARCH_QUERY", Title: "Invalid search query", Message: "Search query needs at least one letter or number"}},
+	// Tape copies
+	{ErrCopyNotFound, AppError{Status: http.StatusNotFound, Code: "COPY_NOT_FOUND", Title: "Tape copy not found", Message: "Tape copy not found"}},
+	{ErrCopyExists, AppError{Status: http.StatusConflict, Code: "COPY_EXISTS", Title: "Tape copy already exists", Message: "A tape copy with this barcode already exists"}},
+	{ErrCopyRented, AppError{Status: http.StatusConflict, Code: "COPY_RENTED", Title: "Tape copy rented out", Message: "This copy is rented out, it can be retired once it is returned"}},
+	// Rentals
+	{ErrTapeUnavailable, AppError{Status: http.StatusUnprocessableEntity, Code: "TAPE_UNAVAILABLE", Title: "Tape unavailable", Message: "Sorry, all tapes for this movie are currently rented out. You can reserve one instead."}},
+	{ErrMaxRentalsPerUser, AppError{Status: http.StatusBadRequest, Code: "MAX_RENTALS_REACHED", Title: "Rental limit reached", Message: "Unfortunately, you cannot rent more movies at the moment. Please return one of your currently rented tapes."}},
+	{ErrRentalNotFound, AppError{Status: http.StatusNotFound, Code: "RENTAL_NOT_FOUND", Title: "Rental not found", Message: "Rental not found"}},
+	{ErrRentalBlocked, AppError{Status: http.StatusForbidden, Code: "RENTAL_BLOCKED", Title: "Renting blocked", Message: "Please return your overdue tapes and pay any late fees before renting again."}},
+	{ErrRenewalLimit, AppError{Status: http.StatusConflict, Code: "RENEWAL_LIMIT_REACHED", Title: "Renewal limit reached", Message: "This rental cannot be renewed again, please return the tape"}},
+	{ErrRenewalOverdue, AppError{Status: http.StatusConflict, Code: "RENEWAL_OVERDUE", Title: "Rental overdue", Message: "Overdue rentals cannot be renewed, please return the tape"}},
+	{ErrRenewalReserved, AppError{Status: http.StatusConflict, Code: "RENEWAL_RESERVED", Title: "Tape reserved", Message: "Another member is waiting for this tape, please return it"}},
+	// Reservations
+	{ErrReservationNotFound, AppError{Status: http.StatusNotFound, Code: "RESERVATION_NOT_FOUND", Title: "Reservation not found", Message: "Reservation not found"}},
+	{ErrReservationExists, AppError{Status: http.StatusConflict, Code: "RESERVATION_EXISTS", Title: "Reservation already exists", Message: "You already have a reservation for this tape"}},
+	{ErrTapeAvailable, AppError{Status: http.StatusConflict, Code: "TAPE_AVAILABLE", Title: "Tape available", Message: "A copy of this tape is available, rent it directly"}},
+	// Auth
+	{ErrInvalidHeader, AppError{Status: http.StatusUnauthorized, Code: "INVALID_AUTH_HEADER", Title: "Invalid authorization header", Message: "Missing or invalid authorization header"}},
+	{ErrInvalidToken, AppError{Status: http.StatusUnauthorized, Code: "INVALID_TOKEN", Title: "Invalid token", Message: "Invalid or expired token"}},
+	{ErrTokenReused, AppError{Status: http.StatusUnauthorized, Code: "REFRESH_TOKEN_REUSED", Title: "Refresh token reused", Message: "Refresh token already used, please log in again"}},
+	{ErrInvalidResetToken, AppError{Status: http.StatusBadRequest, Code: "INVALID_RESET_TOKEN", Title: "Invalid reset token", Message: "This password reset link is invalid, expired or already used, please request a new one"}},
+	{ErrInvalidIssuer, AppError{Status: http.StatusUnauthorized, Code: "INVALID_ISSUER", Title: "Invalid issuer", Message: "Invalid issuer"}},
+	{ErrInvalidUserID, AppError{Status: http.StatusUnauthorized, Code: "INVALID_USER_ID", Title: "Invalid user ID", Message: "Invalid user ID"}},
+	{ErrInvalidAdmin, AppError{Status: http.StatusForbidden, Code: "ADMIN_REQUIRED", Title: "Admin access required", Message: "Admin access required"}},
+	{ErrInvalidUser, AppError{Status: http.StatusForbidden, Code: "USER_REQUIRED", Title: "User access required", Message: "User/Admin access required"}},
+	{ErrAccountDisabled, AppError{Status: http.StatusForbidden, Code: "ACCOUNT_DISABLED", Title: "Account disabled", Message: "This account has been disabled"}},
+	// Throttling, sent with a Retry-After header
+	{ErrRateLimited, AppError{Status: http.StatusTooManyRequests, Code: "RATE_LIMITED", Title: "Too many requests", Message: "Too many requests, please try again later"}},
+	{ErrAccountLocked, AppError{Status: http.StatusTooManyRequests, Code: "ACCOUNT_LOCKED", Title: "Account locked", Message: "Too many failed logins, please try again later"}},
+}
@@ -0,0 +1,127 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Every exported Err variable of the package needs a registry entry, otherwise it is answered with a 500
+func Test_Registry_CoversEverySentinel(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	assert.Nil(t, err)
+
+	declared := map[string]bool{}
+	registered := map[string]bool{}
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		assert.Nil(t, err)
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			for _, name := range spec.Names {
+				if strings.HasPrefix(name.Name, "Err") {
+					declared[name.Name] = true
+				}
+			}
+			if len(spec.Names) == 1 && spec.Names[0].Name == "registry" {
+				for _, elt := range spec.Values[0].(*ast.CompositeLit).Elts {
+					entry := elt.(*ast.CompositeLit)
+					registered[entry.Elts[0].(*ast.Ident).Name] = true
+				}
+			}
+			return true
+		})
+	}
+
+	assert.NotEmpty(t, declared)
+	for name := range declared {
+		assert.True(t, registered[name], "%s has no registry entry", name)
+	}
+}
+
+func Test_Registry_CodesAreUnique(t *testing.T) {
+	seen := map[string]bool{CodeValidationFailed: true, CodeInternal: true}
+	for _, entry := range registry {
+		assert.False(t, seen[entry.appErr.Code], "code %s is used twice", entry.appErr.Code)
+		seen[entry.appErr.Code] = true
+		assert.NotEmpty(t, entry.appErr.Title, entry.appErr.Code)
+		assert.NotZero(t, entry.appErr.Status, entry.appErr.Code)
+	}
+}
+
+func Test_ErrorHandler_WritesProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.POST("/api/rentals/:id", func(c *gin.Context) {
+		_ = c.Error(fmt.Errorf("renting tape 7: %w", ErrTapeUnavailable))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/rentals/7", nil))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+
+	var problem Problem
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "/problems/tape-unavailable", problem.Type)
+	assert.Equal(t, "TAPE_UNAVAILABLE", problem.Code)
+	assert.Equal(t, "Tape unavailable", problem.Title)
+	assert.Equal(t, http.StatusUnprocessableEntity, problem.Status)
+	assert.Equal(t, "/api/rentals/7", problem.Instance)
+	assert.Contains(t, problem.Detail, "currently rented out")
+}
+
+func Test_ErrorHandler_UnknownErrorIsInternal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.GET("/api/tapes", func(c *gin.Context) {
+		_ = c.Error(errors.New("pq: connection refused"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tapes", nil))
+
+	var problem Problem
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusInternalServerError, problem.Status)
+	assert.Equal(t, CodeInternal, problem.Code)
+	assert.Equal(t, "Internal server error", problem.Detail)
+}
+
+func Test_ErrorHandler_SetsRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.POST("/api/users/login", func(c *gin.Context) {
+		_ = c.Error(WithRetryAfter(ErrRateLimited, 1500*time.Millisecond))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users/login", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/alexedwards/argon2id"
@@ -12,7 +16,8 @@ import (
 type TokenType string
 
 const (
-	TokenTypeAccess TokenType = "vhsclub-access"
+	TokenTypeAccess  TokenType = "vhsclub-access"
+	TokenTypeRefresh TokenType = "vhsclub-refresh"
 )
 
 func HashPassword(password string) (string, error) {
@@ -31,28 +36,90 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// Random URL safe token for password reset links. It is emailed as is and stored as HashResetToken.
+func MakeResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SHA-256 is enough for 256 random bits, unlike passwords they can't be guessed from a list
+func HashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 type Claims struct {
 	Role string `json:"role"`
 	jwt.RegisteredClaims
 }
 
 func MakeJWT(userID uuid.UUID, role string, tokenSecret string, expiresIn time.Duration) (string, error) {
-	signingKey := []byte(tokenSecret)
-
 	claims := Claims{
-		Role: role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    string(TokenTypeAccess),
-			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-			Subject:   userID.String(),
-		},
+		Role:             role,
+		RegisteredClaims: registeredClaims(TokenTypeAccess, userID, expiresIn),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(signingKey)
+	return signClaims(claims, tokenSecret)
+}
+
+// Refresh tokens carry no role, only the subject and a token ID (jti) that identifies
+// the stored refresh_tokens row, so they can be rotated and revoked server side.
+func MakeRefreshJWT(userID, tokenID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	registered := registeredClaims(TokenTypeRefresh, userID, expiresIn)
+	registered.ID = tokenID.String()
+	return signClaims(Claims{RegisteredClaims: registered}, tokenSecret)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, string, error) {
+	claims, err := parseClaims(tokenString, tokenSecret, TokenTypeAccess)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", apperror.ErrInvalidUserID
+	}
+	return id, claims.Role, nil
+}
+
+// Returns the user ID (subject) and token ID (jti) of a valid refresh token
+func ValidateRefreshJWT(tokenString, tokenSecret string) (uuid.UUID, uuid.UUID, error) {
+	claims, err := parseClaims(tokenString, tokenSecret, TokenTypeRefresh)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, apperror.ErrInvalidUserID
+	}
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, apperror.ErrInvalidToken
+	}
+	return userID, tokenID, nil
+}
+
+// Helpers
+func registeredClaims(tokenType TokenType, userID uuid.UUID, expiresIn time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    string(tokenType),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	}
+}
+
+func signClaims(claims Claims, tokenSecret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+// The issuer check keeps refresh tokens from being accepted as access tokens and vice versa
+func parseClaims(tokenString, tokenSecret string, tokenType TokenType) (*Claims, error) {
 	claims := Claims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
@@ -61,20 +128,15 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, string, error) {
 	)
 	if err != nil || !token.Valid {
 		// NOTE: maybe return a sentinel error here?
-		return uuid.Nil, "", err
+		return nil, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, "", err
+		return nil, err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, "", apperror.ErrInvalidIssuer
+	if issuer != string(tokenType) {
+		return nil, apperror.ErrInvalidIssuer
 	}
-
-	id, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, "", apperror.ErrInvalidUserID
-	}
-	return id, claims.Role, nil
+	return &claims, nil
 }
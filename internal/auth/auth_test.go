@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/auth"
 	"github.com/stretchr/testify/assert"
 )
@@ -31,6 +32,18 @@ func Test_CheckPasswordHash_WrongPassword(t *testing.T) {
 	assert.Equal(t, valid, false)
 }
 
+func Test_MakeResetToken(t *testing.T) {
+	token, err := auth.MakeResetToken()
+	assert.Nil(t, err)
+
+	other, _ := auth.MakeResetToken()
+	assert.NotEqual(t, token, other)
+
+	// Same token, same hash, so it can be looked up by the hash
+	assert.Equal(t, auth.HashResetToken(token), auth.HashResetToken(token))
+	assert.NotEqual(t, token, auth.HashResetToken(token))
+}
+
 func Test_ValidateJWT(t *testing.T) {
 	userID := uuid.New()
 	jwtTokenString, _ := auth.MakeJWT(userID, "admin", "secret", time.Hour)
@@ -50,3 +63,31 @@ func Test_ValidateJWT_InvalidRole(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func Test_ValidateRefreshJWT(t *testing.T) {
+	userID := uuid.New()
+	tokenID := uuid.New()
+	refreshTokenString, _ := auth.MakeRefreshJWT(userID, tokenID, "secret", time.Hour)
+
+	validatedUserID, validatedTokenID, err := auth.ValidateRefreshJWT(refreshTokenString, "secret")
+
+	assert.Nil(t, err)
+	assert.Equal(t, userID, validatedUserID)
+	assert.Equal(t, tokenID, validatedTokenID)
+}
+
+func Test_ValidateJWT_RejectsRefreshToken(t *testing.T) {
+	refreshTokenString, _ := auth.MakeRefreshJWT(uuid.New(), uuid.New(), "secret", time.Hour)
+
+	_, _, err := auth.ValidateJWT(refreshTokenString, "secret")
+
+	assert.ErrorIs(t, err, apperror.ErrInvalidIssuer)
+}
+
+func Test_ValidateRefreshJWT_RejectsAccessToken(t *testing.T) {
+	accessTokenString, _ := auth.MakeJWT(uuid.New(), "user", "secret", time.Hour)
+
+	_, _, err := auth.ValidateRefreshJWT(accessTokenString, "secret")
+
+	assert.ErrorIs(t, err, apperror.ErrInvalidIssuer)
+}
@@ -11,25 +11,72 @@ import (
 	"github.com/google/uuid"
 )
 
+type PasswordResetToken struct {
+	ID        int32
+	TokenHash string
+	UserID    int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	ID        int32
+	TokenID   uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
+
 type Rental struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+}
+
+type Reservation struct {
+	ID            int32
+	PublicID      uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        int32
+	TapeID        int32
+	Status        string
+	HoldExpiresAt sql.NullTime
+}
+
+type Tape struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+}
+
+type TapeCopy struct {
 	ID         int32
 	PublicID   uuid.UUID
 	CreatedAt  time.Time
-	UserID     int32
+	UpdatedAt  time.Time
 	TapeID     int32
-	RentedAt   time.Time
-	ReturnedAt sql.NullTime
-}
-
-type Tape struct {
-	ID        int32
-	PublicID  uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Title     string
-	Director  string
-	Genre     string
-	Quantity  int32
+	Barcode    string
+	Condition  string
+	Status     string
+	AcquiredAt time.Time
 }
 
 type User struct {
@@ -41,4 +88,14 @@ type User struct {
 	Email          string
 	Role           string
 	HashedPassword string
+	DisabledAt     sql.NullTime
+}
+
+type UserRoleChange struct {
+	ID        int32
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ChangedBy uuid.UUID
+	OldRole   string
+	NewRole   string
 }
@@ -15,38 +15,53 @@ import (
 
 const createRental = `-- name: CreateRental :one
 WITH new_rental AS (
-  INSERT INTO rentals (user_id, tape_id)
-  VALUES ($1, $2)
-  RETURNING id, public_id, created_at, user_id, tape_id, rented_at, returned_at
+  INSERT INTO rentals (user_id, tape_id, copy_id, due_at)
+  VALUES ($1, $2, $3, $4)
+  RETURNING id, public_id, created_at, user_id, tape_id, rented_at, returned_at, due_at, late_fee_cents, fee_paid_at, renewals, copy_id
 )
 SELECT
-  new_rental.id, new_rental.public_id, new_rental.created_at, new_rental.user_id, new_rental.tape_id, new_rental.rented_at, new_rental.returned_at,
+  new_rental.id, new_rental.public_id, new_rental.created_at, new_rental.user_id, new_rental.tape_id, new_rental.rented_at, new_rental.returned_at, new_rental.due_at, new_rental.late_fee_cents, new_rental.fee_paid_at, new_rental.renewals, new_rental.copy_id,
   tapes.title,
-  users.username
+  users.username,
+  tape_copies.barcode
 FROM new_rental
 JOIN tapes ON new_rental.tape_id = tapes.id
 JOIN users ON new_rental.user_id = users.id
+LEFT JOIN tape_copies ON new_rental.copy_id = tape_copies.id
 `
 
 type CreateRentalParams struct {
-	UserID int32
+	UserID sql.NullInt32
 	TapeID int32
+	CopyID sql.NullInt32
+	DueAt  time.Time
 }
 
 type CreateRentalRow struct {
-	ID         int32
-	PublicID   uuid.UUID
-	CreatedAt  time.Time
-	UserID     int32
-	TapeID     int32
-	RentedAt   time.Time
-	ReturnedAt sql.NullTime
-	Title      string
-	Username   string
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+	Title        string
+	Username     string
+	Barcode      sql.NullString
 }
 
 func (q *Queries) CreateRental(ctx context.Context, arg CreateRentalParams) (CreateRentalRow, error) {
-	row := q.db.QueryRowContext(ctx, createRental, arg.UserID, arg.TapeID)
+	row := q.db.QueryRowContext(ctx, createRental,
+		arg.UserID,
+		arg.TapeID,
+		arg.CopyID,
+		arg.DueAt,
+	)
 	var i CreateRentalRow
 	err := row.Scan(
 		&i.ID,
@@ -56,8 +71,14 @@ func (q *Queries) CreateRental(ctx context.Context, arg CreateRentalParams) (Cre
 		&i.TapeID,
 		&i.RentedAt,
 		&i.ReturnedAt,
+		&i.DueAt,
+		&i.LateFeeCents,
+		&i.FeePaidAt,
+		&i.Renewals,
+		&i.CopyID,
 		&i.Title,
 		&i.Username,
+		&i.Barcode,
 	)
 	return i, err
 }
@@ -72,13 +93,14 @@ func (q *Queries) DeleteAllRentals(ctx context.Context) error {
 }
 
 const getActiveRental = `-- name: GetActiveRental :one
-SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at FROM rentals
+SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at, due_at, late_fee_cents, fee_paid_at, renewals, copy_id FROM rentals
 WHERE public_id = $1 AND user_id = $2 AND returned_at IS NULL
+FOR UPDATE
 `
 
 type GetActiveRentalParams struct {
 	PublicID uuid.UUID
-	UserID   int32
+	UserID   sql.NullInt32
 }
 
 func (q *Queries) GetActiveRental(ctx context.Context, arg GetActiveRentalParams) (Rental, error) {
@@ -92,6 +114,11 @@ func (q *Queries) GetActiveRental(ctx context.Context, arg GetActiveRentalParams
 		&i.TapeID,
 		&i.RentedAt,
 		&i.ReturnedAt,
+		&i.DueAt,
+		&i.LateFeeCents,
+		&i.FeePaidAt,
+		&i.Renewals,
+		&i.CopyID,
 	)
 	return i, err
 }
@@ -113,7 +140,7 @@ SELECT COUNT(*) FROM rentals
 WHERE user_id = $1 AND returned_at IS NULL
 `
 
-func (q *Queries) GetActiveRentalCountByUser(ctx context.Context, userID int32) (int64, error) {
+func (q *Queries) GetActiveRentalCountByUser(ctx context.Context, userID sql.NullInt32) (int64, error) {
 	row := q.db.QueryRowContext(ctx, getActiveRentalCountByUser, userID)
 	var count int64
 	err := row.Scan(&count)
@@ -121,7 +148,7 @@ func (q *Queries) GetActiveRentalCountByUser(ctx context.Context, userID int32)
 }
 
 const getActiveRentalbyTape = `-- name: GetActiveRentalbyTape :many
-SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at FROM rentals
+SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at, due_at, late_fee_cents, fee_paid_at, renewals, copy_id FROM rentals
 WHERE tape_id = $1 AND returned_at IS NULL
 `
 
@@ -142,6 +169,11 @@ func (q *Queries) GetActiveRentalbyTape(ctx context.Context, tapeID int32) ([]Re
 			&i.TapeID,
 			&i.RentedAt,
 			&i.ReturnedAt,
+			&i.DueAt,
+			&i.LateFeeCents,
+			&i.FeePaidAt,
+			&i.Renewals,
+			&i.CopyID,
 		); err != nil {
 			return nil, err
 		}
@@ -157,12 +189,12 @@ func (q *Queries) GetActiveRentalbyTape(ctx context.Context, tapeID int32) ([]Re
 }
 
 const getActiveRentalsByUser = `-- name: GetActiveRentalsByUser :many
-SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at FROM rentals
+SELECT id, public_id, created_at, user_id, tape_id, rented_at, returned_at, due_at, late_fee_cents, fee_paid_at, renewals, copy_id FROM rentals
 WHERE user_id = $1 AND returned_at IS NULL
 `
 
 // NULL is not a value so only IS keyword works
-func (q *Queries) GetActiveRentalsByUser(ctx context.Context, userID int32) ([]Rental, error) {
+func (q *Queries) GetActiveRentalsByUser(ctx context.Context, userID sql.NullInt32) ([]Rental, error) {
 	rows, err := q.db.QueryContext(ctx, getActiveRentalsByUser, userID)
 	if err != nil {
 		return nil, err
@@ -179,6 +211,11 @@ func (q *Queries) GetActiveRentalsByUser(ctx context.Context, userID int32) ([]R
 			&i.TapeID,
 			&i.RentedAt,
 			&i.ReturnedAt,
+			&i.DueAt,
+			&i.LateFeeCents,
+			&i.FeePaidAt,
+			&i.Renewals,
+			&i.CopyID,
 		); err != nil {
 			return nil, err
 		}
@@ -195,26 +232,34 @@ func (q *Queries) GetActiveRentalsByUser(ctx context.Context, userID int32) ([]R
 
 const getAllActiveRentals = `-- name: GetAllActiveRentals :many
 SELECT
-  rentals.id, rentals.public_id, rentals.created_at, rentals.user_id, rentals.tape_id, rentals.rented_at, rentals.returned_at,
+  rentals.id, rentals.public_id, rentals.created_at, rentals.user_id, rentals.tape_id, rentals.rented_at, rentals.returned_at, rentals.due_at, rentals.late_fee_cents, rentals.fee_paid_at, rentals.renewals, rentals.copy_id,
   tapes.title,
-  users.username
+  users.username,
+  tape_copies.barcode
 FROM rentals
 JOIN tapes ON rentals.tape_id = tapes.id
 JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
 WHERE returned_at IS NULL
 ORDER BY rentals.created_at ASC
 `
 
 type GetAllActiveRentalsRow struct {
-	ID         int32
-	PublicID   uuid.UUID
-	CreatedAt  time.Time
-	UserID     int32
-	TapeID     int32
-	RentedAt   time.Time
-	ReturnedAt sql.NullTime
-	Title      string
-	Username   string
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+	Title        string
+	Username     string
+	Barcode      sql.NullString
 }
 
 func (q *Queries) GetAllActiveRentals(ctx context.Context) ([]GetAllActiveRentalsRow, error) {
@@ -234,8 +279,85 @@ func (q *Queries) GetAllActiveRentals(ctx context.Context) ([]GetAllActiveRental
 			&i.TapeID,
 			&i.RentedAt,
 			&i.ReturnedAt,
+			&i.DueAt,
+			&i.LateFeeCents,
+			&i.FeePaidAt,
+			&i.Renewals,
+			&i.CopyID,
+			&i.Title,
+			&i.Username,
+			&i.Barcode,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOverdueRentals = `-- name: GetOverdueRentals :many
+SELECT
+  rentals.id, rentals.public_id, rentals.created_at, rentals.user_id, rentals.tape_id, rentals.rented_at, rentals.returned_at, rentals.due_at, rentals.late_fee_cents, rentals.fee_paid_at, rentals.renewals, rentals.copy_id,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM rentals
+JOIN tapes ON rentals.tape_id = tapes.id
+JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
+WHERE rentals.returned_at IS NULL AND rentals.due_at < $1::timestamp
+ORDER BY rentals.due_at ASC
+`
+
+type GetOverdueRentalsRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+	Title        string
+	Username     string
+	Barcode      sql.NullString
+}
+
+func (q *Queries) GetOverdueRentals(ctx context.Context, now time.Time) ([]GetOverdueRentalsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOverdueRentals, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOverdueRentalsRow
+	for rows.Next() {
+		var i GetOverdueRentalsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.TapeID,
+			&i.RentedAt,
+			&i.ReturnedAt,
+			&i.DueAt,
+			&i.LateFeeCents,
+			&i.FeePaidAt,
+			&i.Renewals,
+			&i.CopyID,
 			&i.Title,
 			&i.Username,
+			&i.Barcode,
 		); err != nil {
 			return nil, err
 		}
@@ -250,13 +372,220 @@ func (q *Queries) GetAllActiveRentals(ctx context.Context) ([]GetAllActiveRental
 	return items, nil
 }
 
+const getRentalHistoryByUser = `-- name: GetRentalHistoryByUser :many
+SELECT
+  rentals.id, rentals.public_id, rentals.created_at, rentals.user_id, rentals.tape_id, rentals.rented_at, rentals.returned_at, rentals.due_at, rentals.late_fee_cents, rentals.fee_paid_at, rentals.renewals, rentals.copy_id,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM rentals
+JOIN tapes ON rentals.tape_id = tapes.id
+JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
+WHERE rentals.user_id = $1
+  AND ($2::int IS NULL OR rentals.tape_id = $2::int)
+  AND ($3::timestamp IS NULL OR rentals.rented_at >= $3::timestamp)
+  AND ($4::timestamp IS NULL OR rentals.rented_at < $4::timestamp)
+  AND (
+    $5::text IS NULL
+    OR ($5::text = 'active' AND rentals.returned_at IS NULL)
+    OR ($5::text = 'returned' AND rentals.returned_at IS NOT NULL)
+  )
+ORDER BY rentals.rented_at DESC
+`
+
+type GetRentalHistoryByUserParams struct {
+	UserID     sql.NullInt32
+	TapeID     sql.NullInt32
+	RentedFrom sql.NullTime
+	RentedTo   sql.NullTime
+	Status     sql.NullString
+}
+
+type GetRentalHistoryByUserRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+	Title        string
+	Username     string
+	Barcode      sql.NullString
+}
+
+// Active and returned rentals of a user, NULL filters are ignored
+func (q *Queries) GetRentalHistoryByUser(ctx context.Context, arg GetRentalHistoryByUserParams) ([]GetRentalHistoryByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRentalHistoryByUser,
+		arg.UserID,
+		arg.TapeID,
+		arg.RentedFrom,
+		arg.RentedTo,
+		arg.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRentalHistoryByUserRow
+	for rows.Next() {
+		var i GetRentalHistoryByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.TapeID,
+			&i.RentedAt,
+			&i.ReturnedAt,
+			&i.DueAt,
+			&i.LateFeeCents,
+			&i.FeePaidAt,
+			&i.Renewals,
+			&i.CopyID,
+			&i.Title,
+			&i.Username,
+			&i.Barcode,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserRentalStanding = `-- name: GetUserRentalStanding :one
+SELECT
+  COUNT(*) FILTER (WHERE returned_at IS NULL AND due_at < $1::timestamp) AS overdue_count,
+  COALESCE(SUM(late_fee_cents) FILTER (WHERE fee_paid_at IS NULL), 0)::bigint AS unpaid_fees_cents
+FROM rentals
+WHERE user_id = $2
+`
+
+type GetUserRentalStandingParams struct {
+	Now    time.Time
+	UserID sql.NullInt32
+}
+
+type GetUserRentalStandingRow struct {
+	OverdueCount    int64
+	UnpaidFeesCents int64
+}
+
+// Overdue tapes still out and late fees not paid yet, either one blocks new rentals
+func (q *Queries) GetUserRentalStanding(ctx context.Context, arg GetUserRentalStandingParams) (GetUserRentalStandingRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserRentalStanding, arg.Now, arg.UserID)
+	var i GetUserRentalStandingRow
+	err := row.Scan(&i.OverdueCount, &i.UnpaidFeesCents)
+	return i, err
+}
+
+const payRentalLateFee = `-- name: PayRentalLateFee :execrows
+UPDATE rentals
+SET fee_paid_at = NOW()
+WHERE public_id = $1 AND late_fee_cents > 0 AND fee_paid_at IS NULL
+`
+
+func (q *Queries) PayRentalLateFee(ctx context.Context, publicID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, payRentalLateFee, publicID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const renewRental = `-- name: RenewRental :one
+WITH renewed_rental AS (
+  UPDATE rentals
+  SET due_at = $1::timestamp, renewals = renewals + 1
+  WHERE id = $2 AND returned_at IS NULL
+  RETURNING id, public_id, created_at, user_id, tape_id, rented_at, returned_at, due_at, late_fee_cents, fee_paid_at, renewals, copy_id
+)
+SELECT
+  renewed_rental.id, renewed_rental.public_id, renewed_rental.created_at, renewed_rental.user_id, renewed_rental.tape_id, renewed_rental.rented_at, renewed_rental.returned_at, renewed_rental.due_at, renewed_rental.late_fee_cents, renewed_rental.fee_paid_at, renewed_rental.renewals, renewed_rental.copy_id,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM renewed_rental
+JOIN tapes ON renewed_rental.tape_id = tapes.id
+JOIN users ON renewed_rental.user_id = users.id
+LEFT JOIN tape_copies ON renewed_rental.copy_id = tape_copies.id
+`
+
+type RenewRentalParams struct {
+	DueAt time.Time
+	ID    int32
+}
+
+type RenewRentalRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UserID       sql.NullInt32
+	TapeID       int32
+	RentedAt     time.Time
+	ReturnedAt   sql.NullTime
+	DueAt        time.Time
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	Renewals     int32
+	CopyID       sql.NullInt32
+	Title        string
+	Username     string
+	Barcode      sql.NullString
+}
+
+// Pushes the due date of an active rental and counts the renewal
+func (q *Queries) RenewRental(ctx context.Context, arg RenewRentalParams) (RenewRentalRow, error) {
+	row := q.db.QueryRowContext(ctx, renewRental, arg.DueAt, arg.ID)
+	var i RenewRentalRow
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.TapeID,
+		&i.RentedAt,
+		&i.ReturnedAt,
+		&i.DueAt,
+		&i.LateFeeCents,
+		&i.FeePaidAt,
+		&i.Renewals,
+		&i.CopyID,
+		&i.Title,
+		&i.Username,
+		&i.Barcode,
+	)
+	return i, err
+}
+
 const returnTape = `-- name: ReturnTape :exec
 UPDATE rentals
-SET returned_at = NOW()
-WHERE id = $1
+SET
+  returned_at = $1::timestamp,
+  late_fee_cents = $2
+WHERE id = $3
 `
 
-func (q *Queries) ReturnTape(ctx context.Context, id int32) error {
-	_, err := q.db.ExecContext(ctx, returnTape, id)
+type ReturnTapeParams struct {
+	ReturnedAt   time.Time
+	LateFeeCents int32
+	ID           int32
+}
+
+func (q *Queries) ReturnTape(ctx context.Context, arg ReturnTapeParams) error {
+	_, err := q.db.ExecContext(ctx, returnTape, arg.ReturnedAt, arg.LateFeeCents, arg.ID)
 	return err
 }
@@ -8,19 +8,60 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countTapes = `-- name: CountTapes :one
+SELECT COUNT(*) FROM tapes
+WHERE ($1::text IS NULL OR LOWER(genre) = LOWER($1::text))
+  AND ($2::text IS NULL OR LOWER(director) = LOWER($2::text))
+  AND (
+    NOT $3::bool
+    OR (
+      SELECT COUNT(*) FROM tape_copies
+      WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'available'
+    ) > (
+      SELECT COUNT(*) FROM reservations
+      WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+    )
+  )
+`
+
+type CountTapesParams struct {
+	Genre         sql.NullString
+	Director      sql.NullString
+	AvailableOnly bool
+}
+
+func (q *Queries) CountTapes(ctx context.Context, arg CountTapesParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTapes, arg.Genre, arg.Director, arg.AvailableOnly)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createTape = `-- name: CreateTape :one
-INSERT INTO tapes (title, director, genre, quantity)
-VALUES (
-  $1,
-  $2,
-  $3,
-  $4
+WITH new_tape AS (
+  INSERT INTO tapes (title, director, genre)
+  VALUES (
+    $1,
+    $2,
+    $3
+  )
+  RETURNING id, public_id, created_at, updated_at, title, director, genre, search_vector
+),
+new_copies AS (
+  INSERT INTO tape_copies (tape_id, barcode)
+  SELECT new_tape.id, 'VHS-' || new_tape.id || '-' || n
+  FROM new_tape, generate_series(1, $4::int) AS n
+  RETURNING id
 )
-RETURNING id, public_id, created_at, updated_at, title, director, genre, quantity
+SELECT
+  new_tape.id, new_tape.public_id, new_tape.created_at, new_tape.updated_at, new_tape.title, new_tape.director, new_tape.genre, new_tape.search_vector,
+  (SELECT COUNT(*) FROM new_copies)::int AS quantity
+FROM new_tape
 `
 
 type CreateTapeParams struct {
@@ -30,14 +71,27 @@ type CreateTapeParams struct {
 	Quantity int32
 }
 
-func (q *Queries) CreateTape(ctx context.Context, arg CreateTapeParams) (Tape, error) {
+type CreateTapeRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+}
+
+// The tape and its first copies are inserted in one statement
+func (q *Queries) CreateTape(ctx context.Context, arg CreateTapeParams) (CreateTapeRow, error) {
 	row := q.db.QueryRowContext(ctx, createTape,
 		arg.Title,
 		arg.Director,
 		arg.Genre,
 		arg.Quantity,
 	)
-	var i Tape
+	var i CreateTapeRow
 	err := row.Scan(
 		&i.ID,
 		&i.PublicID,
@@ -46,6 +100,7 @@ func (q *Queries) CreateTape(ctx context.Context, arg CreateTapeParams) (Tape, e
 		&i.Title,
 		&i.Director,
 		&i.Genre,
+		&i.SearchVector,
 		&i.Quantity,
 	)
 	return i, err
@@ -71,13 +126,41 @@ func (q *Queries) DeleteTape(ctx context.Context, id int32) error {
 }
 
 const getTapeByID = `-- name: GetTapeByID :one
-SELECT id, public_id, created_at, updated_at, title, director, genre, quantity FROM tapes
+SELECT
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 WHERE id = $1
 `
 
-func (q *Queries) GetTapeByID(ctx context.Context, id int32) (Tape, error) {
+type GetTapeByIDRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+func (q *Queries) GetTapeByID(ctx context.Context, id int32) (GetTapeByIDRow, error) {
 	row := q.db.QueryRowContext(ctx, getTapeByID, id)
-	var i Tape
+	var i GetTapeByIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.PublicID,
@@ -86,19 +169,73 @@ func (q *Queries) GetTapeByID(ctx context.Context, id int32) (Tape, error) {
 		&i.Title,
 		&i.Director,
 		&i.Genre,
+		&i.SearchVector,
 		&i.Quantity,
+		&i.RentedOut,
+		&i.OnHold,
+	)
+	return i, err
+}
+
+const getTapeByIDForUpdate = `-- name: GetTapeByIDForUpdate :one
+SELECT id, public_id, created_at, updated_at, title, director, genre, search_vector FROM tapes
+WHERE id = $1
+FOR UPDATE
+`
+
+// Row lock held until the surrounding transaction ends
+func (q *Queries) GetTapeByIDForUpdate(ctx context.Context, id int32) (Tape, error) {
+	row := q.db.QueryRowContext(ctx, getTapeByIDForUpdate, id)
+	var i Tape
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Director,
+		&i.Genre,
+		&i.SearchVector,
 	)
 	return i, err
 }
 
 const getTapeFromPublicID = `-- name: GetTapeFromPublicID :one
-SELECT id, public_id, created_at, updated_at, title, director, genre, quantity FROM tapes
+SELECT
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 WHERE public_id = $1
 `
 
-func (q *Queries) GetTapeFromPublicID(ctx context.Context, publicID uuid.UUID) (Tape, error) {
+type GetTapeFromPublicIDRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+func (q *Queries) GetTapeFromPublicID(ctx context.Context, publicID uuid.UUID) (GetTapeFromPublicIDRow, error) {
 	row := q.db.QueryRowContext(ctx, getTapeFromPublicID, publicID)
-	var i Tape
+	var i GetTapeFromPublicIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.PublicID,
@@ -107,25 +244,273 @@ func (q *Queries) GetTapeFromPublicID(ctx context.Context, publicID uuid.UUID) (
 		&i.Title,
 		&i.Director,
 		&i.Genre,
+		&i.SearchVector,
 		&i.Quantity,
+		&i.RentedOut,
+		&i.OnHold,
+	)
+	return i, err
+}
+
+const getTapeFromPublicIDForUpdate = `-- name: GetTapeFromPublicIDForUpdate :one
+SELECT id, public_id, created_at, updated_at, title, director, genre, search_vector FROM tapes
+WHERE public_id = $1
+FOR UPDATE
+`
+
+// Row lock held until the surrounding transaction ends
+func (q *Queries) GetTapeFromPublicIDForUpdate(ctx context.Context, publicID uuid.UUID) (Tape, error) {
+	row := q.db.QueryRowContext(ctx, getTapeFromPublicIDForUpdate, publicID)
+	var i Tape
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Director,
+		&i.Genre,
+		&i.SearchVector,
 	)
 	return i, err
 }
 
 const getTapes = `-- name: GetTapes :many
-SELECT id, public_id, created_at, updated_at, title, director, genre, quantity FROM tapes
+SELECT
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetTapes(ctx context.Context) ([]Tape, error) {
+type GetTapesRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+// quantity counts the copies in circulation, rented_out and on_hold the ones RentTape cannot hand out
+func (q *Queries) GetTapes(ctx context.Context) ([]GetTapesRow, error) {
 	rows, err := q.db.QueryContext(ctx, getTapes)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Tape
+	var items []GetTapesRow
+	for rows.Next() {
+		var i GetTapesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Director,
+			&i.Genre,
+			&i.SearchVector,
+			&i.Quantity,
+			&i.RentedOut,
+			&i.OnHold,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTapes = `-- name: ListTapes :many
+SELECT
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
+WHERE ($1::text IS NULL OR LOWER(genre) = LOWER($1::text))
+  AND ($2::text IS NULL OR LOWER(director) = LOWER($2::text))
+  AND (
+    NOT $3::bool
+    OR (
+      SELECT COUNT(*) FROM tape_copies
+      WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'available'
+    ) > (
+      SELECT COUNT(*) FROM reservations
+      WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+    )
+  )
+  AND (
+    $4::uuid IS NULL
+    OR ($5::text = 'created_at' AND (created_at, public_id) > ($6::timestamp, $4::uuid))
+    OR ($5::text = '-created_at' AND (created_at, public_id) < ($6::timestamp, $4::uuid))
+    OR ($5::text = 'title' AND (title, public_id) > ($7::text, $4::uuid))
+    OR ($5::text = '-title' AND (title, public_id) < ($7::text, $4::uuid))
+  )
+ORDER BY
+  CASE WHEN $5::text = 'created_at' THEN created_at END ASC,
+  CASE WHEN $5::text = '-created_at' THEN created_at END DESC,
+  CASE WHEN $5::text = 'title' THEN title END ASC,
+  CASE WHEN $5::text = '-title' THEN title END DESC,
+  CASE WHEN $5::text LIKE '-%' THEN public_id END DESC,
+  public_id ASC
+LIMIT $8
+`
+
+type ListTapesParams struct {
+	Genre           sql.NullString
+	Director        sql.NullString
+	AvailableOnly   bool
+	CursorPublicID  uuid.NullUUID
+	Sort            string
+	CursorCreatedAt sql.NullTime
+	CursorTitle     sql.NullString
+	PageLimit       int32
+}
+
+type ListTapesRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+// Keyset pagination, the cursor columns follow the sort order and public_id breaks ties
+func (q *Queries) ListTapes(ctx context.Context, arg ListTapesParams) ([]ListTapesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listTapes,
+		arg.Genre,
+		arg.Director,
+		arg.AvailableOnly,
+		arg.CursorPublicID,
+		arg.Sort,
+		arg.CursorCreatedAt,
+		arg.CursorTitle,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTapesRow
+	for rows.Next() {
+		var i ListTapesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Director,
+			&i.Genre,
+			&i.SearchVector,
+			&i.Quantity,
+			&i.RentedOut,
+			&i.OnHold,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchTapes = `-- name: SearchTapes :many
+SELECT
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  ts_rank(tapes.search_vector, to_tsquery('simple', $1::text))::real AS rank,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
+WHERE tapes.search_vector @@ to_tsquery('simple', $1::text)
+ORDER BY rank DESC, tapes.title ASC
+LIMIT $2
+`
+
+type SearchTapesParams struct {
+	Query     string
+	PageLimit int32
+}
+
+type SearchTapesRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Rank         float32
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+// Ranked full text search, title matches weigh more than director and genre ones
+func (q *Queries) SearchTapes(ctx context.Context, arg SearchTapesParams) ([]SearchTapesRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchTapes, arg.Query, arg.PageLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchTapesRow
 	for rows.Next() {
-		var i Tape
+		var i SearchTapesRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.PublicID,
@@ -134,7 +519,11 @@ func (q *Queries) GetTapes(ctx context.Context) ([]Tape, error) {
 			&i.Title,
 			&i.Director,
 			&i.Genre,
+			&i.SearchVector,
+			&i.Rank,
 			&i.Quantity,
+			&i.RentedOut,
+			&i.OnHold,
 		); err != nil {
 			return nil, err
 		}
@@ -155,10 +544,22 @@ SET
   updated_at =  NOW(),
   title =       COALESCE($2, title),
   director =    COALESCE($3, director),
-  genre =       COALESCE($4, genre),
-  quantity =    COALESCE($5, quantity)
+  genre =       COALESCE($4, genre)
 WHERE id = $1
-RETURNING id, public_id, created_at, updated_at, title, director, genre, quantity
+RETURNING
+  tapes.id, tapes.public_id, tapes.created_at, tapes.updated_at, tapes.title, tapes.director, tapes.genre, tapes.search_vector,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
 `
 
 type UpdateTapeParams struct {
@@ -166,18 +567,30 @@ type UpdateTapeParams struct {
 	Title    sql.NullString
 	Director sql.NullString
 	Genre    sql.NullString
-	Quantity sql.NullInt32
 }
 
-func (q *Queries) UpdateTape(ctx context.Context, arg UpdateTapeParams) (Tape, error) {
+type UpdateTapeRow struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Title        string
+	Director     string
+	Genre        string
+	SearchVector interface{}
+	Quantity     int32
+	RentedOut    int32
+	OnHold       int32
+}
+
+func (q *Queries) UpdateTape(ctx context.Context, arg UpdateTapeParams) (UpdateTapeRow, error) {
 	row := q.db.QueryRowContext(ctx, updateTape,
 		arg.ID,
 		arg.Title,
 		arg.Director,
 		arg.Genre,
-		arg.Quantity,
 	)
-	var i Tape
+	var i UpdateTapeRow
 	err := row.Scan(
 		&i.ID,
 		&i.PublicID,
@@ -186,7 +599,10 @@ func (q *Queries) UpdateTape(ctx context.Context, arg UpdateTapeParams) (Tape, e
 		&i.Title,
 		&i.Director,
 		&i.Genre,
+		&i.SearchVector,
 		&i.Quantity,
+		&i.RentedOut,
+		&i.OnHold,
 	)
 	return i, err
 }
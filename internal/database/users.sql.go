@@ -7,28 +7,36 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users(username, email, hashed_password)
+INSERT INTO users(username, email, role, hashed_password, disabled_at)
 VALUES (
   $1,
   $2,
-  $3
+  $3,
+  $4
 )
-RETURNING id, public_id, created_at, updated_at, username, email, role, hashed_password
+RETURNING id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at
 `
 
 type CreateUserParams struct {
 	Username       string
 	Email          string
+	Role           string
 	HashedPassword string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Username, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.Username,
+		arg.Email,
+		arg.Role,
+		arg.HashedPassword,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -39,6 +47,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.Role,
 		&i.HashedPassword,
+		&i.DisabledAt,
 	)
 	return i, err
 }
@@ -52,8 +61,65 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const disableUser = `-- name: DisableUser :one
+UPDATE users
+SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at
+`
+
+// Disabling twice keeps the first timestamp
+func (q *Queries) DisableUser(ctx context.Context, id int32) (User, error) {
+	row := q.db.QueryRowContext(ctx, disableUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.HashedPassword,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
+WHERE email = $1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.HashedPassword,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password FROM users
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
 WHERE id = $1
 `
 
@@ -69,12 +135,13 @@ func (q *Queries) GetUserByID(ctx context.Context, id int32) (User, error) {
 		&i.Email,
 		&i.Role,
 		&i.HashedPassword,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getUserByPublicID = `-- name: GetUserByPublicID :one
-SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password FROM users
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
 WHERE public_id = $1
 `
 
@@ -90,12 +157,37 @@ func (q *Queries) GetUserByPublicID(ctx context.Context, publicID uuid.UUID) (Us
 		&i.Email,
 		&i.Role,
 		&i.HashedPassword,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getUserByPublicIDForUpdate = `-- name: GetUserByPublicIDForUpdate :one
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
+WHERE public_id = $1
+FOR UPDATE
+`
+
+// Row lock held until the surrounding transaction ends
+func (q *Queries) GetUserByPublicIDForUpdate(ctx context.Context, publicID uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByPublicIDForUpdate, publicID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.HashedPassword,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const getUserByUsername = `-- name: GetUserByUsername :one
-SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password FROM users
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
 WHERE username = $1
 `
 
@@ -111,12 +203,31 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User,
 		&i.Email,
 		&i.Role,
 		&i.HashedPassword,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
+const getUserStatus = `-- name: GetUserStatus :one
+SELECT role, disabled_at FROM users
+WHERE public_id = $1
+`
+
+type GetUserStatusRow struct {
+	Role       string
+	DisabledAt sql.NullTime
+}
+
+// Checked on every authenticated request
+func (q *Queries) GetUserStatus(ctx context.Context, publicID uuid.UUID) (GetUserStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserStatus, publicID)
+	var i GetUserStatusRow
+	err := row.Scan(&i.Role, &i.DisabledAt)
+	return i, err
+}
+
 const getUsers = `-- name: GetUsers :many
-SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password FROM users
+SELECT id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at FROM users
 ORDER BY created_at ASC
 `
 
@@ -138,6 +249,7 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 			&i.Email,
 			&i.Role,
 			&i.HashedPassword,
+			&i.DisabledAt,
 		); err != nil {
 			return nil, err
 		}
@@ -151,3 +263,79 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 	}
 	return items, nil
 }
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET
+  updated_at = NOW(),
+  email =      COALESCE($2, email)
+WHERE id = $1
+RETURNING id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at
+`
+
+type UpdateUserParams struct {
+	ID    int32
+	Email sql.NullString
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.HashedPassword,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             int32
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, public_id, created_at, updated_at, username, email, role, hashed_password, disabled_at
+`
+
+type UpdateUserRoleParams struct {
+	Role string
+	ID   int32
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.PublicID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Username,
+		&i.Email,
+		&i.Role,
+		&i.HashedPassword,
+		&i.DisabledAt,
+	)
+	return i, err
+}
@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+)
+
+// FileMailer appends every message to a file instead of sending it, so links in them can be
+// followed during local development
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{
+		path: path,
+		from: from,
+	}
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	body, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening mail file: %w", err)
+	}
+	defer f.Close()
+
+	// Blank line and separator between messages, like an mbox
+	if _, err := fmt.Fprintf(f, "\r\n-----\r\n%s\r\n", body); err != nil {
+		return fmt.Errorf("error writing mail file: %w", err)
+	}
+	return nil
+}
+
+// LogMailer writes every message to the request log instead of sending it. Bodies may carry
+// secrets such as reset links, so it is meant for local development only.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{
+		from: from,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if _, err := format(m.from, msg, time.Now()); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("mail not sent, logged instead",
+		"from", m.from,
+		"to", msg.To,
+		"subject", msg.Subject,
+		"body", msg.Body,
+	)
+	return nil
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Values accepted for MAIL_DRIVER
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// Plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. SMTPMailer sends them, FileMailer and LogMailer only record them
+// for local development and tests.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Options struct {
+	Driver string
+	// Sender address, e.g. "VHS Club <no-reply@vhsclub.example>"
+	From string
+	// File FileMailer appends to
+	File string
+	SMTP SMTPOptions
+}
+
+func New(opts Options) (Mailer, error) {
+	switch opts.Driver {
+	case DriverLog:
+		return NewLogMailer(opts.From), nil
+	case DriverFile:
+		return NewFileMailer(opts.File, opts.From), nil
+	case DriverSMTP:
+		return NewSMTPMailer(opts.SMTP, opts.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", opts.Driver)
+	}
+}
+
+// Renders msg as an RFC 5322 message. Header values with line breaks are refused, they could
+// smuggle in headers of their own.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("mail header contains a line break: %q", value)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileMailer_AppendsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := NewFileMailer(path, "VHS Club <no-reply@vhsclub.test>")
+	ctx := context.Background()
+
+	assert.Nil(t, mailer.Send(ctx, Message{To: "ada@engines.org", Subject: "First", Body: "Line one\nLine two"}))
+	assert.Nil(t, mailer.Send(ctx, Message{To: "grace@cobol.org", Subject: "Second", Body: "Hello"}))
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	content := string(data)
+	assert.Contains(t, content, "From: VHS Club <no-reply@vhsclub.test>\r\n")
+	assert.Contains(t, content, "To: ada@engines.org\r\n")
+	assert.Contains(t, content, "Line one\r\nLine two")
+	assert.Contains(t, content, "Subject: Second\r\n")
+	assert.Equal(t, 2, strings.Count(content, "-----"))
+}
+
+func Test_Send_RefusesHeaderInjection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := NewFileMailer(path, "no-reply@vhsclub.test")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "ada@engines.org\r\nBcc: everyone@example.com",
+		Subject: "Reset",
+		Body:    "Hello",
+	})
+
+	assert.Error(t, err)
+	_, statErr := os.Stat(path)
+	assert.True(t, os.IsNotExist(statErr))
+}
+
+func Test_New_UnknownDriver(t *testing.T) {
+	mailer, err := New(Options{Driver: "pigeon"})
+
+	assert.Nil(t, mailer)
+	assert.Error(t, err)
+}
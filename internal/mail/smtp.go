@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPOptions struct {
+	Host string
+	Port int
+	// Both empty for relays that don't authenticate
+	Username string
+	Password string
+}
+
+// SMTPMailer hands messages to an SMTP server. net/smtp upgrades the connection with STARTTLS
+// when the server offers it, and refuses to send credentials over a plain connection except to localhost.
+type SMTPMailer struct {
+	opts SMTPOptions
+	from string
+}
+
+func NewSMTPMailer(opts SMTPOptions, from string) *SMTPMailer {
+	return &SMTPMailer{
+		opts: opts,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	body, err := format(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	// The envelope takes bare addresses, the headers keep the display names
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+
+	// smtp.SendMail takes no context, the send is abandoned when ctx ends first
+	addr := net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port))
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, from.Address, []string{to.Address}, body)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("error sending mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vhs_club"
+
+// Reasons a rental request is turned down, used as the reason label of rentals_rejected_total
+const (
+	ReasonTapeUnavailable   = "tape_unavailable"
+	ReasonMaxRentalsPerUser = "max_rentals_per_user"
+)
+
+// Metrics owns its own registry, so tests and the CLI never share collectors with the server
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	rentalsCreated  prometheus.Counter
+	rentalsReturned prometheus.Counter
+	rentalsRejected *prometheus.CounterVec
+}
+
+// Registers the HTTP and rental collectors along with the Go runtime, process and db pool ones
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent handling HTTP requests, by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		rentalsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rentals_created_total",
+			Help:      "Tapes rented out.",
+		}),
+		rentalsReturned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rentals_returned_total",
+			Help:      "Rented tapes brought back.",
+		}),
+		rentalsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rentals_rejected_total",
+			Help:      "Rental requests turned down, by reason.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, namespace),
+		m.httpRequests,
+		m.httpDuration,
+		m.rentalsCreated,
+		m.rentalsReturned,
+		m.rentalsRejected,
+	)
+	return m
+}
+
+// Serves the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// route is the gin route template such as /api/tapes/:id, never the raw path, to keep the label set small
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func (m *Metrics) RentalCreated() {
+	m.rentalsCreated.Inc()
+}
+
+func (m *Metrics) RentalReturned() {
+	m.rentalsReturned.Inc()
+}
+
+func (m *Metrics) RentalRejected(reason string) {
+	m.rentalsRejected.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,338 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Arbitrary key for pg_advisory_lock, every instance migrating the same database
+// has to agree on it so only one of them applies migrations at a time
+const lockKey int64 = 7_011_986
+
+const (
+	upMarker   = "-- +goose Up"
+	downMarker = "-- +goose Down"
+)
+
+// Migration is one sql/schema file, split on its goose annotations
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Reads every .sql file at the root of fsys, files are named <version>_<name>.sql
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	seen := make(map[int64]string, len(files))
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migration, err := parseMigration(file, string(content))
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[migration.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, migration.Version)
+		}
+		seen[migration.Version] = file
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func parseMigration(file, content string) (Migration, error) {
+	base := strings.TrimSuffix(path.Base(file), ".sql")
+	prefix, name, ok := strings.Cut(base, "_")
+	if !ok {
+		return Migration{}, fmt.Errorf("migration %s: file name must look like 001_name.sql", file)
+	}
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil || version <= 0 {
+		return Migration{}, fmt.Errorf("migration %s: %q is not a valid version", file, prefix)
+	}
+
+	upStart := strings.Index(content, upMarker)
+	if upStart < 0 {
+		return Migration{}, fmt.Errorf("migration %s: missing %q", file, upMarker)
+	}
+	up := content[upStart+len(upMarker):]
+	down := ""
+	if downStart := strings.Index(up, downMarker); downStart >= 0 {
+		down = up[downStart+len(downMarker):]
+		up = up[:downStart]
+	}
+
+	up = strings.TrimSpace(up)
+	if up == "" {
+		return Migration{}, fmt.Errorf("migration %s: empty up section", file)
+	}
+
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up:      up,
+		Down:    strings.TrimSpace(down),
+	}, nil
+}
+
+// Applies every pending migration in version order, each one in its own transaction.
+// Returns the migrations that were applied, stopping at the first failure.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := current[migration.Version]; ok {
+				continue
+			}
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_version (version, name) VALUES ($1, $2)",
+					migration.Version, migration.Name,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Rolls back the most recently applied migration. Returns nil when nothing is applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var version int64
+		err := conn.QueryRowContext(ctx, "SELECT version FROM schema_version ORDER BY version DESC LIMIT 1").Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		migration, ok := m.find(version)
+		if !ok {
+			return fmt.Errorf("migration %d is applied but not known to this binary", version)
+		}
+		if migration.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down section", migration.Version, migration.Name)
+		}
+
+		err = inTx(ctx, conn, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_version WHERE version = $1", migration.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		reverted = &migration
+		return nil
+	})
+	return reverted, err
+}
+
+// Records every migration up to version as applied without running it, for a database whose
+// schema was created before migrations were tracked. Refuses once any version is recorded.
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]Migration, error) {
+	if _, ok := m.find(version); !ok {
+		return nil, fmt.Errorf("migration %d is not known to this binary", version)
+	}
+
+	var recorded []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(current) > 0 {
+			return errors.New("schema_version already records applied migrations, only an untracked database can be baselined")
+		}
+
+		return inTx(ctx, conn, func(tx *sql.Tx) error {
+			for _, migration := range m.migrations {
+				if migration.Version > version {
+					break
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_version (version, name) VALUES ($1, $2)",
+					migration.Version, migration.Name,
+				)
+				if err != nil {
+					return err
+				}
+				recorded = append(recorded, migration)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// Lists every known migration with the time it was applied, pending ones have AppliedAt unset
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		statuses = make([]Status, 0, len(m.migrations))
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := current[migration.Version]; ok {
+				status.AppliedAt = sql.NullTime{Time: appliedAt, Valid: true}
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Known migrations in version order
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Highest version known to this binary, 0 when there are no migrations
+func (m *Migrator) LatestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Highest version applied to the database, 0 when none is. Unlike Status it doesn't wait
+// for the migration lock, so it can be polled while another instance is migrating.
+func (m *Migrator) CurrentVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Advisory locks belong to a session, so the lock and every migration share one connection
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer func() {
+		// Closing the connection would drop the lock as well, this just releases it sooner
+		_, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		if err == nil && unlockErr != nil {
+			err = fmt.Errorf("releasing migration lock: %w", unlockErr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+  version     BIGINT PRIMARY KEY,
+  name        TEXT NOT NULL,
+  applied_at  TIMESTAMP NOT NULL DEFAULT NOW()
+)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_version table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,91 @@
+package migrate_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New_SortsAndSplitsMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_users.sql": {Data: []byte("-- +goose Up\nCREATE TABLE users(id INT);\n\n-- +goose Down\nDROP TABLE users;\n")},
+		"001_tapes.sql": {Data: []byte("-- +goose Up\nCREATE TABLE tapes(id INT);\n\n-- +goose Down\nDROP TABLE tapes;\n")},
+		"README.md":     {Data: []byte("not a migration")},
+	}
+
+	migrator, err := migrate.New(nil, fsys)
+
+	assert.Nil(t, err)
+	migrations := migrator.Migrations()
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "tapes", migrations[0].Name)
+	assert.Equal(t, "CREATE TABLE tapes(id INT);", migrations[0].Up)
+	assert.Equal(t, "DROP TABLE tapes;", migrations[0].Down)
+	assert.Equal(t, int64(2), migrations[1].Version)
+	assert.Equal(t, int64(2), migrator.LatestVersion())
+}
+
+func Test_New_Fail_DuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"003_rentals.sql":      {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		"003_rental_dates.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+	}
+
+	migrator, err := migrate.New(nil, fsys)
+
+	assert.Nil(t, migrator)
+	assert.ErrorContains(t, err, "share version 3")
+}
+
+func Test_New_Fail_MissingUpSection(t *testing.T) {
+	fsys := fstest.MapFS{
+		"004_refresh_tokens.sql": {Data: []byte("CREATE TABLE refresh_tokens(id INT);\n")},
+	}
+
+	migrator, err := migrate.New(nil, fsys)
+
+	assert.Nil(t, migrator)
+	assert.ErrorContains(t, err, "missing")
+}
+
+func Test_New_Fail_BadFileName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tapes.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+	}
+
+	migrator, err := migrate.New(nil, fsys)
+
+	assert.Nil(t, migrator)
+	assert.Error(t, err)
+}
+
+// The version is checked before the database is touched
+func Test_Baseline_Fail_UnknownVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_tapes.sql": {Data: []byte("-- +goose Up\nCREATE TABLE tapes(id INT);\n")},
+	}
+	migrator, err := migrate.New(nil, fsys)
+	assert.Nil(t, err)
+
+	recorded, err := migrator.Baseline(context.Background(), 3)
+
+	assert.Nil(t, recorded)
+	assert.ErrorContains(t, err, "migration 3 is not known")
+}
+
+// Every shipped schema file has to parse and be reversible
+func Test_New_SchemaFiles(t *testing.T) {
+	migrator, err := migrate.New(nil, os.DirFS("../../sql/schema"))
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, migrator.Migrations())
+	for i, migration := range migrator.Migrations() {
+		assert.Equal(t, int64(i+1), migration.Version)
+		assert.NotEmpty(t, migration.Down, migration.Name)
+	}
+}
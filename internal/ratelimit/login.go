@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+)
+
+// LoginGuard throttles login attempts per username and locks an account after repeated
+// wrong passwords, so the password hash is not checked for attempts that are refused anyway
+type LoginGuard struct {
+	limits   Store
+	lockouts LockoutStore
+	rate     Rate
+	policy   LockoutPolicy
+}
+
+func NewLoginGuard(limits Store, lockouts LockoutStore, rate Rate, policy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{
+		limits:   limits,
+		lockouts: lockouts,
+		rate:     rate,
+		policy:   policy,
+	}
+}
+
+// Refuses the attempt with ErrAccountLocked or ErrRateLimited, both carrying a Retry-After
+func (g *LoginGuard) Check(ctx context.Context, username string) error {
+	locked, err := g.lockouts.LockedFor(ctx, lockoutKey(username))
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return apperror.WithRetryAfter(apperror.ErrAccountLocked, locked)
+	}
+
+	decision, err := g.limits.Take(ctx, "login:user:"+username, g.rate)
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		return apperror.WithRetryAfter(apperror.ErrRateLimited, decision.RetryAfter)
+	}
+	return nil
+}
+
+// Counts a wrong password towards the lockout
+func (g *LoginGuard) Failed(ctx context.Context, username string) error {
+	_, err := g.lockouts.Fail(ctx, lockoutKey(username), g.policy)
+	return err
+}
+
+// Clears the failures of the account
+func (g *LoginGuard) Succeeded(ctx context.Context, username string) error {
+	return g.lockouts.Reset(ctx, lockoutKey(username))
+}
+
+func lockoutKey(username string) string {
+	return "login:lockout:" + username
+}
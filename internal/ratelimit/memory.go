@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Entries that can no longer affect a decision are dropped this often
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets and failure counts in process, they are lost on restart
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  map[string]*failureCount
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+type failureCount struct {
+	count       int
+	lockedUntil time.Time
+	// The count is forgotten once no failure happened for the policy's Max
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failureCount),
+		now:      time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, rate Rate) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok || b.rate != rate {
+		b = &bucket{rate: rate, tokens: float64(rate.Limit), last: now}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	decision := Decision{Limit: rate.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = b.timeFor(1 - b.tokens)
+	}
+	decision.Remaining = int(math.Floor(b.tokens))
+	decision.ResetAfter = b.timeFor(float64(rate.Limit) - b.tokens)
+	return decision, nil
+}
+
+func (s *MemoryStore) LockedFor(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(f.lockedUntil.Sub(s.now()), 0), nil
+}
+
+func (s *MemoryStore) Fail(_ context.Context, key string, policy LockoutPolicy) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	f, ok := s.failures[key]
+	if !ok || now.After(f.expiresAt) {
+		f = &failureCount{}
+		s.failures[key] = f
+	}
+	f.count++
+	lock := policy.lockFor(f.count)
+	f.lockedUntil = now.Add(lock)
+	f.expiresAt = f.lockedUntil.Add(policy.Max)
+	return lock, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// Drops full buckets and expired failure counts, a missing entry behaves the same.
+// Must be called with the lock held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rate.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.After(f.expiresAt) {
+			delete(s.failures, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = min(float64(b.rate.Limit), b.tokens+elapsed.Seconds()*b.perSecond())
+	b.last = now
+}
+
+// Time the bucket needs to refill the given number of tokens
+func (b *bucket) timeFor(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / b.perSecond() * float64(time.Second)))
+}
+
+func (b *bucket) perSecond() float64 {
+	return float64(b.rate.Limit) / b.rate.Period.Seconds()
+}
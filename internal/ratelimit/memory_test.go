@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/stretchr/testify/assert"
+)
+
+// Store whose clock only moves when the test says so
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func Test_MemoryStore_TokenBucket(t *testing.T) {
+	store, now := newTestStore()
+	ctx := context.Background()
+	rate := Rate{Limit: 3, Period: time.Minute}
+
+	for i := 2; i >= 0; i-- {
+		decision, err := store.Take(ctx, "login:ip:10.0.0.1", rate)
+		assert.Nil(t, err)
+		assert.True(t, decision.Allowed)
+		assert.Equal(t, i, decision.Remaining)
+	}
+
+	decision, _ := store.Take(ctx, "login:ip:10.0.0.1", rate)
+	assert.False(t, decision.Allowed)
+	// One token every 20s
+	assert.Equal(t, 20*time.Second, decision.RetryAfter)
+	assert.Equal(t, time.Minute, decision.ResetAfter)
+
+	// Other keys have buckets of their own
+	decision, _ = store.Take(ctx, "login:ip:10.0.0.2", rate)
+	assert.True(t, decision.Allowed)
+
+	*now = now.Add(20 * time.Second)
+	decision, _ = store.Take(ctx, "login:ip:10.0.0.1", rate)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+}
+
+func Test_MemoryStore_ProgressiveLockout(t *testing.T) {
+	store, now := newTestStore()
+	ctx := context.Background()
+	policy := LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute}
+
+	var locks []time.Duration
+	for range 6 {
+		lock, err := store.Fail(ctx, "alice", policy)
+		assert.Nil(t, err)
+		locks = append(locks, lock)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}, locks)
+
+	locked, _ := store.LockedFor(ctx, "alice")
+	assert.Equal(t, 5*time.Minute, locked)
+
+	*now = now.Add(5 * time.Minute)
+	locked, _ = store.LockedFor(ctx, "alice")
+	assert.Zero(t, locked)
+
+	// A success forgets the failures, the next wrong password starts over
+	assert.Nil(t, store.Reset(ctx, "alice"))
+	lock, _ := store.Fail(ctx, "alice", policy)
+	assert.Zero(t, lock)
+}
+
+func Test_LoginGuard_LocksAfterWrongPasswords(t *testing.T) {
+	store, _ := newTestStore()
+	ctx := context.Background()
+	guard := NewLoginGuard(store, store,
+		Rate{Limit: 10, Period: time.Minute},
+		LockoutPolicy{Threshold: 2, Base: 30 * time.Second, Max: time.Hour},
+	)
+
+	assert.Nil(t, guard.Check(ctx, "alice"))
+	assert.Nil(t, guard.Failed(ctx, "alice"))
+	assert.Nil(t, guard.Check(ctx, "alice"))
+	assert.Nil(t, guard.Failed(ctx, "alice"))
+
+	err := guard.Check(ctx, "alice")
+	assert.ErrorIs(t, err, apperror.ErrAccountLocked)
+	var retryErr *apperror.RetryAfterError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 30*time.Second, retryErr.After)
+
+	// Other accounts are not affected
+	assert.Nil(t, guard.Check(ctx, "bob"))
+}
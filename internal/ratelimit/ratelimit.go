@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Rate allows Limit requests per Period, as a token bucket holding Limit tokens that refills
+// steadily over Period. A client can spend the whole bucket at once, then waits for refills.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Outcome of taking a token from a bucket
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Until the next token is available, zero when the request was allowed
+	RetryAfter time.Duration
+	// Until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps the token buckets. MemoryStore is enough for a single instance, replicas
+// behind a load balancer need a shared store such as a Postgres table updated under FOR UPDATE.
+type Store interface {
+	// Takes a token from the bucket of key, creating a full one on first use
+	Take(ctx context.Context, key string, rate Rate) (Decision, error)
+}
+
+// After Threshold consecutive failures a key is locked for Base, every further failure
+// doubles the lock up to Max
+type LockoutPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+// Lock duration after the given number of consecutive failures, zero below the threshold
+func (p LockoutPolicy) lockFor(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	lock := p.Base
+	for i := p.Threshold; i < failures && lock < p.Max; i++ {
+		lock *= 2
+	}
+	return min(lock, p.Max)
+}
+
+// LockoutStore counts consecutive failures per key, implemented by MemoryStore
+type LockoutStore interface {
+	// Remaining lock of key, zero when it is not locked
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Counts a failure and returns the lock it results in
+	Fail(ctx context.Context, key string, policy LockoutPolicy) (time.Duration, error)
+	// Forgets the failures of key, e.g. after a successful login
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Values accepted for TRACING_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Instrumentation scope of the spans started by this repo
+const scope = "github.com/rigofekete/vhs-club-mvc"
+
+type Options struct {
+	Exporter    string
+	ServiceName string
+	// Fraction of new traces that are recorded, requests joining a sampled trace are always recorded
+	SampleRatio float64
+}
+
+// Installs the global tracer provider and W3C trace context propagation. With ExporterNone spans
+// are still created, so trace IDs reach the logs, but nothing is exported.
+// The returned function flushes the spans that are still buffered.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error building the tracing resource: %w", err)
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	}
+
+	switch opts.Exporter {
+	case ExporterNone:
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("error creating the stdout exporter: %w", err)
+		}
+		// Synchronous so spans show up next to the request logs
+		providerOpts = append(providerOpts, sdktrace.WithSyncer(exporter))
+	case ExporterOTLP:
+		// Endpoint, headers and TLS come from the standard OTEL_EXPORTER_OTLP_* variables
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the OTLP exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Starts a span with the repo's tracer, the returned ctx carries it to the layers below
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(scope).Start(ctx, name, opts...)
+}
+
+// Ends the span and marks it failed when err is set, meant for
+// `defer func() { tracing.End(span, err) }()` with a named err result
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,43 +1,264 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/handler"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+	"github.com/rigofekete/vhs-club-mvc/internal/mail"
+	"github.com/rigofekete/vhs-club-mvc/internal/metrics"
+	"github.com/rigofekete/vhs-club-mvc/internal/ratelimit"
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
 	"github.com/rigofekete/vhs-club-mvc/repository"
 	"github.com/rigofekete/vhs-club-mvc/service"
 )
 
 func main() {
-	config.Load()
-	router := gin.Default()
-	// router.Use(middleware.CORS())
-	router.Use(apperror.ErrorHandler())
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Config, DB pool and services shared by the HTTP server and the admin CLI
+type app struct {
+	cfg     *config.Config
+	db      *sql.DB
+	metrics *metrics.Metrics
+	// Rate limit buckets and login failures, kept in memory as the API runs as a single instance
+	limits *ratelimit.MemoryStore
+
+	userService          service.UserService
+	passwordResetService service.PasswordResetService
+	tapeService          service.TapeService
+	tapeCopyService      service.TapeCopyService
+	rentalService        service.RentalService
+	reservationService   service.ReservationService
+}
+
+// Loads the config, connects to the DB and wires up the dependencies
+func newApp() (*app, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	db, err := config.OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	appMetrics := metrics.New(db)
+	limits := ratelimit.NewMemoryStore()
+	transactor := repository.NewTransactor(db)
+
+	userRepository := repository.NewUserRepository(db)
+	refreshTokenRepository := repository.NewRefreshTokenRepository(db)
+	tapeRepository := repository.NewTapeRepository(db)
+	tapeCopyRepository := repository.NewTapeCopyRepository(db)
+	rentalRepository := repository.NewRentalRepository(db)
+	reservationRepository := repository.NewReservationRepository(db)
+	passwordResetRepository := repository.NewPasswordResetRepository(db)
+
+	tokenPolicy := service.TokenPolicy{
+		Secret:     cfg.JWTSecret,
+		AccessTTL:  cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}
+	rentalPolicy := service.RentalPolicy{
+		Period:             cfg.RentalPeriod,
+		LateFeePerDayCents: cfg.LateFeePerDayCents,
+		MaxRenewals:        cfg.MaxRenewals,
+		MaxRentalsPerUser:  cfg.MaxRentalsPerUser,
+	}
+	resetPolicy := service.PasswordResetPolicy{
+		TTL: cfg.PasswordResetTTL,
+		URL: cfg.PasswordResetURL,
+	}
+	mailer, err := mail.New(mail.Options{
+		Driver: cfg.MailDriver,
+		From:   cfg.MailFrom,
+		File:   cfg.MailFile,
+		SMTP: mail.SMTPOptions{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		},
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	loginGuard := ratelimit.NewLoginGuard(limits, limits,
+		ratelimit.Rate{Limit: cfg.LoginUsernameLimit, Period: cfg.LoginRatePeriod},
+		ratelimit.LockoutPolicy{Threshold: cfg.LoginLockoutThreshold, Base: cfg.LoginLockoutBase, Max: cfg.LoginLockoutMax},
+	)
+
+	return &app{
+		cfg:                  cfg,
+		db:                   db,
+		metrics:              appMetrics,
+		limits:               limits,
+		userService:          service.NewUserService(userRepository, refreshTokenRepository, rentalRepository, transactor, tokenPolicy, loginGuard),
+		passwordResetService: service.NewPasswordResetService(userRepository, passwordResetRepository, refreshTokenRepository, transactor, mailer, resetPolicy, loginGuard),
+		tapeService:          service.NewTapeService(tapeRepository),
+		tapeCopyService:      service.NewTapeCopyService(tapeCopyRepository, tapeRepository, reservationRepository, transactor),
+		rentalService:        service.NewRentalService(rentalRepository, tapeRepository, userRepository, reservationRepository, tapeCopyRepository, transactor, rentalPolicy, appMetrics),
+		reservationService:   service.NewReservationService(reservationRepository, tapeCopyRepository, tapeRepository, userRepository, transactor),
+	}, nil
+}
+
+func (a *app) Close() error {
+	return a.db.Close()
+}
 
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-		})
+// Runs the API until SIGINT or SIGTERM, then lets in-flight requests finish within the shutdown timeout
+func serve() error {
+	app, err := newApp()
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	logger := logging.New(os.Stdout, app.cfg.LogLevel)
+	// log.Printf calls, such as the applied migrations, end up in the same JSON stream
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    app.cfg.TracingExporter,
+		ServiceName: app.cfg.TracingServiceName,
+		SampleRatio: app.cfg.TracingSampleRatio,
 	})
+	if err != nil {
+		return err
+	}
+	// Runs after the server stopped, so the spans of the last requests are flushed too
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("error flushing traces", "error", err)
+		}
+	}()
+
+	migrator, err := newMigrator(app.db)
+	if err != nil {
+		return err
+	}
+	if app.cfg.AutoMigrate {
+		if err := migrateUp(context.Background(), migrator); err != nil {
+			return err
+		}
+	}
+
+	// gin.Default's text logger is replaced by the JSON request log
+	router := gin.New()
+	// ClientIP only follows X-Forwarded-For from these, so clients cannot dodge the per IP limits
+	if err := router.SetTrustedProxies(app.cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	// Tracing first so the request log carries the trace ID
+	router.Use(middleware.Tracing())
+	router.Use(middleware.RequestLogger(logger))
+	// Outside of the recovery and the error handler so the status they write is the one
+	// recorded, panics included
+	router.Use(middleware.Metrics(app.metrics))
+	router.Use(middleware.Recovery())
+	if len(app.cfg.CORSOrigins) > 0 {
+		router.Use(middleware.CORS(app.cfg.CORSOrigins))
+	}
+	router.Use(apperror.ErrorHandler())
+
+	handler.NewHealthHandler(app.db, migrator, app.cfg.ReadinessTimeout).RegisterRoutes(router)
+	router.GET("/metrics", gin.WrapH(app.metrics.Handler()))
+	authn := middleware.NewAuthenticator(app.cfg.JWTSecret, app.userService)
+	limiter, err := middleware.NewRateLimiter(app.limits, middleware.Quota{
+		Anonymous: app.cfg.RateLimitAnonymous,
+		User:      app.cfg.RateLimitUser,
+		Admin:     app.cfg.RateLimitAdmin,
+		Period:    app.cfg.RateLimitPeriod,
+	}, app.cfg.RateLimitOverrides)
+	if err != nil {
+		return err
+	}
+	loginLimit := limiter.PerIP("login", ratelimit.Rate{Limit: app.cfg.LoginIPLimit, Period: app.cfg.LoginRatePeriod})
+	handler.NewUserHandler(app.userService, loginLimit).RegisterRoutes(router, authn, limiter)
+	// Same per IP rate as logins, every accepted request can send an email
+	resetLimit := limiter.PerIP("password-reset", ratelimit.Rate{Limit: app.cfg.LoginIPLimit, Period: app.cfg.LoginRatePeriod})
+	handler.NewPasswordResetHandler(app.passwordResetService, resetLimit).RegisterRoutes(router, limiter)
+	handler.NewTapeHandler(app.tapeService).RegisterRoutes(router, authn, limiter)
+	handler.NewTapeCopyHandler(app.tapeCopyService).RegisterRoutes(router, authn, limiter)
+	handler.NewRentalHandler(app.rentalService).RegisterRoutes(router, authn, limiter)
+	handler.NewReservationHandler(app.reservationService).RegisterRoutes(router, authn, limiter)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Holds that run out while nobody rents or returns the tape are passed on to the next in line here
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Not tied to ctx, a run that has started is allowed to finish before the DB is closed
+				if err := app.reservationService.ExpireHolds(context.Background()); err != nil {
+					logger.Error("error expiring reservation holds", "error", err)
+				}
+			}
+		}
+	}()
+	defer wg.Wait()
+	// Runs once the server stopped, reset mails accepted by the last requests still go out
+	defer app.passwordResetService.Wait()
 
-	// Dependency Injections
-	userRepository := repository.NewUserRepository()
-	userService := service.NewUserService(userRepository)
-	userHandler := handler.NewUserHandler(userService)
-	userHandler.RegisterRoutes(router)
+	server := &http.Server{
+		Addr:           app.cfg.ServerAddr,
+		Handler:        router,
+		ReadTimeout:    app.cfg.ReadTimeout,
+		WriteTimeout:   app.cfg.WriteTimeout,
+		IdleTimeout:    app.cfg.IdleTimeout,
+		MaxHeaderBytes: app.cfg.MaxHeaderBytes,
+	}
 
-	tapeRepository := repository.NewTapeRepository()
-	tapeService := service.NewTapeService(tapeRepository)
-	tapeHandler := handler.NewTapeHandler(tapeService)
-	tapeHandler.RegisterRoutes(router)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
 
-	rentalRepository := repository.NewRentalRepository()
-	rentalService := service.NewRentalService(rentalRepository, tapeRepository, userRepository)
-	rentalHandler := handler.NewRentalHandler(rentalService)
-	rentalHandler.RegisterRoutes(router)
+	select {
+	case err := <-serverErr:
+		// Failed to start, e.g. the address is already in use
+		stop()
+		return fmt.Errorf("error starting the server: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
 
-	_ = router.Run(":8080")
+	logger.Info("shutting down, waiting for in-flight requests", "timeout", app.cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down the server: %w", err)
+	}
+	return nil
 }
@@ -1,26 +1,48 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
+	"github.com/rigofekete/vhs-club-mvc/model"
 )
 
 const (
 	UserIDKey   = "userID"
 	UserRoleKey = "userRole"
-	RoleUser    = "user"
-	RoleAdmin   = "admin"
+	RoleUser    = model.RoleUser
+	RoleAdmin   = model.RoleAdmin
 )
 
+// Authenticator checks the access tokens signed with the server's JWT secret, and that the account
+// behind them still exists and is not disabled
+type Authenticator struct {
+	secret   string
+	accounts AccountLookup
+}
+
+// Looks up the current state of an account, implemented by service.UserService
+type AccountLookup interface {
+	GetAccountStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error)
+}
+
+func NewAuthenticator(secret string, accounts AccountLookup) *Authenticator {
+	return &Authenticator{
+		secret:   secret,
+		accounts: accounts,
+	}
+}
+
 // Middlewares
-func UserAuth() gin.HandlerFunc {
+func (a *Authenticator) UserAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, role, err := extractToken(c)
+		userID, role, err := a.identify(c)
 		if err != nil {
 			_ = c.Error(err)
 			c.Abort()
@@ -37,9 +59,9 @@ func UserAuth() gin.HandlerFunc {
 	}
 }
 
-func AdminAuth() gin.HandlerFunc {
+func (a *Authenticator) AdminAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, role, err := extractToken(c)
+		userID, role, err := a.identify(c)
 		if err != nil {
 			_ = c.Error(err)
 			c.Abort()
@@ -56,27 +78,70 @@ func AdminAuth() gin.HandlerFunc {
 	}
 }
 
+// Sets the user keys when the request carries a valid token and lets every request through,
+// signed in or not. Runs ahead of RateLimiter.Group, so public routes count signed in callers
+// with their role's quota, and requests UserAuth/AdminAuth reject are still counted by IP.
+func (a *Authenticator) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			// A bad token is left for UserAuth/AdminAuth to report, public routes ignore it
+			if userID, role, err := a.authenticate(c); err == nil {
+				c.Set(UserIDKey, userID)
+				c.Set(UserRoleKey, role)
+			}
+		}
+		c.Next()
+	}
+}
+
 // Helpers
-func extractToken(c *gin.Context) (uuid.UUID, string, error) {
+
+// Reuses what OptionalAuth found earlier in the chain, so the token is only checked once
+func (a *Authenticator) identify(c *gin.Context) (uuid.UUID, string, error) {
+	if userID, ok := GetUserID(c); ok {
+		return userID, c.GetString(UserRoleKey), nil
+	}
+	return a.authenticate(c)
+}
+
+// The role comes from the database rather than the token, so promotions and demotions apply
+// to tokens that were issued before them
+func (a *Authenticator) authenticate(c *gin.Context) (uuid.UUID, string, error) {
+	userID, _, err := a.extractToken(c)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	status, err := a.accounts.GetAccountStatus(c.Request.Context(), userID)
+	if err != nil {
+		// Tokens of deleted accounts are no longer valid
+		if errors.Is(err, apperror.ErrUserNotFound) {
+			return uuid.Nil, "", apperror.ErrInvalidToken
+		}
+		return uuid.Nil, "", err
+	}
+	if status.Disabled {
+		return uuid.Nil, "", apperror.ErrAccountDisabled
+	}
+	return userID, status.Role, nil
+}
+
+func (a *Authenticator) extractToken(c *gin.Context) (uuid.UUID, string, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		_ = c.Error(apperror.ErrInvalidHeader)
-		c.Abort()
 		return uuid.Nil, "", apperror.ErrInvalidHeader
 	}
 
 	splitAuth := strings.Split(authHeader, " ")
 	if len(splitAuth) != 2 || splitAuth[0] != "Bearer" {
-		_ = c.Error(apperror.ErrInvalidHeader)
-		c.Abort()
 		return uuid.Nil, "", apperror.ErrInvalidHeader
 	}
 
 	tokenString := splitAuth[1]
-	userID, role, err := auth.ValidateJWT(tokenString, config.AppConfig.JWTSecret)
+	_, span := tracing.Start(c.Request.Context(), "auth.ValidateJWT")
+	userID, role, err := auth.ValidateJWT(tokenString, a.secret)
+	tracing.End(span, err)
 	if err != nil {
-		_ = c.Error(apperror.ErrInvalidToken)
-		c.Abort()
 		return uuid.Nil, "", apperror.ErrInvalidToken
 	}
 	return userID, role, nil
@@ -0,0 +1,76 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// GET /me behind UserAuth and GET /admin behind AdminAuth, both after OptionalAuth like the handlers
+func newAuthRouter(accounts fakeAccounts) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authn := middleware.NewAuthenticator(testSecret, accounts)
+
+	r := gin.New()
+	r.Use(apperror.ErrorHandler())
+	r.GET("/me", authn.OptionalAuth(), authn.UserAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/admin", authn.OptionalAuth(), authn.AdminAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func Test_Authenticator_ValidToken(t *testing.T) {
+	accounts := fakeAccounts{}
+	r := newAuthRouter(accounts)
+
+	assert.Equal(t, http.StatusOK, get(r, "/me", signedIn(t, accounts, model.RoleUser)).Code)
+	assert.Equal(t, http.StatusOK, get(r, "/admin", signedIn(t, accounts, model.RoleAdmin)).Code)
+}
+
+func Test_Authenticator_DisabledAccount(t *testing.T) {
+	accounts := fakeAccounts{}
+	r := newAuthRouter(accounts)
+	token := signedIn(t, accounts, model.RoleAdmin)
+	for _, status := range accounts {
+		status.Disabled = true
+	}
+
+	// The token itself is still valid, the account lookup rejects it
+	for _, path := range []string{"/me", "/admin"} {
+		w := get(r, path, token)
+
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Contains(t, w.Body.String(), `"code":"ACCOUNT_DISABLED"`, path)
+	}
+}
+
+func Test_Authenticator_DeletedAccount(t *testing.T) {
+	r := newAuthRouter(fakeAccounts{})
+	token, err := auth.MakeJWT(uuid.New(), model.RoleUser, testSecret, time.Hour)
+	assert.Nil(t, err)
+
+	w := get(r, "/me", token)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"INVALID_TOKEN"`)
+}
+
+func Test_Authenticator_RoleFromDatabase(t *testing.T) {
+	accounts := fakeAccounts{}
+	r := newAuthRouter(accounts)
+	// Issued while the user was an admin, demoted since
+	token := signedIn(t, accounts, model.RoleAdmin)
+	for _, status := range accounts {
+		status.Role = model.RoleUser
+	}
+
+	assert.Equal(t, http.StatusOK, get(r, "/me", token).Code)
+	assert.Equal(t, http.StatusForbidden, get(r, "/admin", token).Code)
+}
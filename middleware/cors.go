@@ -5,13 +5,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func CORS() gin.HandlerFunc {
+// Lets the given browser origins, e.g. the React dev server on http://localhost:5173, call the API
+func CORS(origins []string) gin.HandlerFunc {
 	return cors.New(cors.Config{
-		AllowOrigins: []string{
-			"http://localhost:5173",
-			"http://localhost:5174",
-		},
-		AllowMethods: []string{"GET", "POST", "PATCH", "PUT", "DELETE"},
-		AllowHeaders: []string{"Content-Type", "Authorization"},
+		AllowOrigins:  origins,
+		AllowMethods:  []string{"GET", "POST", "PATCH", "PUT", "DELETE"},
+		AllowHeaders:  []string{"Content-Type", "Authorization", RequestIDHeader},
+		ExposeHeaders: []string{RequestIDHeader, "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
 	})
 }
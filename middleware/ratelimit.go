@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+	"github.com/rigofekete/vhs-club-mvc/internal/ratelimit"
+)
+
+// Callers without a valid access token
+const RoleAnonymous = "anonymous"
+
+// Route groups with a quota of their own, see RateLimiter.Group
+var RateLimitGroups = []string{"users", "tapes", "copies", "rentals", "reservations"}
+
+// Requests each kind of caller may send to a route group per Period
+type Quota struct {
+	Anonymous int
+	User      int
+	Admin     int
+	Period    time.Duration
+}
+
+// RateLimiter answers clients over their quota with 429 Too Many Requests and a Retry-After header.
+// Allowed responses carry X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (seconds
+// until the quota is full again).
+type RateLimiter struct {
+	store     ratelimit.Store
+	defaults  Quota
+	overrides map[string]int
+}
+
+// Overrides replace the default limit of one role in one group and are keyed like "tapes:anonymous"
+func NewRateLimiter(store ratelimit.Store, defaults Quota, overrides map[string]int) (*RateLimiter, error) {
+	for key := range overrides {
+		group, role, _ := strings.Cut(key, ":")
+		if !slices.Contains(RateLimitGroups, group) {
+			return nil, fmt.Errorf("unknown rate limit group %q in %q, expected one of %s", group, key, strings.Join(RateLimitGroups, ", "))
+		}
+		if role != RoleAnonymous && role != RoleUser && role != RoleAdmin {
+			return nil, fmt.Errorf("unknown rate limit role %q in %q, expected anonymous, user or admin", role, key)
+		}
+	}
+	return &RateLimiter{
+		store:     store,
+		defaults:  defaults,
+		overrides: overrides,
+	}, nil
+}
+
+// Limits the callers of a route group: signed in users by their ID with the quota of their role,
+// everybody else by IP. Reads the context keys Authenticator.OptionalAuth sets, so it goes after
+// OptionalAuth and ahead of UserAuth/AdminAuth, which then only let the counted request through.
+func (l *RateLimiter) Group(group string) gin.HandlerFunc {
+	rates := map[string]ratelimit.Rate{
+		RoleAnonymous: l.rate(group, RoleAnonymous, l.defaults.Anonymous),
+		RoleUser:      l.rate(group, RoleUser, l.defaults.User),
+		RoleAdmin:     l.rate(group, RoleAdmin, l.defaults.Admin),
+	}
+	return func(c *gin.Context) {
+		role, client := RoleAnonymous, c.ClientIP()
+		if userRole, ok := c.Get(UserRoleKey); ok {
+			role = userRole.(string)
+			client = fmt.Sprint(c.MustGet(UserIDKey))
+		}
+		rate, ok := rates[role]
+		if !ok {
+			rate = rates[RoleAnonymous]
+		}
+		l.limit(c, group+":"+role+":"+client, rate)
+	}
+}
+
+// Limits every client IP to rate on the routes it is added to, scope keeps the buckets of
+// different routes apart
+func (l *RateLimiter) PerIP(scope string, rate ratelimit.Rate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l.limit(c, scope+":ip:"+c.ClientIP(), rate)
+	}
+}
+
+// Helpers
+func (l *RateLimiter) rate(group, role string, def int) ratelimit.Rate {
+	limit, ok := l.overrides[group+":"+role]
+	if !ok {
+		limit = def
+	}
+	return ratelimit.Rate{Limit: limit, Period: l.defaults.Period}
+}
+
+func (l *RateLimiter) limit(c *gin.Context, key string, rate ratelimit.Rate) {
+	decision, err := l.store.Take(c.Request.Context(), key, rate)
+	if err != nil {
+		// An unreachable store should not take the API down with it
+		logging.FromContext(c.Request.Context()).Warn("rate limit check failed", "error", err)
+		c.Next()
+		return
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.ResetAfter.Seconds()))))
+	if !decision.Allowed {
+		_ = c.Error(apperror.WithRetryAfter(apperror.ErrRateLimited, decision.RetryAfter))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
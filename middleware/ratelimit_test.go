@@ -0,0 +1,153 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/internal/ratelimit"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-secret"
+
+// Accounts the Authenticator looks tokens up in, unknown IDs are deleted users
+type fakeAccounts map[uuid.UUID]*model.AccountStatus
+
+func (a fakeAccounts) GetAccountStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error) {
+	status, ok := a[id]
+	if !ok {
+		return nil, apperror.ErrUserNotFound
+	}
+	return status, nil
+}
+
+var testQuota = middleware.Quota{Anonymous: 2, User: 3, Admin: 5, Period: time.Minute}
+
+// Public GET /tapes and GET /me behind UserAuth, wired like the handlers do
+func newLimitedRouter(t *testing.T, accounts fakeAccounts, overrides map[string]int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter, err := middleware.NewRateLimiter(ratelimit.NewMemoryStore(), testQuota, overrides)
+	assert.Nil(t, err)
+	authn := middleware.NewAuthenticator(testSecret, accounts)
+	limit := limiter.Group("tapes")
+
+	r := gin.New()
+	r.Use(apperror.ErrorHandler())
+	r.GET("/tapes", authn.OptionalAuth(), limit, func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/me", authn.OptionalAuth(), limit, authn.UserAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func get(r *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func signedIn(t *testing.T, accounts fakeAccounts, role string) string {
+	id := uuid.New()
+	accounts[id] = &model.AccountStatus{Role: role}
+	token, err := auth.MakeJWT(id, role, testSecret, time.Hour)
+	assert.Nil(t, err)
+	return token
+}
+
+func Test_RateLimiter_Headers(t *testing.T) {
+	r := newLimitedRouter(t, fakeAccounts{}, nil)
+
+	w := get(r, "/tapes", "")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	// One of two tokens spent, refilled in half the period
+	assert.Equal(t, "30", w.Header().Get("X-RateLimit-Reset"))
+}
+
+func Test_RateLimiter_TooManyRequests(t *testing.T) {
+	r := newLimitedRouter(t, fakeAccounts{}, nil)
+
+	get(r, "/tapes", "")
+	get(r, "/tapes", "")
+	w := get(r, "/tapes", "")
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"RATE_LIMITED"`)
+}
+
+func Test_RateLimiter_RoleQuotaOnPublicRoutes(t *testing.T) {
+	accounts := fakeAccounts{}
+	r := newLimitedRouter(t, accounts, nil)
+	userToken := signedIn(t, accounts, model.RoleUser)
+	adminToken := signedIn(t, accounts, model.RoleAdmin)
+
+	assert.Equal(t, strconv.Itoa(testQuota.User), get(r, "/tapes", userToken).Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, strconv.Itoa(testQuota.Admin), get(r, "/tapes", adminToken).Header().Get("X-RateLimit-Limit"))
+
+	// Signed in callers have buckets of their own, the anonymous one from the same IP is untouched
+	w := get(r, "/tapes", "")
+	assert.Equal(t, strconv.Itoa(testQuota.Anonymous), w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func Test_RateLimiter_CountsRejectedTokens(t *testing.T) {
+	r := newLimitedRouter(t, fakeAccounts{}, nil)
+
+	// Unknown users fail UserAuth, but only after the limiter counted them by IP
+	stranger, _ := auth.MakeJWT(uuid.New(), model.RoleUser, testSecret, time.Hour)
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", stranger).Code)
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", "not-a-jwt").Code)
+
+	w := get(r, "/me", stranger)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func Test_RateLimiter_Overrides(t *testing.T) {
+	accounts := fakeAccounts{}
+	r := newLimitedRouter(t, accounts, map[string]int{"tapes:user": 1})
+
+	w := get(r, "/tapes", signedIn(t, accounts, model.RoleUser))
+
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+}
+
+func Test_NewRateLimiter_ValidatesOverrides(t *testing.T) {
+	tests := map[string]struct {
+		overrides map[string]int
+		wantErr   bool
+	}{
+		"known group and role": {map[string]int{"rentals:admin": 10}, false},
+		"unknown group":        {map[string]int{"videos:user": 10}, true},
+		"unknown role":         {map[string]int{"tapes:member": 10}, true},
+		"missing role":         {map[string]int{"tapes": 10}, true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			limiter, err := middleware.NewRateLimiter(ratelimit.NewMemoryStore(), testQuota, tc.overrides)
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, limiter)
+			} else {
+				assert.Nil(t, err)
+				assert.NotNil(t, limiter)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+)
+
+// Turns a handler panic into a 500 and logs it with its stack through the request logger,
+// so it carries the request ID like every other 5xx. gin's own text output is dropped.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered",
+			"error", recovered,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
@@ -0,0 +1,33 @@
+package middleware_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+	"github.com/rigofekete/vhs-club-mvc/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Recovery_LogsPanicWithRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	r := gin.New()
+	r.Use(middleware.RequestLogger(logging.New(&logs, slog.LevelInfo)))
+	r.Use(middleware.Recovery())
+	r.GET("/panic", func(c *gin.Context) { panic("tape jammed") })
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, logs.String(), `"msg":"panic recovered"`)
+	assert.Contains(t, logs.String(), `"error":"tape jammed"`)
+	assert.Contains(t, logs.String(), `"request_id":"req-42"`)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/rigofekete/vhs-club-mvc/config"
+	"github.com/rigofekete/vhs-club-mvc/internal/migrate"
+)
+
+// The schema ships inside the binary so deployments don't need the sql/ folder
+//
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+func newMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	schema, err := fs.Sub(schemaFiles, "sql/schema")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, schema)
+}
+
+func migrateUp(ctx context.Context, migrator *migrate.Migrator) error {
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		log.Printf("applied migration %03d_%s", migration.Version, migration.Name)
+	}
+	return err
+}
+
+// Entry point of `migrate up|down|status|baseline VERSION`
+func runMigrate(args []string) error {
+	wantArgs := 1
+	if len(args) > 0 && args[0] == "baseline" {
+		wantArgs = 2
+	}
+	if len(args) != wantArgs {
+		return fmt.Errorf("usage: %s migrate up|down|status|baseline VERSION", os.Args[0])
+	}
+	var baseline int64
+	if args[0] == "baseline" {
+		var err error
+		baseline, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || baseline <= 0 {
+			return fmt.Errorf("migrate baseline: %q is not a valid version", args[1])
+		}
+	}
+
+	// Only the DB is needed, the services would be wired up for nothing
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	db, err := config.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, migrator)
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			log.Print("no migration to revert")
+			return nil
+		}
+		log.Printf("reverted migration %03d_%s", reverted.Version, reverted.Name)
+		return nil
+	case "baseline":
+		if err := requireUntrackedSchema(ctx, db); err != nil {
+			return err
+		}
+		recorded, err := migrator.Baseline(ctx, baseline)
+		if err != nil {
+			return err
+		}
+		for _, migration := range recorded {
+			log.Printf("recorded migration %03d_%s as applied", migration.Version, migration.Name)
+		}
+		return migrateUp(ctx, migrator)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt.Valid {
+				appliedAt = status.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or baseline", args[0])
+	}
+}
+
+// Databases created by the old Dockerfile.db init script (sql/seed.sql) already have the tapes
+// and users tables. Baselining an empty database would skip creating them.
+func requireUntrackedSchema(ctx context.Context, db *sql.DB) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT to_regclass('tapes') IS NOT NULL AND to_regclass('users') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("migrate baseline: the tapes and users tables don't exist, run migrate up instead")
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PasswordResetToken struct {
+	ID        int32
+	TokenHash string
+	UserID    int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefreshToken struct {
+	ID        int32
+	TokenID   uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+}
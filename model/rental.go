@@ -8,13 +8,43 @@ import (
 )
 
 type Rental struct {
-	ID         int32
-	PublicID   uuid.UUID
-	CreatedAt  time.Time
-	UserID     int32
-	TapeID     int32
-	TapeTitle  string
-	Username   string
-	RentedAt   time.Time
-	ReturnedAt sql.NullTime
+	ID        int32
+	PublicID  uuid.UUID
+	CreatedAt time.Time
+	UserID    int32
+	TapeID    int32
+	// The rented copy, NULL for rentals made before copies were tracked
+	CopyID      sql.NullInt32
+	CopyBarcode sql.NullString
+	TapeTitle   string
+	Username    string
+	RentedAt    time.Time
+	ReturnedAt  sql.NullTime
+	DueAt       time.Time
+	// Set when a late tape is returned, stays owed until FeePaidAt is set
+	LateFeeCents int32
+	FeePaidAt    sql.NullTime
+	// Times the due date was pushed back, capped by the rental policy
+	Renewals int32
+}
+
+const (
+	RentalStatusActive   = "active"
+	RentalStatusReturned = "returned"
+)
+
+// Optional rental history filters, nil or empty fields are ignored
+type RentalFilter struct {
+	TapePublicID *uuid.UUID
+	// Set by the service layer once TapePublicID is resolved
+	TapeID *int32
+	From   *time.Time
+	To     *time.Time
+	Status string
+}
+
+// What a member still owes the club, anything non zero blocks new rentals
+type RentalStanding struct {
+	OverdueCount    int64
+	UnpaidFeesCents int64
 }
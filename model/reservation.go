@@ -0,0 +1,33 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Reservation struct {
+	ID            int32
+	PublicID      uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        int32
+	TapeID        int32
+	TapePublicID  uuid.UUID
+	TapeTitle     string
+	Status        string
+	HoldExpiresAt sql.NullTime
+	// 1-based place in the tape queue, only set for waiting reservations
+	Position int32
+}
+
+// A reservation waits in the tape queue until a returned copy is held for it.
+// Only its owner can rent a held copy, until the hold expires.
+const (
+	ReservationStatusWaiting   = "waiting"
+	ReservationStatusHeld      = "held"
+	ReservationStatusFulfilled = "fulfilled"
+	ReservationStatusCancelled = "cancelled"
+	ReservationStatusExpired   = "expired"
+)
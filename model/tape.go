@@ -14,7 +14,11 @@ type Tape struct {
 	Title     string
 	Director  string
 	Genre     string
+	// Copies in circulation, rented out and held for a reservation. Derived from
+	// the tape copies, not filled on row-locked reads.
 	Quantity  int32
+	RentedOut int32
+	OnHold    int32
 }
 
 type UpdateTape struct {
@@ -22,5 +26,34 @@ type UpdateTape struct {
 	Title    *string
 	Director *string
 	Genre    *string
-	Quantity *int32
+}
+
+// Catalog sort orders, a leading '-' means descending
+const (
+	TapeSortCreatedAt     = "created_at"
+	TapeSortCreatedAtDesc = "-created_at"
+	TapeSortTitle         = "title"
+	TapeSortTitleDesc     = "-title"
+)
+
+// Optional catalog filters, nil fields are ignored
+type TapeFilter struct {
+	Sort          string
+	Genre         *string
+	Director      *string
+	AvailableOnly bool
+}
+
+// Position of the last tape of a page, only the column matching the sort order is used
+type TapeCursor struct {
+	Sort      string    `json:"sort"`
+	PublicID  uuid.UUID `json:"public_id"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Title     string    `json:"title,omitempty"`
+}
+
+type TapePage struct {
+	Tapes      []*Tape
+	NextCursor string
+	Total      int64
 }
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A physical cassette of a tape, rentals hand out one copy each
+type TapeCopy struct {
+	ID           int32
+	PublicID     uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	TapeID       int32
+	TapePublicID uuid.UUID
+	Barcode      string
+	Condition    string
+	Status       string
+	AcquiredAt   time.Time
+}
+
+// Only available copies can be rented, retired ones stay for the rental history
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusRented    = "rented"
+	CopyStatusRetired   = "retired"
+)
+
+const (
+	CopyConditionNew     = "new"
+	CopyConditionGood    = "good"
+	CopyConditionWorn    = "worn"
+	CopyConditionDamaged = "damaged"
+)
@@ -1,11 +1,17 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID             int32
 	PublicID       uuid.UUID
@@ -16,5 +22,27 @@ type User struct {
 	Role           string
 	Password       string
 	HashedPassword string
+	DisabledAt     sql.NullTime
 	Token          string
+	RefreshToken   string
+}
+
+// Fields a user can change on their own account, nil fields stay unchanged
+type UpdateUser struct {
+	ID    int32
+	Email *string
+}
+
+// What the auth middleware needs to know about the account behind a token
+type AccountStatus struct {
+	Role     string
+	Disabled bool
+}
+
+// Audit record of a promotion or demotion
+type RoleChange struct {
+	UserID    uuid.UUID
+	ChangedBy uuid.UUID
+	OldRole   string
+	NewRole   string
 }
@@ -0,0 +1,83 @@
+// Session handling for the short lived access token and the single use
+// refresh token the API hands out on login.
+
+export function saveSession(data) {
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refresh_token', data.refresh_token);
+  localStorage.setItem('username', data.username);
+}
+
+export function clearSession() {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
+  localStorage.removeItem('username');
+}
+
+function withToken(options) {
+  return {
+    ...options,
+    headers: {
+      ...options.headers,
+      'Authorization': `Bearer ${localStorage.getItem('token')}`,
+    },
+  };
+}
+
+// Refresh tokens are single use, so concurrent 401s share one refresh.
+// Sending the same token twice would make the server revoke the session.
+let refreshing = null;
+
+function refreshSession() {
+  if (!refreshing) {
+    refreshing = rotateRefreshToken().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+async function rotateRefreshToken() {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) return false;
+
+  try {
+    const response = await fetch('/api/users/refresh', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ "refresh_token": refreshToken }),
+    });
+    if (!response.ok) {
+      clearSession();
+      return false;
+    }
+    saveSession(await response.json());
+    return true;
+  } catch (err) {
+    return false;
+  }
+}
+
+// authFetch sends the access token and, when it has expired, swaps the
+// refresh token for a new pair and retries the request once.
+export async function authFetch(url, options = {}) {
+  const response = await fetch(url, withToken(options));
+  if (response.status !== 401) return response;
+
+  if (!(await refreshSession())) return response;
+  return fetch(url, withToken(options));
+}
+
+// logout drops the local session at once and revokes the refresh token on
+// the server in the background. A failed revoke only leaves a token behind
+// that nobody holds anymore.
+export function logout() {
+  const refreshToken = localStorage.getItem('refresh_token');
+  clearSession();
+  if (!refreshToken) return Promise.resolve();
+
+  return fetch('/api/users/logout', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ "refresh_token": refreshToken }),
+  }).catch(() => { });
+}
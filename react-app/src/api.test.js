@@ -0,0 +1,109 @@
+import { describe, it, expect, vi, beforeEach } from 'vitest'
+import { authFetch, logout, saveSession } from './api'
+
+const unauthorized = { ok: false, status: 401, json: async () => ({ code: 'INVALID_TOKEN' }) }
+
+beforeEach(() => {
+  vi.resetAllMocks()
+  global.fetch = vi.fn()
+  localStorage.clear()
+  saveSession({ token: 'abc123', refresh_token: 'refresh123', username: 'admin' })
+})
+
+describe('authFetch', () => {
+
+  it('sends the access token', async () => {
+    global.fetch = vi.fn().mockResolvedValue({ ok: true, status: 200 })
+
+    await authFetch('api/rentals/1', { method: 'POST' })
+
+    expect(global.fetch).toHaveBeenCalledWith('api/rentals/1', {
+      method: 'POST',
+      headers: { 'Authorization': 'Bearer abc123' },
+    })
+  })
+
+  it('rotates the refresh token and retries on 401', async () => {
+    global.fetch = vi.fn()
+      .mockResolvedValueOnce(unauthorized)
+      .mockResolvedValueOnce({
+        ok: true,
+        status: 200,
+        json: async () => ({ token: 'def456', refresh_token: 'refresh456', username: 'admin' }),
+      })
+      .mockResolvedValueOnce({ ok: true, status: 201 })
+
+    const response = await authFetch('api/rentals/1', { method: 'POST' })
+
+    expect(response.status).toBe(201)
+    expect(global.fetch).toHaveBeenNthCalledWith(2, '/api/users/refresh', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: 'refresh123' }),
+    })
+    expect(global.fetch).toHaveBeenNthCalledWith(3, 'api/rentals/1', {
+      method: 'POST',
+      headers: { 'Authorization': 'Bearer def456' },
+    })
+    expect(localStorage.getItem('token')).toBe('def456')
+    expect(localStorage.getItem('refresh_token')).toBe('refresh456')
+  })
+
+  it('shares one refresh between concurrent requests', async () => {
+    global.fetch = vi.fn((url) => {
+      if (url === '/api/users/refresh') {
+        return Promise.resolve({
+          ok: true,
+          status: 200,
+          json: async () => ({ token: 'def456', refresh_token: 'refresh456', username: 'admin' }),
+        })
+      }
+      if (localStorage.getItem('token') === 'abc123') return Promise.resolve(unauthorized)
+      return Promise.resolve({ ok: true, status: 200 })
+    })
+
+    await Promise.all([authFetch('api/rentals/1'), authFetch('api/rentals/2')])
+
+    const refreshes = global.fetch.mock.calls.filter(([url]) => url === '/api/users/refresh')
+    expect(refreshes).toHaveLength(1)
+  })
+
+  it('clears the session when the refresh token is rejected', async () => {
+    global.fetch = vi.fn()
+      .mockResolvedValueOnce(unauthorized)
+      .mockResolvedValueOnce(unauthorized)
+
+    const response = await authFetch('api/rentals/1', { method: 'POST' })
+
+    expect(response.status).toBe(401)
+    expect(global.fetch).toHaveBeenCalledTimes(2)
+    expect(localStorage.getItem('token')).toBeNull()
+    expect(localStorage.getItem('refresh_token')).toBeNull()
+  })
+})
+
+describe('logout', () => {
+
+  it('revokes the refresh token and clears the session', async () => {
+    global.fetch = vi.fn().mockResolvedValue({ ok: true, status: 204 })
+
+    await logout()
+
+    expect(global.fetch).toHaveBeenCalledWith('/api/users/logout', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: 'refresh123' }),
+    })
+    expect(localStorage.getItem('token')).toBeNull()
+    expect(localStorage.getItem('refresh_token')).toBeNull()
+    expect(localStorage.getItem('username')).toBeNull()
+  })
+
+  it('clears the session when the server is unreachable', async () => {
+    global.fetch = vi.fn().mockRejectedValue(new Error('Network error'))
+
+    await logout()
+
+    expect(localStorage.getItem('token')).toBeNull()
+  })
+})
@@ -5,6 +5,7 @@ import TapeDetail from '../components/TapeDetail'
 import MyRentals from '../components/MyRentals'
 import RentalDetail from '../components/RentalDetail'
 import ParabolicBackground from '../components/ParabolicBackground'
+import { authFetch, logout } from '../api'
 
 
 function Dashboard() {
@@ -31,20 +32,29 @@ function Dashboard() {
   useEffect(() => {
     const fetchData = async () => {
       try {
-        const response = await fetch('api/tapes');
-        if (!response.ok) {
-          const errData = await response.json();
-          let errorMsg = errData.error || 'Failed to fetch tapes';
-          if (errData.fields) {
-            errorMsg += ': ' + Object.entries(errData.fields)
-              .map(([field, msg]) => `${field} - ${msg}`)
-              .join(', ');
+        // The API pages the catalogue, follow next_cursor until the last page
+        const allTapes = [];
+        let cursor = null;
+        do {
+          const query = cursor ? `limit=100&cursor=${encodeURIComponent(cursor)}` : 'limit=100';
+          const response = await fetch(`api/tapes?${query}`);
+          if (!response.ok) {
+            const errData = await response.json();
+            let errorMsg = errData.detail || 'Failed to fetch tapes';
+            if (errData.fields) {
+              errorMsg += ': ' + Object.entries(errData.fields)
+                .map(([field, msg]) => `${field} - ${msg}`)
+                .join(', ');
+            }
+            throw errorMsg;
           }
-          throw errorMsg;
-        }
 
-        const data = await response.json();
-        setTapes(data);
+          const data = await response.json();
+          allTapes.push(...data.tapes);
+          cursor = data.next_cursor;
+        } while (cursor);
+
+        setTapes(allTapes);
       } catch (err) {
         setError(err)
       } finally {
@@ -80,16 +90,13 @@ function Dashboard() {
 
   const handleRent = async (tape) => {
     try {
-      const response = await fetch(`api/rentals/${tape.public_id}`, {
+      const response = await authFetch(`api/rentals/${tape.public_id}`, {
         method: 'POST',
-        headers: {
-          'Authorization': `Bearer ${token}`,
-        },
       });
 
       if (!response.ok) {
         const errData = await response.json();
-        setError(errData.error || 'Failed to rent tape');
+        setError(errData.detail || 'Failed to rent tape');
         return;
       }
 
@@ -101,16 +108,13 @@ function Dashboard() {
 
   const handleReturnRental = async (rental) => {
     try {
-      const response = await fetch(`api/rentals/${rental.public_id}`, {
+      const response = await authFetch(`api/rentals/${rental.public_id}`, {
         method: 'PATCH',
-        headers: {
-          'Authorization': `Bearer ${token}`,
-        },
       });
 
       if (!response.ok) {
         const errData = await response.json();
-        setError(errData.error || 'Failed to return the rented tape');
+        setError(errData.detail || 'Failed to return the rented tape');
         return;
       }
 
@@ -124,8 +128,7 @@ function Dashboard() {
 
 
   const handleLogout = () => {
-    localStorage.removeItem('token')
-    localStorage.removeItem('username')
+    logout();
     navigate('/login');
   };
 
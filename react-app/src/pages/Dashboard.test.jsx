@@ -58,6 +58,8 @@ const fakeTapes = [
   { public_id: '2', title: 'Alien', director: 'Ridley Scott' },
 ]
 
+const fakeTapesPage = { tapes: fakeTapes, next_cursor: null, total: fakeTapes.length }
+
 const fakeRentals = [
   { public_id: 'r1', tape_title: 'Blade Runner', username: 'admin' },
 ]
@@ -97,7 +99,7 @@ describe('Dashboard', () => {
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => fakeTapes,
+      json: async () => fakeTapesPage,
     })
 
     renderDashboard()
@@ -109,7 +111,7 @@ describe('Dashboard', () => {
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => fakeTapes,
+      json: async () => fakeTapesPage,
     })
 
     renderDashboard()
@@ -120,12 +122,35 @@ describe('Dashboard', () => {
     })
   })
 
+  it('follows next_cursor until the last page of tapes', async () => {
+    localStorage.setItem('token', 'abc123')
+    localStorage.setItem('username', 'admin')
+    global.fetch = vi.fn()
+      .mockResolvedValueOnce({
+        ok: true,
+        json: async () => ({ tapes: [fakeTapes[0]], next_cursor: 'page2', total: 2 }),
+      })
+      .mockResolvedValueOnce({
+        ok: true,
+        json: async () => ({ tapes: [fakeTapes[1]], next_cursor: null, total: 2 }),
+      })
+
+    renderDashboard()
+
+    await waitFor(() => {
+      expect(screen.getByText('Blade Runner')).toBeInTheDocument()
+      expect(screen.getByText('Alien')).toBeInTheDocument()
+    })
+    expect(global.fetch).toHaveBeenNthCalledWith(1, 'api/tapes?limit=100')
+    expect(global.fetch).toHaveBeenNthCalledWith(2, 'api/tapes?limit=100&cursor=page2')
+  })
+
   it('displays error when fetch fails', async () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: false,
-      json: async () => ({ error: 'Server error' }),
+      json: async () => ({ detail: 'Server error' }),
     })
 
     renderDashboard()
@@ -137,18 +162,25 @@ describe('Dashboard', () => {
 
   it('logs out, clears localStorage and navigates to /login', async () => {
     localStorage.setItem('token', 'abc123')
+    localStorage.setItem('refresh_token', 'refresh123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => fakeTapes,
+      json: async () => fakeTapesPage,
     })
 
     renderDashboard()
     await userEvent.click(screen.getByText('Logout'))
 
     expect(localStorage.getItem('token')).toBeNull()
+    expect(localStorage.getItem('refresh_token')).toBeNull()
     expect(localStorage.getItem('username')).toBeNull()
     expect(mockNavigate).toHaveBeenCalledWith('/login')
+    expect(global.fetch).toHaveBeenCalledWith('/api/users/logout', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: 'refresh123' }),
+    })
   })
 
   it('shows tape detail when a tape is clicked', async () => {
@@ -156,7 +188,7 @@ describe('Dashboard', () => {
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => fakeTapes,
+      json: async () => fakeTapesPage,
     })
 
     renderDashboard()
@@ -176,7 +208,7 @@ describe('Dashboard', () => {
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => fakeTapes,
+      json: async () => fakeTapesPage,
     })
 
     renderDashboard()
@@ -198,7 +230,7 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes, })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage, })
       .mockResolvedValueOnce({ ok: true, json: async () => fakeRentals, })
 
     renderDashboard()
@@ -219,7 +251,7 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
       .mockResolvedValueOnce({ ok: true, json: async () => ({}) })
 
     renderDashboard()
@@ -241,8 +273,8 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
-      .mockResolvedValueOnce({ ok: false, json: async () => ({ error: 'Already rented' }) })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
+      .mockResolvedValueOnce({ ok: false, json: async () => ({ detail: 'Already rented' }) })
 
     renderDashboard()
 
@@ -262,7 +294,7 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
       .mockResolvedValueOnce({ ok: true, json: async () => fakeRentals })
       .mockResolvedValueOnce({ ok: true, json: async () => ({}) })
 
@@ -291,9 +323,9 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
       .mockResolvedValueOnce({ ok: true, json: async () => fakeRentals })
-      .mockResolvedValueOnce({ ok: false, json: async () => ({ error: 'Return failed' }) })
+      .mockResolvedValueOnce({ ok: false, json: async () => ({ detail: 'Return failed' }) })
 
     renderDashboard()
 
@@ -319,7 +351,7 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
       .mockRejectedValueOnce(new Error('Network error'))
 
     renderDashboard()
@@ -340,7 +372,7 @@ describe('Dashboard', () => {
     localStorage.setItem('token', 'abc123')
     localStorage.setItem('username', 'admin')
     global.fetch = vi.fn()
-      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapes })
+      .mockResolvedValueOnce({ ok: true, json: async () => fakeTapesPage })
       .mockResolvedValueOnce({ ok: true, json: async () => fakeRentals })
       .mockRejectedValueOnce(new Error('Network error'))
 
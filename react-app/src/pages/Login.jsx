@@ -6,6 +6,7 @@ import tvVideo from '/videos/tv.mp4'
 import tvVideo2 from '/videos/intro.mp4'
 import InputField from '../components/InputField'
 import ParabolicBackground from '../components/ParabolicBackground'
+import { saveSession } from '../api'
 
 function Login() {
   const navigate = useNavigate()
@@ -39,7 +40,7 @@ function Login() {
 
       if (!response.ok) {
         const errData = await response.json();
-        let errorMsg = errData.error || 'Login failed. Please try again.';
+        let errorMsg = errData.detail || 'Login failed. Please try again.';
         if (errData.fields) {
           errorMsg += ': ' + Object.entries(errData.fields)
             .map(([field, msg]) => `${field} - ${msg}`)
@@ -50,8 +51,7 @@ function Login() {
       }
 
       const data = await response.json();
-      localStorage.setItem('token', data.token);
-      localStorage.setItem('username', data.username);
+      saveSession(data);
       setLogin(true);
       setTimeout(() => {
         navigate('/dashboard');
@@ -45,7 +45,7 @@ describe('Login', () => {
   it('stores token and navigates on successful login', async () => {
     global.fetch = vi.fn().mockResolvedValue({
       ok: true,
-      json: async () => ({ token: 'abc123', username: 'admin' }),
+      json: async () => ({ token: 'abc123', refresh_token: 'refresh123', username: 'admin' }),
     })
 
     renderLogin()
@@ -54,6 +54,7 @@ describe('Login', () => {
 
     await waitFor(() => {
       expect(localStorage.getItem('token')).toBe('abc123')
+      expect(localStorage.getItem('refresh_token')).toBe('refresh123')
       expect(localStorage.getItem('username')).toBe('admin')
     })
 
@@ -65,7 +66,7 @@ describe('Login', () => {
   it('displays error message on failed login', async () => {
     global.fetch = vi.fn().mockResolvedValue({
       ok: false,
-      json: async () => ({ error: 'Invalid credentials' }),
+      json: async () => ({ detail: 'Invalid credentials' }),
     })
 
     renderLogin()
@@ -93,7 +94,7 @@ describe('Login', () => {
     global.fetch = vi.fn().mockResolvedValue({
       ok: false,
       json: async () => ({
-        error: 'Validation failed',
+        detail: 'Validation failed',
         fields: { username: 'too short', password: 'required' },
       }),
     })
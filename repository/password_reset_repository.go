@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
+
+type PasswordResetRepository interface {
+	Save(ctx context.Context, token *model.PasswordResetToken) error
+	GetByHashForUpdate(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error)
+	UseAllForUser(ctx context.Context, userID int32) error
+}
+
+type passwordResetRepository struct {
+	DB *database.Queries
+}
+
+func NewPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &passwordResetRepository{
+		DB: newQueries(db),
+	}
+}
+
+func (r *passwordResetRepository) Save(ctx context.Context, token *model.PasswordResetToken) error {
+	params := database.CreatePasswordResetTokenParams{
+		TokenHash: token.TokenHash,
+		UserID:    token.UserID,
+		ExpiresAt: token.ExpiresAt,
+	}
+	if err := queries(ctx, r.DB).CreatePasswordResetToken(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Locks the token row until the transaction carried by ctx ends, so a token can only be used once
+func (r *passwordResetRepository) GetByHashForUpdate(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	dbToken, err := queries(ctx, r.DB).GetPasswordResetTokenForUpdate(ctx, tokenHash)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrInvalidResetToken)
+	}
+
+	token := &model.PasswordResetToken{
+		ID:        dbToken.ID,
+		TokenHash: dbToken.TokenHash,
+		UserID:    dbToken.UserID,
+		CreatedAt: dbToken.CreatedAt,
+		ExpiresAt: dbToken.ExpiresAt,
+		UsedAt:    dbToken.UsedAt,
+	}
+	return token, nil
+}
+
+// Invalidates every outstanding reset link of the user
+func (r *passwordResetRepository) UseAllForUser(ctx context.Context, userID int32) error {
+	if err := queries(ctx, r.DB).UseUserPasswordResetTokens(ctx, userID); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
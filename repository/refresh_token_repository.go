@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
+
+type RefreshTokenRepository interface {
+	Save(ctx context.Context, token *model.RefreshToken) (*model.RefreshToken, error)
+	GetByTokenIDForUpdate(ctx context.Context, tokenID uuid.UUID) (*model.RefreshToken, error)
+	Revoke(ctx context.Context, id int32) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID int32) error
+}
+
+type refreshTokenRepository struct {
+	DB *database.Queries
+}
+
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{
+		DB: newQueries(db),
+	}
+}
+
+func (r *refreshTokenRepository) Save(ctx context.Context, token *model.RefreshToken) (*model.RefreshToken, error) {
+	tokenParams := database.CreateRefreshTokenParams{
+		TokenID:   token.TokenID,
+		FamilyID:  token.FamilyID,
+		UserID:    token.UserID,
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	dbToken, err := queries(ctx, r.DB).CreateRefreshToken(ctx, tokenParams)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+
+	savedToken := &model.RefreshToken{
+		ID:        dbToken.ID,
+		TokenID:   dbToken.TokenID,
+		FamilyID:  dbToken.FamilyID,
+		UserID:    dbToken.UserID,
+		CreatedAt: dbToken.CreatedAt,
+		ExpiresAt: dbToken.ExpiresAt,
+		RevokedAt: dbToken.RevokedAt,
+	}
+	return savedToken, nil
+}
+
+// Locks the token row until the transaction carried by ctx ends, so a refresh token can only be rotated once
+func (r *refreshTokenRepository) GetByTokenIDForUpdate(ctx context.Context, tokenID uuid.UUID) (*model.RefreshToken, error) {
+	dbToken, err := queries(ctx, r.DB).GetRefreshTokenForUpdate(ctx, tokenID)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrInvalidToken)
+	}
+
+	token := &model.RefreshToken{
+		ID:        dbToken.ID,
+		TokenID:   dbToken.TokenID,
+		FamilyID:  dbToken.FamilyID,
+		UserID:    dbToken.UserID,
+		CreatedAt: dbToken.CreatedAt,
+		ExpiresAt: dbToken.ExpiresAt,
+		RevokedAt: dbToken.RevokedAt,
+	}
+	return token, nil
+}
+
+func (r *refreshTokenRepository) Revoke(ctx context.Context, id int32) error {
+	if err := queries(ctx, r.DB).RevokeRefreshToken(ctx, id); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := queries(ctx, r.DB).RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Ends every session of the user, e.g. after a password change
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int32) error {
+	if err := queries(ctx, r.DB).RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
@@ -2,19 +2,25 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/database"
 	"github.com/rigofekete/vhs-club-mvc/model"
 )
 
 type RentalRepository interface {
-	Save(ctx context.Context, tapeID, userID int32) (*model.Rental, error)
-	ReturnTape(ctx context.Context, rentalID uuid.UUID, userID int32) error
+	Save(ctx context.Context, tapeID, userID, copyID int32, dueAt time.Time) (*model.Rental, error)
+	GetActiveForUpdate(ctx context.Context, rentalID uuid.UUID, userID int32) (*model.Rental, error)
+	ReturnTape(ctx context.Context, id int32, returnedAt time.Time, lateFeeCents int32) error
+	Renew(ctx context.Context, id int32, dueAt time.Time) (*model.Rental, error)
 	GetAllActive(ctx context.Context) ([]*model.Rental, error)
-	GetActiveRentCountByTape(ctx context.Context, tapeID int32) (*int64, error)
+	GetOverdue(ctx context.Context, now time.Time) ([]*model.Rental, error)
+	GetStanding(ctx context.Context, userID int32, now time.Time) (*model.RentalStanding, error)
+	PayLateFee(ctx context.Context, rentalID uuid.UUID) error
+	GetHistoryByUser(ctx context.Context, userID int32, filter *model.RentalFilter) ([]*model.Rental, error)
 	GetActiveRentCountByUser(ctx context.Context, userID int32) (*int64, error)
 	DeleteAllRentals(ctx context.Context) error
 }
@@ -23,93 +29,241 @@ type rentalRepository struct {
 	DB *database.Queries
 }
 
-func NewRentalRepository() RentalRepository {
+func NewRentalRepository(db *sql.DB) RentalRepository {
 	return &rentalRepository{
-		DB: config.AppConfig.DB,
+		DB: newQueries(db),
 	}
 }
 
-func (r *rentalRepository) Save(ctx context.Context, tapeID, userID int32) (*model.Rental, error) {
+func (r *rentalRepository) Save(ctx context.Context, tapeID, userID, copyID int32, dueAt time.Time) (*model.Rental, error) {
 	rentalParams := database.CreateRentalParams{
-		UserID: userID,
+		UserID: toNullInt32(&userID),
 		TapeID: tapeID,
+		CopyID: toNullInt32(&copyID),
+		DueAt:  dueAt,
 	}
 
-	dbRental, err := r.DB.CreateRental(ctx, rentalParams)
+	dbRental, err := queries(ctx, r.DB).CreateRental(ctx, rentalParams)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 
 	savedRental := &model.Rental{
-		ID:         dbRental.ID,
-		PublicID:   dbRental.PublicID,
-		CreatedAt:  dbRental.CreatedAt,
-		UserID:     dbRental.UserID,
-		TapeID:     dbRental.TapeID,
-		TapeTitle:  dbRental.Title,
-		Username:   dbRental.Username,
-		RentedAt:   dbRental.RentedAt,
-		ReturnedAt: dbRental.ReturnedAt,
+		ID:          dbRental.ID,
+		PublicID:    dbRental.PublicID,
+		CreatedAt:   dbRental.CreatedAt,
+		UserID:      dbRental.UserID.Int32,
+		TapeID:      dbRental.TapeID,
+		CopyID:      dbRental.CopyID,
+		CopyBarcode: dbRental.Barcode,
+		TapeTitle:   dbRental.Title,
+		Username:    dbRental.Username,
+		RentedAt:    dbRental.RentedAt,
+		ReturnedAt:  dbRental.ReturnedAt,
+		DueAt:       dbRental.DueAt,
+		Renewals:    dbRental.Renewals,
 	}
 	return savedRental, nil
 }
 
-func (r *rentalRepository) ReturnTape(ctx context.Context, rentalID uuid.UUID, userID int32) error {
+// Locks the rental row until the transaction carried by ctx ends
+func (r *rentalRepository) GetActiveForUpdate(ctx context.Context, rentalID uuid.UUID, userID int32) (*model.Rental, error) {
 	params := database.GetActiveRentalParams{
 		PublicID: rentalID,
-		UserID:   userID,
+		UserID:   toNullInt32(&userID),
 	}
-	rental, err := r.DB.GetActiveRental(ctx, params)
+	rental, err := queries(ctx, r.DB).GetActiveRental(ctx, params)
 	if err != nil {
-		// TODO: Consider creating an error sentinel for this error case
-		return apperror.ErrBadRequest
+		return nil, mapDBError(err, apperror.ErrRentalNotFound)
 	}
 
-	return r.DB.ReturnTape(ctx, rental.ID)
+	activeRental := &model.Rental{
+		ID:        rental.ID,
+		PublicID:  rental.PublicID,
+		CreatedAt: rental.CreatedAt,
+		UserID:    rental.UserID.Int32,
+		TapeID:    rental.TapeID,
+		CopyID:    rental.CopyID,
+		RentedAt:  rental.RentedAt,
+		DueAt:     rental.DueAt,
+		Renewals:  rental.Renewals,
+	}
+	return activeRental, nil
+}
+
+func (r *rentalRepository) ReturnTape(ctx context.Context, id int32, returnedAt time.Time, lateFeeCents int32) error {
+	params := database.ReturnTapeParams{
+		ReturnedAt:   returnedAt,
+		LateFeeCents: lateFeeCents,
+		ID:           id,
+	}
+	if err := queries(ctx, r.DB).ReturnTape(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+func (r *rentalRepository) Renew(ctx context.Context, id int32, dueAt time.Time) (*model.Rental, error) {
+	params := database.RenewRentalParams{
+		DueAt: dueAt,
+		ID:    id,
+	}
+	dbRental, err := queries(ctx, r.DB).RenewRental(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrRentalNotFound)
+	}
+
+	renewedRental := &model.Rental{
+		ID:           dbRental.ID,
+		PublicID:     dbRental.PublicID,
+		CreatedAt:    dbRental.CreatedAt,
+		UserID:       dbRental.UserID.Int32,
+		TapeID:       dbRental.TapeID,
+		CopyID:       dbRental.CopyID,
+		CopyBarcode:  dbRental.Barcode,
+		TapeTitle:    dbRental.Title,
+		Username:     dbRental.Username,
+		RentedAt:     dbRental.RentedAt,
+		DueAt:        dbRental.DueAt,
+		LateFeeCents: dbRental.LateFeeCents,
+		Renewals:     dbRental.Renewals,
+	}
+	return renewedRental, nil
 }
 
 func (r *rentalRepository) GetAllActive(ctx context.Context) ([]*model.Rental, error) {
-	dbRentals, err := r.DB.GetAllActiveRentals(ctx)
+	dbRentals, err := queries(ctx, r.DB).GetAllActiveRentals(ctx)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 
 	rentals := make([]*model.Rental, 0)
 	for _, rental := range dbRentals {
 		r := &model.Rental{
-			ID:        rental.ID,
-			PublicID:  rental.PublicID,
-			CreatedAt: rental.CreatedAt,
-			UserID:    rental.UserID,
-			TapeID:    rental.TapeID,
-			TapeTitle: rental.Title,
-			Username:  rental.Username,
-			RentedAt:  rental.RentedAt,
+			ID:          rental.ID,
+			PublicID:    rental.PublicID,
+			CreatedAt:   rental.CreatedAt,
+			UserID:      rental.UserID.Int32,
+			TapeID:      rental.TapeID,
+			CopyID:      rental.CopyID,
+			CopyBarcode: rental.Barcode,
+			TapeTitle:   rental.Title,
+			Username:    rental.Username,
+			RentedAt:    rental.RentedAt,
+			DueAt:       rental.DueAt,
+			Renewals:    rental.Renewals,
 		}
 		rentals = append(rentals, r)
 	}
 	return rentals, err
 }
 
-func (r *rentalRepository) GetActiveRentCountByTape(ctx context.Context, tapeID int32) (*int64, error) {
-	count, err := r.DB.GetActiveRentalCountByTape(ctx, tapeID)
+// Active rentals past their due date, the longest overdue first
+func (r *rentalRepository) GetOverdue(ctx context.Context, now time.Time) ([]*model.Rental, error) {
+	dbRentals, err := queries(ctx, r.DB).GetOverdueRentals(ctx, now)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
-	return &count, nil
+
+	rentals := make([]*model.Rental, 0, len(dbRentals))
+	for _, rental := range dbRentals {
+		r := &model.Rental{
+			ID:          rental.ID,
+			PublicID:    rental.PublicID,
+			CreatedAt:   rental.CreatedAt,
+			UserID:      rental.UserID.Int32,
+			TapeID:      rental.TapeID,
+			CopyID:      rental.CopyID,
+			CopyBarcode: rental.Barcode,
+			TapeTitle:   rental.Title,
+			Username:    rental.Username,
+			RentedAt:    rental.RentedAt,
+			DueAt:       rental.DueAt,
+			Renewals:    rental.Renewals,
+		}
+		rentals = append(rentals, r)
+	}
+	return rentals, nil
+}
+
+func (r *rentalRepository) GetHistoryByUser(ctx context.Context, userID int32, filter *model.RentalFilter) ([]*model.Rental, error) {
+	historyParams := database.GetRentalHistoryByUserParams{
+		UserID:     toNullInt32(&userID),
+		TapeID:     toNullInt32(filter.TapeID),
+		RentedFrom: toNullTime(filter.From),
+		RentedTo:   toNullTime(filter.To),
+	}
+	if filter.Status != "" {
+		historyParams.Status = toNullString(&filter.Status)
+	}
+
+	dbRentals, err := queries(ctx, r.DB).GetRentalHistoryByUser(ctx, historyParams)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+
+	rentals := make([]*model.Rental, 0, len(dbRentals))
+	for _, rental := range dbRentals {
+		r := &model.Rental{
+			ID:           rental.ID,
+			PublicID:     rental.PublicID,
+			CreatedAt:    rental.CreatedAt,
+			UserID:       rental.UserID.Int32,
+			TapeID:       rental.TapeID,
+			CopyID:       rental.CopyID,
+			CopyBarcode:  rental.Barcode,
+			TapeTitle:    rental.Title,
+			Username:     rental.Username,
+			RentedAt:     rental.RentedAt,
+			ReturnedAt:   rental.ReturnedAt,
+			DueAt:        rental.DueAt,
+			Renewals:     rental.Renewals,
+			LateFeeCents: rental.LateFeeCents,
+			FeePaidAt:    rental.FeePaidAt,
+		}
+		rentals = append(rentals, r)
+	}
+	return rentals, nil
 }
 
 func (r *rentalRepository) GetActiveRentCountByUser(ctx context.Context, userID int32) (*int64, error) {
-	count, err := r.DB.GetActiveRentalCountByUser(ctx, userID)
+	count, err := queries(ctx, r.DB).GetActiveRentalCountByUser(ctx, toNullInt32(&userID))
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 	return &count, nil
 }
 
+func (r *rentalRepository) GetStanding(ctx context.Context, userID int32, now time.Time) (*model.RentalStanding, error) {
+	params := database.GetUserRentalStandingParams{
+		Now:    now,
+		UserID: toNullInt32(&userID),
+	}
+	standing, err := queries(ctx, r.DB).GetUserRentalStanding(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+	return &model.RentalStanding{
+		OverdueCount:    standing.OverdueCount,
+		UnpaidFeesCents: standing.UnpaidFeesCents,
+	}, nil
+}
+
+// Rentals without an unpaid late fee are reported as not found
+func (r *rentalRepository) PayLateFee(ctx context.Context, rentalID uuid.UUID) error {
+	paid, err := queries(ctx, r.DB).PayRentalLateFee(ctx, rentalID)
+	if err != nil {
+		return mapDBError(err, nil)
+	}
+	if paid == 0 {
+		return apperror.ErrRentalNotFound
+	}
+	return nil
+}
+
 func (r *rentalRepository) DeleteAllRentals(ctx context.Context) error {
-	if err := r.DB.DeleteAllRentals(ctx); err != nil {
-		return err
+	if err := queries(ctx, r.DB).DeleteAllRentals(ctx); err != nil {
+		return mapDBError(err, nil)
 	}
 	return nil
 }
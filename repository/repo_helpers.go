@@ -1,19 +1,98 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"fmt"
+	"net"
 
 	"github.com/lib/pq"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
 )
 
-// postgreSQL unique violation code
-const dbUniqueViolation = "23505"
+// postgreSQL error codes, https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	dbUniqueViolation     = "23505"
+	dbForeignKeyViolation = "23503"
+	dbCheckViolation      = "23514"
+	dbNotNullViolation    = "23502"
+	dbTooManyConnections  = "53300"
+	dbAdminShutdown       = "57P01"
+	dbCrashShutdown       = "57P02"
+	dbCannotConnectNow    = "57P03"
+	// Class of every connection failure, 08006 and friends
+	dbConnectionException = "08"
+)
 
 func isUniqueConstraintError(err error) bool {
+	return hasPQCode(err, dbUniqueViolation)
+}
+
+// Sorts a DB error into the apperror taxonomy: sql.ErrNoRows becomes the notFound sentinel,
+// constraint violations and outages get their own sentinels and everything else is
+// returned as is, which ends up as a 500. The driver error stays wrapped for the logs.
+func mapDBError(err error, notFound error) error {
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows) && notFound != nil:
+		return notFound
+	case isUnavailable(err):
+		return fmt.Errorf("%w: %w", apperror.ErrDatabaseUnavailable, err)
+	case !errors.As(err, &pqErr):
+		return err
+	}
+
+	switch string(pqErr.Code) {
+	case dbUniqueViolation:
+		return fmt.Errorf("%w: %w", apperror.ErrConflict, err)
+	case dbForeignKeyViolation:
+		return fmt.Errorf("%w: %w", apperror.ErrReferenceViolation, err)
+	case dbCheckViolation, dbNotNullViolation:
+		return fmt.Errorf("%w: %w", apperror.ErrConstraintViolation, err)
+	}
+	return err
+}
+
+// Lost or refused connections, a server going down and queries running out of time
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if pqErr.Code.Class() == dbConnectionException {
+			return true
+		}
+		switch string(pqErr.Code) {
+		case dbTooManyConnections, dbAdminShutdown, dbCrashShutdown, dbCannotConnectNow:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func hasPQCode(err error, code string) bool {
 	// pq package PostgreSQL error type
 	var pqErr *pq.Error
 	if errors.As(err, &pqErr) {
-		return pqErr.Code == dbUniqueViolation
+		return string(pqErr.Code) == code
 	}
 	return false
 }
+
+// Returns the sqlc Queries bound to the transaction started by Transactor.WithinTx, if ctx carries one
+func queries(ctx context.Context, q *database.Queries) *database.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return newQueries(tx)
+	}
+	return q
+}
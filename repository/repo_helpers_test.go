@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MapDBError(t *testing.T) {
+	queryErr := errors.New("pq: syntax error")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no rows", sql.ErrNoRows, apperror.ErrTapeNotFound},
+		{"unique", &pq.Error{Code: dbUniqueViolation}, apperror.ErrConflict},
+		{"foreign key", &pq.Error{Code: dbForeignKeyViolation}, apperror.ErrReferenceViolation},
+		{"check", &pq.Error{Code: dbCheckViolation}, apperror.ErrConstraintViolation},
+		{"not null", &pq.Error{Code: dbNotNullViolation}, apperror.ErrConstraintViolation},
+		{"connection failure", &pq.Error{Code: "08006"}, apperror.ErrDatabaseUnavailable},
+		{"server shutting down", &pq.Error{Code: dbAdminShutdown}, apperror.ErrDatabaseUnavailable},
+		{"bad connection", driver.ErrBadConn, apperror.ErrDatabaseUnavailable},
+		{"refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, apperror.ErrDatabaseUnavailable},
+		{"timeout", context.DeadlineExceeded, apperror.ErrDatabaseUnavailable},
+		{"anything else", queryErr, queryErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, mapDBError(tt.err, apperror.ErrTapeNotFound), tt.want)
+		})
+	}
+
+	assert.Nil(t, mapDBError(nil, apperror.ErrTapeNotFound))
+	// Without a not found sentinel the caller handles sql.ErrNoRows itself
+	assert.ErrorIs(t, mapDBError(sql.ErrNoRows, nil), sql.ErrNoRows)
+	// The driver error stays reachable for logging
+	var pqErr *pq.Error
+	assert.True(t, errors.As(mapDBError(&pq.Error{Code: dbUniqueViolation}, nil), &pqErr))
+}
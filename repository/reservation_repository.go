@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
+
+// Status changes are serialized by the tape row lock (TapeRepository ForUpdate reads). Only
+// GetByPublicIDForUpdate locks a reservation row, and only after its tape row was locked.
+type ReservationRepository interface {
+	Save(ctx context.Context, tapeID, userID int32) (*model.Reservation, error)
+	GetByPublicID(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error)
+	GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error)
+	GetOpen(ctx context.Context, userID, tapeID int32) (*model.Reservation, error)
+	GetOpenByUser(ctx context.Context, userID int32) ([]*model.Reservation, error)
+	CountHeldByTape(ctx context.Context, tapeID int32) (int64, error)
+	CountWaitingByTape(ctx context.Context, tapeID int32) (int64, error)
+	ExpireHolds(ctx context.Context, tapeID int32, now time.Time) error
+	PromoteWaiting(ctx context.Context, tapeID, slots int32, holdExpiresAt time.Time) (int64, error)
+	DemoteHeld(ctx context.Context, tapeID, slots int32) (int64, error)
+	Fulfill(ctx context.Context, id int32) error
+	Cancel(ctx context.Context, id int32) error
+	GetTapeIDsWithExpiredHolds(ctx context.Context, now time.Time) ([]int32, error)
+}
+
+type reservationRepository struct {
+	DB *database.Queries
+}
+
+func NewReservationRepository(db *sql.DB) ReservationRepository {
+	return &reservationRepository{
+		DB: newQueries(db),
+	}
+}
+
+func (r *reservationRepository) Save(ctx context.Context, tapeID, userID int32) (*model.Reservation, error) {
+	reservationParams := database.CreateReservationParams{
+		UserID: userID,
+		TapeID: tapeID,
+	}
+
+	dbReservation, err := queries(ctx, r.DB).CreateReservation(ctx, reservationParams)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, apperror.ErrReservationExists
+		}
+		return nil, mapDBError(err, nil)
+	}
+
+	savedReservation := &model.Reservation{
+		ID:            dbReservation.ID,
+		PublicID:      dbReservation.PublicID,
+		CreatedAt:     dbReservation.CreatedAt,
+		UpdatedAt:     dbReservation.UpdatedAt,
+		UserID:        dbReservation.UserID,
+		TapeID:        dbReservation.TapeID,
+		TapePublicID:  dbReservation.TapePublicID,
+		TapeTitle:     dbReservation.Title,
+		Status:        dbReservation.Status,
+		HoldExpiresAt: dbReservation.HoldExpiresAt,
+		Position:      dbReservation.Position,
+	}
+	return savedReservation, nil
+}
+
+func (r *reservationRepository) GetByPublicID(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error) {
+	params := database.GetReservationByPublicIDParams{
+		PublicID: id,
+		UserID:   userID,
+	}
+	dbReservation, err := queries(ctx, r.DB).GetReservationByPublicID(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrReservationNotFound)
+	}
+	return toReservationModel(dbReservation), nil
+}
+
+// Locks the reservation row until the transaction carried by ctx ends. Lock the tape row first,
+// the other way round deadlocks with the hold updates that run under the tape lock.
+func (r *reservationRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error) {
+	params := database.GetReservationByPublicIDForUpdateParams{
+		PublicID: id,
+		UserID:   userID,
+	}
+	dbReservation, err := queries(ctx, r.DB).GetReservationByPublicIDForUpdate(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrReservationNotFound)
+	}
+	return toReservationModel(dbReservation), nil
+}
+
+// Returns ErrReservationNotFound when the user has no waiting or held reservation for the tape
+func (r *reservationRepository) GetOpen(ctx context.Context, userID, tapeID int32) (*model.Reservation, error) {
+	params := database.GetOpenReservationParams{
+		UserID: userID,
+		TapeID: tapeID,
+	}
+	dbReservation, err := queries(ctx, r.DB).GetOpenReservation(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrReservationNotFound)
+	}
+	return toReservationModel(dbReservation), nil
+}
+
+func (r *reservationRepository) GetOpenByUser(ctx context.Context, userID int32) ([]*model.Reservation, error) {
+	dbReservations, err := queries(ctx, r.DB).GetOpenReservationsByUser(ctx, userID)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+
+	reservations := make([]*model.Reservation, 0, len(dbReservations))
+	for _, reservation := range dbReservations {
+		res := &model.Reservation{
+			ID:            reservation.ID,
+			PublicID:      reservation.PublicID,
+			CreatedAt:     reservation.CreatedAt,
+			UpdatedAt:     reservation.UpdatedAt,
+			UserID:        reservation.UserID,
+			TapeID:        reservation.TapeID,
+			TapePublicID:  reservation.TapePublicID,
+			TapeTitle:     reservation.Title,
+			Status:        reservation.Status,
+			HoldExpiresAt: reservation.HoldExpiresAt,
+		}
+		if reservation.Status == model.ReservationStatusWaiting {
+			res.Position = reservation.Position
+		}
+		reservations = append(reservations, res)
+	}
+	return reservations, nil
+}
+
+func (r *reservationRepository) CountHeldByTape(ctx context.Context, tapeID int32) (int64, error) {
+	count, err := queries(ctx, r.DB).CountHeldReservationsByTape(ctx, tapeID)
+	return count, mapDBError(err, nil)
+}
+
+func (r *reservationRepository) CountWaitingByTape(ctx context.Context, tapeID int32) (int64, error) {
+	count, err := queries(ctx, r.DB).CountWaitingReservationsByTape(ctx, tapeID)
+	return count, mapDBError(err, nil)
+}
+
+func (r *reservationRepository) ExpireHolds(ctx context.Context, tapeID int32, now time.Time) error {
+	params := database.ExpireReservationHoldsParams{
+		TapeID: tapeID,
+		Now:    now,
+	}
+	if err := queries(ctx, r.DB).ExpireReservationHolds(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Turns up to slots waiting reservations into holds, oldest first, and returns how many were promoted
+func (r *reservationRepository) PromoteWaiting(ctx context.Context, tapeID, slots int32, holdExpiresAt time.Time) (int64, error) {
+	params := database.PromoteWaitingReservationsParams{
+		HoldExpiresAt: holdExpiresAt,
+		TapeID:        tapeID,
+		Slots:         slots,
+	}
+	count, err := queries(ctx, r.DB).PromoteWaitingReservations(ctx, params)
+	return count, mapDBError(err, nil)
+}
+
+// Turns up to slots holds back into waiting reservations, newest holds first, and returns how many were demoted
+func (r *reservationRepository) DemoteHeld(ctx context.Context, tapeID, slots int32) (int64, error) {
+	params := database.DemoteNewestHoldsParams{
+		TapeID: tapeID,
+		Slots:  slots,
+	}
+	count, err := queries(ctx, r.DB).DemoteNewestHolds(ctx, params)
+	return count, mapDBError(err, nil)
+}
+
+func (r *reservationRepository) Fulfill(ctx context.Context, id int32) error {
+	if err := queries(ctx, r.DB).FulfillReservation(ctx, id); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Only waiting and held reservations can be cancelled, anything else is reported as not found
+func (r *reservationRepository) Cancel(ctx context.Context, id int32) error {
+	cancelled, err := queries(ctx, r.DB).CancelReservation(ctx, id)
+	if err != nil {
+		return mapDBError(err, nil)
+	}
+	if cancelled == 0 {
+		return apperror.ErrReservationNotFound
+	}
+	return nil
+}
+
+func (r *reservationRepository) GetTapeIDsWithExpiredHolds(ctx context.Context, now time.Time) ([]int32, error) {
+	ids, err := queries(ctx, r.DB).GetTapeIDsWithExpiredHolds(ctx, now)
+	return ids, mapDBError(err, nil)
+}
+
+// Helpers
+
+func toReservationModel(dbReservation database.Reservation) *model.Reservation {
+	return &model.Reservation{
+		ID:            dbReservation.ID,
+		PublicID:      dbReservation.PublicID,
+		CreatedAt:     dbReservation.CreatedAt,
+		UpdatedAt:     dbReservation.UpdatedAt,
+		UserID:        dbReservation.UserID,
+		TapeID:        dbReservation.TapeID,
+		Status:        dbReservation.Status,
+		HoldExpiresAt: dbReservation.HoldExpiresAt,
+	}
+}
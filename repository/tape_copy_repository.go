@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/rigofekete/vhs-club-mvc/model"
+)
+
+// Like reservations, copy status changes are serialized by the tape row lock
+// (TapeRepository ForUpdate reads), none of these queries lock copy rows themselves
+type TapeCopyRepository interface {
+	Save(ctx context.Context, tapeCopy *model.TapeCopy) (*model.TapeCopy, error)
+	GetByPublicID(ctx context.Context, id uuid.UUID) (*model.TapeCopy, error)
+	GetByTape(ctx context.Context, tapeID int32) ([]*model.TapeCopy, error)
+	GetAvailable(ctx context.Context, tapeID int32) (*model.TapeCopy, error)
+	CountAvailableByTape(ctx context.Context, tapeID int32) (int64, error)
+	SetStatus(ctx context.Context, id int32, status string) error
+	UpdateCondition(ctx context.Context, id int32, condition string) (*model.TapeCopy, error)
+	ReleaseAllRented(ctx context.Context) error
+}
+
+type tapeCopyRepository struct {
+	DB *database.Queries
+}
+
+func NewTapeCopyRepository(db *sql.DB) TapeCopyRepository {
+	return &tapeCopyRepository{
+		DB: newQueries(db),
+	}
+}
+
+func (r *tapeCopyRepository) Save(ctx context.Context, tapeCopy *model.TapeCopy) (*model.TapeCopy, error) {
+	copyParams := database.CreateTapeCopyParams{
+		TapeID:     tapeCopy.TapeID,
+		Barcode:    tapeCopy.Barcode,
+		Condition:  tapeCopy.Condition,
+		AcquiredAt: tapeCopy.AcquiredAt,
+	}
+
+	dbCopy, err := queries(ctx, r.DB).CreateTapeCopy(ctx, copyParams)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, apperror.ErrCopyExists
+		}
+		return nil, mapDBError(err, nil)
+	}
+	return toTapeCopyModel(dbCopy), nil
+}
+
+func (r *tapeCopyRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*model.TapeCopy, error) {
+	dbCopy, err := queries(ctx, r.DB).GetTapeCopyByPublicID(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrCopyNotFound)
+	}
+
+	tapeCopy := &model.TapeCopy{
+		ID:           dbCopy.ID,
+		PublicID:     dbCopy.PublicID,
+		CreatedAt:    dbCopy.CreatedAt,
+		UpdatedAt:    dbCopy.UpdatedAt,
+		TapeID:       dbCopy.TapeID,
+		TapePublicID: dbCopy.TapePublicID,
+		Barcode:      dbCopy.Barcode,
+		Condition:    dbCopy.Condition,
+		Status:       dbCopy.Status,
+		AcquiredAt:   dbCopy.AcquiredAt,
+	}
+	return tapeCopy, nil
+}
+
+func (r *tapeCopyRepository) GetByTape(ctx context.Context, tapeID int32) ([]*model.TapeCopy, error) {
+	dbCopies, err := queries(ctx, r.DB).GetTapeCopiesByTape(ctx, tapeID)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+
+	copies := make([]*model.TapeCopy, 0, len(dbCopies))
+	for _, dbCopy := range dbCopies {
+		copies = append(copies, toTapeCopyModel(dbCopy))
+	}
+	return copies, nil
+}
+
+// Returns ErrTapeUnavailable when every copy of the tape is rented out or retired
+func (r *tapeCopyRepository) GetAvailable(ctx context.Context, tapeID int32) (*model.TapeCopy, error) {
+	dbCopy, err := queries(ctx, r.DB).GetAvailableTapeCopy(ctx, tapeID)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrTapeUnavailable)
+	}
+	return toTapeCopyModel(dbCopy), nil
+}
+
+func (r *tapeCopyRepository) CountAvailableByTape(ctx context.Context, tapeID int32) (int64, error) {
+	count, err := queries(ctx, r.DB).CountAvailableTapeCopies(ctx, tapeID)
+	return count, mapDBError(err, nil)
+}
+
+func (r *tapeCopyRepository) SetStatus(ctx context.Context, id int32, status string) error {
+	params := database.SetTapeCopyStatusParams{
+		Status: status,
+		ID:     id,
+	}
+	if err := queries(ctx, r.DB).SetTapeCopyStatus(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+func (r *tapeCopyRepository) UpdateCondition(ctx context.Context, id int32, condition string) (*model.TapeCopy, error) {
+	params := database.UpdateTapeCopyConditionParams{
+		Condition: condition,
+		ID:        id,
+	}
+	dbCopy, err := queries(ctx, r.DB).UpdateTapeCopyCondition(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrCopyNotFound)
+	}
+	return toTapeCopyModel(dbCopy), nil
+}
+
+// Puts every rented copy back on the shelf, for when all rentals are deleted
+func (r *tapeCopyRepository) ReleaseAllRented(ctx context.Context) error {
+	if err := queries(ctx, r.DB).ReleaseRentedTapeCopies(ctx); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Helpers
+
+func toTapeCopyModel(dbCopy database.TapeCopy) *model.TapeCopy {
+	return &model.TapeCopy{
+		ID:         dbCopy.ID,
+		PublicID:   dbCopy.PublicID,
+		CreatedAt:  dbCopy.CreatedAt,
+		UpdatedAt:  dbCopy.UpdatedAt,
+		TapeID:     dbCopy.TapeID,
+		Barcode:    dbCopy.Barcode,
+		Condition:  dbCopy.Condition,
+		Status:     dbCopy.Status,
+		AcquiredAt: dbCopy.AcquiredAt,
+	}
+}
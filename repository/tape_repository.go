@@ -3,9 +3,9 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/database"
 	"github.com/rigofekete/vhs-club-mvc/model"
@@ -15,8 +15,13 @@ type TapeRepository interface {
 	Save(ctx context.Context, tape *model.Tape) (*model.Tape, error)
 	SaveBatch(ctx context.Context, tapes []*model.Tape) ([]*model.Tape, *int32, error)
 	GetAll(ctx context.Context) ([]*model.Tape, error)
+	List(ctx context.Context, filter *model.TapeFilter, cursor *model.TapeCursor, limit int32) ([]*model.Tape, error)
+	Count(ctx context.Context, filter *model.TapeFilter) (int64, error)
+	Search(ctx context.Context, tsQuery string, limit int32) ([]*model.Tape, error)
 	GetByID(ctx context.Context, id int32) (*model.Tape, error)
+	GetByIDForUpdate(ctx context.Context, id int32) (*model.Tape, error)
 	GetByPublicID(ctx context.Context, id uuid.UUID) (*model.Tape, error)
+	GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.Tape, error)
 	Update(ctx context.Context, updateTape *model.UpdateTape) (*model.Tape, error)
 	Delete(ctx context.Context, id int32) error
 	DeleteAll(ctx context.Context) error
@@ -27,13 +32,14 @@ type tapeRepository struct {
 	db *sql.DB
 }
 
-func NewTapeRepository() TapeRepository {
+func NewTapeRepository(db *sql.DB) TapeRepository {
 	return &tapeRepository{
-		DB: config.AppConfig.DB,
-		db: config.AppConfig.SQLDB,
+		DB: newQueries(db),
+		db: db,
 	}
 }
 
+// Also adds tape.Quantity copies with generated barcodes
 func (r *tapeRepository) Save(ctx context.Context, tape *model.Tape) (*model.Tape, error) {
 	// TODO: Consider doing a function to convert data to and from DAO (similar to the DTO in handler layer)
 	tapeParams := database.CreateTapeParams{
@@ -43,9 +49,9 @@ func (r *tapeRepository) Save(ctx context.Context, tape *model.Tape) (*model.Tap
 		Quantity: tape.Quantity,
 	}
 
-	dbTape, err := r.DB.CreateTape(context.Background(), tapeParams)
+	dbTape, err := queries(ctx, r.DB).CreateTape(ctx, tapeParams)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 
 	savedTape := &model.Tape{
@@ -72,13 +78,13 @@ func (r *tapeRepository) SaveBatch(ctx context.Context, tapes []*model.Tape) ([]
 			Quantity: tape.Quantity,
 		}
 
-		dbTape, err := r.DB.CreateTape(ctx, tapeParams)
+		dbTape, err := queries(ctx, r.DB).CreateTape(ctx, tapeParams)
 		if err != nil {
 			if isUniqueConstraintError(err) {
 				existingCount++
 				continue
 			} else {
-				return nil, nil, err
+				return nil, nil, mapDBError(err, nil)
 			}
 		}
 
@@ -99,9 +105,9 @@ func (r *tapeRepository) SaveBatch(ctx context.Context, tapes []*model.Tape) ([]
 }
 
 func (r *tapeRepository) GetAll(ctx context.Context) ([]*model.Tape, error) {
-	dbTapes, err := r.DB.GetTapes(context.Background())
+	dbTapes, err := queries(ctx, r.DB).GetTapes(ctx)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 	tapes := make([]*model.Tape, 0)
 	for _, tape := range dbTapes {
@@ -114,6 +120,85 @@ func (r *tapeRepository) GetAll(ctx context.Context) ([]*model.Tape, error) {
 			Director:  tape.Director,
 			Genre:     tape.Genre,
 			Quantity:  tape.Quantity,
+			RentedOut: tape.RentedOut,
+			OnHold:    tape.OnHold,
+		}
+		tapes = append(tapes, t)
+	}
+	return tapes, nil
+}
+
+func (r *tapeRepository) List(ctx context.Context, filter *model.TapeFilter, cursor *model.TapeCursor, limit int32) ([]*model.Tape, error) {
+	listParams := database.ListTapesParams{
+		Genre:         toNullString(filter.Genre),
+		Director:      toNullString(filter.Director),
+		AvailableOnly: filter.AvailableOnly,
+		Sort:          filter.Sort,
+		PageLimit:     limit,
+	}
+	if cursor != nil {
+		listParams.CursorPublicID = uuid.NullUUID{UUID: cursor.PublicID, Valid: true}
+		listParams.CursorCreatedAt = toNullTime(&cursor.CreatedAt)
+		listParams.CursorTitle = toNullString(&cursor.Title)
+	}
+
+	dbTapes, err := queries(ctx, r.DB).ListTapes(ctx, listParams)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+	tapes := make([]*model.Tape, 0, len(dbTapes))
+	for _, tape := range dbTapes {
+		t := &model.Tape{
+			ID:        tape.ID,
+			PublicID:  tape.PublicID,
+			CreatedAt: tape.CreatedAt,
+			UpdatedAt: tape.UpdatedAt,
+			Title:     tape.Title,
+			Director:  tape.Director,
+			Genre:     tape.Genre,
+			Quantity:  tape.Quantity,
+			RentedOut: tape.RentedOut,
+			OnHold:    tape.OnHold,
+		}
+		tapes = append(tapes, t)
+	}
+	return tapes, nil
+}
+
+func (r *tapeRepository) Count(ctx context.Context, filter *model.TapeFilter) (int64, error) {
+	countParams := database.CountTapesParams{
+		Genre:         toNullString(filter.Genre),
+		Director:      toNullString(filter.Director),
+		AvailableOnly: filter.AvailableOnly,
+	}
+	count, err := queries(ctx, r.DB).CountTapes(ctx, countParams)
+	return count, mapDBError(err, nil)
+}
+
+// tsQuery must already be in to_tsquery syntax, results come ordered by rank
+func (r *tapeRepository) Search(ctx context.Context, tsQuery string, limit int32) ([]*model.Tape, error) {
+	searchParams := database.SearchTapesParams{
+		Query:     tsQuery,
+		PageLimit: limit,
+	}
+
+	dbTapes, err := queries(ctx, r.DB).SearchTapes(ctx, searchParams)
+	if err != nil {
+		return nil, mapDBError(err, nil)
+	}
+	tapes := make([]*model.Tape, 0, len(dbTapes))
+	for _, tape := range dbTapes {
+		t := &model.Tape{
+			ID:        tape.ID,
+			PublicID:  tape.PublicID,
+			CreatedAt: tape.CreatedAt,
+			UpdatedAt: tape.UpdatedAt,
+			Title:     tape.Title,
+			Director:  tape.Director,
+			Genre:     tape.Genre,
+			Quantity:  tape.Quantity,
+			RentedOut: tape.RentedOut,
+			OnHold:    tape.OnHold,
 		}
 		tapes = append(tapes, t)
 	}
@@ -121,9 +206,9 @@ func (r *tapeRepository) GetAll(ctx context.Context) ([]*model.Tape, error) {
 }
 
 func (r *tapeRepository) GetByID(ctx context.Context, id int32) (*model.Tape, error) {
-	dbTape, err := r.DB.GetTapeByID(context.Background(), id)
+	dbTape, err := queries(ctx, r.DB).GetTapeByID(ctx, id)
 	if err != nil {
-		return nil, apperror.ErrTapeNotFound
+		return nil, mapDBError(err, apperror.ErrTapeNotFound)
 	}
 
 	tape := &model.Tape{
@@ -135,15 +220,35 @@ func (r *tapeRepository) GetByID(ctx context.Context, id int32) (*model.Tape, er
 		Director:  dbTape.Director,
 		Genre:     dbTape.Genre,
 		Quantity:  dbTape.Quantity,
+		RentedOut: dbTape.RentedOut,
+		OnHold:    dbTape.OnHold,
 	}
 
 	return tape, nil
 }
 
+// Locks the tape row until the transaction carried by ctx ends, must be called inside Transactor.WithinTx
+func (r *tapeRepository) GetByIDForUpdate(ctx context.Context, id int32) (*model.Tape, error) {
+	dbTape, err := queries(ctx, r.DB).GetTapeByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrTapeNotFound)
+	}
+	tape := &model.Tape{
+		ID:        dbTape.ID,
+		PublicID:  dbTape.PublicID,
+		CreatedAt: dbTape.CreatedAt,
+		UpdatedAt: dbTape.UpdatedAt,
+		Title:     dbTape.Title,
+		Director:  dbTape.Director,
+		Genre:     dbTape.Genre,
+	}
+	return tape, nil
+}
+
 func (r *tapeRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*model.Tape, error) {
-	dbTape, err := r.DB.GetTapeFromPublicID(ctx, id)
+	dbTape, err := queries(ctx, r.DB).GetTapeFromPublicID(ctx, id)
 	if err != nil {
-		return nil, apperror.ErrTapeNotFound
+		return nil, mapDBError(err, apperror.ErrTapeNotFound)
 	}
 	tape := &model.Tape{
 		ID:        dbTape.ID,
@@ -154,6 +259,26 @@ func (r *tapeRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*mode
 		Director:  dbTape.Director,
 		Genre:     dbTape.Genre,
 		Quantity:  dbTape.Quantity,
+		RentedOut: dbTape.RentedOut,
+		OnHold:    dbTape.OnHold,
+	}
+	return tape, nil
+}
+
+// Locks the tape row until the transaction carried by ctx ends, must be called inside Transactor.WithinTx
+func (r *tapeRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.Tape, error) {
+	dbTape, err := queries(ctx, r.DB).GetTapeFromPublicIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrTapeNotFound)
+	}
+	tape := &model.Tape{
+		ID:        dbTape.ID,
+		PublicID:  dbTape.PublicID,
+		CreatedAt: dbTape.CreatedAt,
+		UpdatedAt: dbTape.UpdatedAt,
+		Title:     dbTape.Title,
+		Director:  dbTape.Director,
+		Genre:     dbTape.Genre,
 	}
 	return tape, nil
 }
@@ -164,12 +289,11 @@ func (r *tapeRepository) Update(ctx context.Context, updateTape *model.UpdateTap
 		Title:    toNullString(updateTape.Title),
 		Director: toNullString(updateTape.Director),
 		Genre:    toNullString(updateTape.Genre),
-		Quantity: toNullInt32(updateTape.Quantity),
 	}
 
-	dbTape, err := r.DB.UpdateTape(context.Background(), dbUpdateParams)
+	dbTape, err := queries(ctx, r.DB).UpdateTape(ctx, dbUpdateParams)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, apperror.ErrTapeNotFound)
 	}
 
 	tape := &model.Tape{
@@ -181,23 +305,25 @@ func (r *tapeRepository) Update(ctx context.Context, updateTape *model.UpdateTap
 		Director:  dbTape.Director,
 		Genre:     dbTape.Genre,
 		Quantity:  dbTape.Quantity,
+		RentedOut: dbTape.RentedOut,
+		OnHold:    dbTape.OnHold,
 	}
 
 	return tape, nil
 }
 
 func (r *tapeRepository) Delete(ctx context.Context, id int32) error {
-	err := r.DB.DeleteTape(context.Background(), id)
+	err := queries(ctx, r.DB).DeleteTape(ctx, id)
 	if err != nil {
-		return err
+		return mapDBError(err, nil)
 	}
 	return nil
 }
 
 func (r *tapeRepository) DeleteAll(ctx context.Context) error {
-	err := r.DB.DeleteAllTapes(context.Background())
+	err := queries(ctx, r.DB).DeleteAllTapes(ctx)
 	if err != nil {
-		return err
+		return mapDBError(err, nil)
 	}
 	return nil
 }
@@ -218,6 +344,13 @@ func toNullInt32(i *int32) sql.NullInt32 {
 	return sql.NullInt32{Int32: *i, Valid: true}
 }
 
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{Valid: false}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
 // func toNullFloat64(f *float64) sql.NullFloat64 {
 // 	if f == nil {
 // 		return sql.NullFloat64{Valid: false}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/database"
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB sits between sqlc and the pool or transaction, so every query gets a span
+// named after the sqlc query, e.g. "db GetActiveRentCountByUser"
+type tracedDB struct {
+	db database.DBTX
+}
+
+func newQueries(db database.DBTX) *database.Queries {
+	return database.New(tracedDB{db: db})
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { tracing.End(span, err) }()
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+func (t tracedDB) PrepareContext(ctx context.Context, query string) (stmt *sql.Stmt, err error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { tracing.End(span, err) }()
+	return t.db.PrepareContext(ctx, query)
+}
+
+// The span covers the query round trip, reading the rows afterwards is not included
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer func() { tracing.End(span, err) }()
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	row := t.db.QueryRowContext(ctx, query, args...)
+	// sql.ErrNoRows only surfaces on Scan, so not found lookups are not marked as failed
+	tracing.End(span, row.Err())
+	return row
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return tracing.Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// sqlc starts every query with a "-- name: GetTape :one" comment
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "query"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
+)
+
+// Transactor runs a unit of work inside a single DB transaction.
+// Repository calls made with the ctx handed to fn join that transaction, so services
+// can group several repository operations without knowing about *sql.Tx.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type sqlTransactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) Transactor {
+	return &sqlTransactor{
+		db: db,
+	}
+}
+
+// Context key under which the active *sql.Tx is stored
+type txKey struct{}
+
+func (t *sqlTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// Nested units of work join the outer transaction instead of opening a new one
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	// The query spans of the unit of work nest under this one
+	ctx, span := tracing.Start(ctx, "db transaction")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapDBError(err, nil)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	// fn already classified its own errors, only the transaction bookkeeping is left
+	return mapDBError(tx.Commit(), nil)
+}
+
+func txFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
@@ -3,11 +3,8 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"errors"
-	"fmt"
 
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/database"
 	"github.com/rigofekete/vhs-club-mvc/model"
@@ -18,8 +15,17 @@ type UserRepository interface {
 	SaveBatch(ctx context.Context, users []*model.User) ([]*model.User, *int32, error)
 	GetByID(ctx context.Context, id int32) (*model.User, error)
 	GetByPublicID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetByUsername(ctx context.Context, username string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	GetAll(ctx context.Context) ([]*model.User, error)
+	Update(ctx context.Context, updateUser *model.UpdateUser) (*model.User, error)
+	UpdatePassword(ctx context.Context, id int32, hashedPassword string) error
+	GetStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error)
+	UpdateRole(ctx context.Context, id int32, role string) (*model.User, error)
+	SaveRoleChange(ctx context.Context, change *model.RoleChange) error
+	Disable(ctx context.Context, id int32) (*model.User, error)
+	Delete(ctx context.Context, id int32) error
 	DeleteAll(ctx context.Context) error
 }
 
@@ -28,10 +34,10 @@ type userRepository struct {
 	db *sql.DB
 }
 
-func NewUserRepository() UserRepository {
+func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{
-		DB: config.AppConfig.DB,
-		db: config.AppConfig.SQLDB,
+		DB: newQueries(db),
+		db: db,
 	}
 }
 
@@ -39,26 +45,20 @@ func (r *userRepository) Save(ctx context.Context, user *model.User) (*model.Use
 	userParams := database.CreateUserParams{
 		Username:       user.Username,
 		Email:          user.Email,
+		Role:           user.Role,
 		HashedPassword: user.HashedPassword,
 	}
 
-	dbUser, err := r.DB.CreateUser(ctx, userParams)
+	dbUser, err := queries(ctx, r.DB).CreateUser(ctx, userParams)
 	if err != nil {
 		if isUniqueConstraintError(err) {
 			return nil, apperror.ErrUserExists
 		} else {
-			return nil, err
+			return nil, mapDBError(err, nil)
 		}
 	}
 
-	createdUser := &model.User{
-		ID:        dbUser.ID,
-		PublicID:  dbUser.PublicID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Username:  dbUser.Username,
-		Email:     dbUser.Email,
-	}
+	createdUser := toUserModel(dbUser)
 	return createdUser, nil
 }
 
@@ -69,27 +69,21 @@ func (r *userRepository) SaveBatch(ctx context.Context, users []*model.User) ([]
 		userParams := database.CreateUserParams{
 			Username:       user.Username,
 			Email:          user.Email,
+			Role:           user.Role,
 			HashedPassword: user.HashedPassword,
 		}
 
-		dbUser, err := r.DB.CreateUser(ctx, userParams)
+		dbUser, err := queries(ctx, r.DB).CreateUser(ctx, userParams)
 		if err != nil {
 			if isUniqueConstraintError(err) {
 				existingCount++
 				continue
 			} else {
-				return nil, nil, err
+				return nil, nil, mapDBError(err, nil)
 			}
 		}
 
-		createdUser := &model.User{
-			ID:        dbUser.ID,
-			PublicID:  dbUser.PublicID,
-			CreatedAt: dbUser.CreatedAt,
-			UpdatedAt: dbUser.UpdatedAt,
-			Username:  dbUser.Username,
-			Email:     dbUser.Email,
-		}
+		createdUser := toUserModel(dbUser)
 		createdUsers = append(createdUsers, createdUser)
 	}
 
@@ -97,86 +91,169 @@ func (r *userRepository) SaveBatch(ctx context.Context, users []*model.User) ([]
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id int32) (*model.User, error) {
-	dbUser, err := r.DB.GetUserByID(ctx, id)
+	dbUser, err := queries(ctx, r.DB).GetUserByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", apperror.ErrUserNotFound, err)
-	}
-	user := &model.User{
-		ID:        dbUser.ID,
-		PublicID:  dbUser.PublicID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Username:  dbUser.Username,
-		Email:     dbUser.Email,
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
 	}
+	user := toUserModel(dbUser)
 	return user, nil
 }
 
 func (r *userRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*model.User, error) {
-	dbUser, err := r.DB.GetUserByPublicID(ctx, id)
+	dbUser, err := queries(ctx, r.DB).GetUserByPublicID(ctx, id)
 	if err != nil {
-		return nil, apperror.ErrUserNotFound
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
 	}
 
-	user := &model.User{
-		ID:        dbUser.ID,
-		PublicID:  dbUser.PublicID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Username:  dbUser.Username,
-		Email:     dbUser.Email,
+	user := toUserModel(dbUser)
+
+	return user, nil
+}
+
+// Locks the user row until the transaction carried by ctx ends, must be called inside Transactor.WithinTx
+func (r *userRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	dbUser, err := queries(ctx, r.DB).GetUserByPublicIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
 	}
 
+	user := toUserModel(dbUser)
+
 	return user, nil
 }
 
 func (r *userRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
-	dbUser, err := r.DB.GetUserByUsername(ctx, username)
+	dbUser, err := queries(ctx, r.DB).GetUserByUsername(ctx, username)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, apperror.ErrUserNotFound
-		}
-		return nil, err
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
 	}
 
-	user := &model.User{
-		ID:             dbUser.ID,
-		PublicID:       dbUser.PublicID,
-		CreatedAt:      dbUser.CreatedAt,
-		UpdatedAt:      dbUser.UpdatedAt,
-		Username:       dbUser.Username,
-		Email:          dbUser.Email,
-		Role:           dbUser.Role,
-		HashedPassword: dbUser.HashedPassword,
-	}
+	user := toUserModel(dbUser)
 
 	return user, nil
 }
 
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	dbUser, err := queries(ctx, r.DB).GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
+	}
+	return toUserModel(dbUser), nil
+}
+
 func (r *userRepository) GetAll(ctx context.Context) ([]*model.User, error) {
-	dbUsers, err := r.DB.GetUsers(ctx)
+	dbUsers, err := queries(ctx, r.DB).GetUsers(ctx)
 	if err != nil {
-		return nil, err
+		return nil, mapDBError(err, nil)
 	}
 	users := make([]*model.User, 0)
 	for _, user := range dbUsers {
-		u := &model.User{
-			ID:        user.ID,
-			PublicID:  user.PublicID,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-			Username:  user.Username,
-			Email:     user.Email,
-		}
+		u := toUserModel(user)
 		users = append(users, u)
 	}
 	return users, nil
 }
 
+// Nil fields keep their stored value, an email taken by another account is reported as ErrEmailExists
+func (r *userRepository) Update(ctx context.Context, updateUser *model.UpdateUser) (*model.User, error) {
+	params := database.UpdateUserParams{
+		ID:    updateUser.ID,
+		Email: toNullString(updateUser.Email),
+	}
+	dbUser, err := queries(ctx, r.DB).UpdateUser(ctx, params)
+	if err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, apperror.ErrEmailExists
+		}
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
+	}
+
+	user := toUserModel(dbUser)
+	return user, nil
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id int32, hashedPassword string) error {
+	params := database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             id,
+	}
+	if err := queries(ctx, r.DB).UpdateUserPassword(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+func (r *userRepository) GetStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error) {
+	status, err := queries(ctx, r.DB).GetUserStatus(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
+	}
+	return &model.AccountStatus{
+		Role:     status.Role,
+		Disabled: status.DisabledAt.Valid,
+	}, nil
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id int32, role string) (*model.User, error) {
+	params := database.UpdateUserRoleParams{
+		Role: role,
+		ID:   id,
+	}
+	dbUser, err := queries(ctx, r.DB).UpdateUserRole(ctx, params)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
+	}
+	return toUserModel(dbUser), nil
+}
+
+func (r *userRepository) SaveRoleChange(ctx context.Context, change *model.RoleChange) error {
+	params := database.CreateUserRoleChangeParams{
+		UserID:    change.UserID,
+		ChangedBy: change.ChangedBy,
+		OldRole:   change.OldRole,
+		NewRole:   change.NewRole,
+	}
+	if err := queries(ctx, r.DB).CreateUserRoleChange(ctx, params); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
+// Disabling an already disabled user keeps the original disabled_at
+func (r *userRepository) Disable(ctx context.Context, id int32) (*model.User, error) {
+	dbUser, err := queries(ctx, r.DB).DisableUser(ctx, id)
+	if err != nil {
+		return nil, mapDBError(err, apperror.ErrUserNotFound)
+	}
+	return toUserModel(dbUser), nil
+}
+
+// Refresh tokens and reservations are deleted with the user, past rentals keep a NULL user_id
+func (r *userRepository) Delete(ctx context.Context, id int32) error {
+	if err := queries(ctx, r.DB).DeleteUser(ctx, id); err != nil {
+		return mapDBError(err, nil)
+	}
+	return nil
+}
+
 func (r *userRepository) DeleteAll(ctx context.Context) error {
-	err := r.DB.DeleteAllUsers(ctx)
+	err := queries(ctx, r.DB).DeleteAllUsers(ctx)
 	if err != nil {
-		return err
+		return mapDBError(err, nil)
+	}
+	return mapDBError(err, nil)
+}
+
+func toUserModel(dbUser database.User) *model.User {
+	return &model.User{
+		ID:             dbUser.ID,
+		PublicID:       dbUser.PublicID,
+		CreatedAt:      dbUser.CreatedAt,
+		UpdatedAt:      dbUser.UpdatedAt,
+		Username:       dbUser.Username,
+		Email:          dbUser.Email,
+		Role:           dbUser.Role,
+		HashedPassword: dbUser.HashedPassword,
+		DisabledAt:     dbUser.DisabledAt,
 	}
-	return err
 }
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/internal/logging"
+	"github.com/rigofekete/vhs-club-mvc/internal/mail"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/repository"
+)
+
+type PasswordResetService interface {
+	RequestReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// Blocks until the reset mails sent in the background are out, or their send timed out
+	Wait()
+}
+
+// Upper bound of a background send, so a hanging mail server can't hold up a shutdown forever
+const resetMailTimeout = 30 * time.Second
+
+type passwordResetService struct {
+	userRepo  repository.UserRepository
+	resetRepo repository.PasswordResetRepository
+	tokenRepo repository.RefreshTokenRepository
+	tx        repository.Transactor
+	mailer    mail.Mailer
+	policy    PasswordResetPolicy
+	guard     LoginGuard
+	// Mails still being sent by RequestReset
+	sending sync.WaitGroup
+}
+
+// Lifetime of reset links and the page of the web app they open
+type PasswordResetPolicy struct {
+	TTL time.Duration
+	// The token is added as the token query parameter
+	URL string
+}
+
+func NewPasswordResetService(u repository.UserRepository, r repository.PasswordResetRepository, t repository.RefreshTokenRepository, tx repository.Transactor, mailer mail.Mailer, policy PasswordResetPolicy, guard LoginGuard) PasswordResetService {
+	return &passwordResetService{
+		userRepo:  u,
+		resetRepo: r,
+		tokenRepo: t,
+		tx:        tx,
+		mailer:    mailer,
+		policy:    policy,
+		guard:     guard,
+	}
+}
+
+// Emails a reset link to the account with this email. Unknown emails and disabled accounts
+// succeed just the same. Only the email lookup happens before the response, the token is
+// stored and mailed in the background, so the response time doesn't tell them apart either.
+// A failure there is only logged. Wait lets a shutdown finish the sends.
+func (s *passwordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if errors.Is(err, apperror.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt.Valid {
+		return nil
+	}
+
+	// Not tied to the request, it ends as soon as the response is written
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resetMailTimeout)
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		defer cancel()
+		if err := s.sendResetLink(sendCtx, user); err != nil {
+			logging.FromContext(sendCtx).Error("error sending password reset mail", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (s *passwordResetService) sendResetLink(ctx context.Context, user *model.User) error {
+	token, err := auth.MakeResetToken()
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.Save(ctx, &model.PasswordResetToken{
+		TokenHash: auth.HashResetToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.policy.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(s.policy.URL)
+	if err != nil {
+		return fmt.Errorf("invalid password reset URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your VHS Club password",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to choose a new password:\n\n%s\n\n"+
+			"The link works once and expires in %d minutes. If you did not ask for it, you can ignore this email.\n",
+			user.Username, link, int(s.policy.TTL.Minutes())),
+	})
+}
+
+func (s *passwordResetService) Wait() {
+	s.sending.Wait()
+}
+
+// Sets the new password, uses up every reset link of the user and logs them out everywhere.
+// Unknown, expired and used tokens all get ErrInvalidResetToken.
+func (s *passwordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// Hashed before the row lock is taken, argon2id is slow on purpose
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	var user *model.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := s.resetRepo.GetByHashForUpdate(ctx, auth.HashResetToken(token))
+		if err != nil {
+			return err
+		}
+		if stored.UsedAt.Valid || time.Now().UTC().After(stored.ExpiresAt) {
+			return apperror.ErrInvalidResetToken
+		}
+
+		user, err = s.userRepo.GetByID(ctx, stored.UserID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt.Valid {
+			return apperror.ErrAccountDisabled
+		}
+
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		if err := s.resetRepo.UseAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeAllForUser(ctx, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Whoever locked the account guessing the old password no longer keeps the owner out
+	return s.guard.Succeeded(ctx, user.Username)
+}
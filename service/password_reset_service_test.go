@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/internal/mail"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testResetPolicy = service.PasswordResetPolicy{
+	TTL: 30 * time.Minute,
+	URL: "https://vhsclub.test/reset-password",
+}
+
+type mockPasswordResetRepository struct {
+	mock.Mock
+}
+
+func NewPasswordResetMockRepository() *mockPasswordResetRepository {
+	return &mockPasswordResetRepository{}
+}
+
+func (m *mockPasswordResetRepository) Save(ctx context.Context, token *model.PasswordResetToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *mockPasswordResetRepository) GetByHashForUpdate(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if t := args.Get(0); t != nil {
+		return t.(*model.PasswordResetToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockPasswordResetRepository) UseAllForUser(ctx context.Context, userID int32) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// Hands every sent message to the test, mails go out in the background
+type fakeMailer struct {
+	sent chan mail.Message
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{sent: make(chan mail.Message, 1)}
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+func Test_RequestReset_UnknownEmail(t *testing.T) {
+	mockUserRepo := NewUserMockRepository()
+	mockResetRepo := NewPasswordResetMockRepository()
+	mailer := newFakeMailer()
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByEmail", ctx, "nobody@nowhere.org").Return(nil, apperror.ErrUserNotFound)
+
+	svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, NewRefreshTokenMockRepository(), mockTransactor{}, mailer, testResetPolicy, &fakeLoginGuard{})
+	err := svc.RequestReset(ctx, "nobody@nowhere.org")
+
+	assert.Nil(t, err)
+	mockResetRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	assert.Empty(t, mailer.sent)
+}
+
+func Test_RequestReset_MailsLinkForStoredHash(t *testing.T) {
+	mockUserRepo := NewUserMockRepository()
+	mockResetRepo := NewPasswordResetMockRepository()
+	mailer := newFakeMailer()
+
+	user := &model.User{ID: 21, PublicID: uuid.New(), Username: "AdaLovelace", Email: "ada@engines.org"}
+	ctx := context.Background()
+	mockUserRepo.On("GetByEmail", ctx, user.Email).Return(user, nil)
+	var saved *model.PasswordResetToken
+	// Stored in the background with a context of its own
+	mockResetRepo.On("Save", mock.Anything, mock.AnythingOfType("*model.PasswordResetToken")).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(*model.PasswordResetToken)
+	}).Return(nil)
+
+	svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, NewRefreshTokenMockRepository(), mockTransactor{}, mailer, testResetPolicy, &fakeLoginGuard{})
+	err := svc.RequestReset(ctx, user.Email)
+	assert.Nil(t, err)
+
+	var msg mail.Message
+	select {
+	case msg = <-mailer.sent:
+	case <-time.After(time.Second):
+		t.Fatal("reset mail was not sent")
+	}
+	assert.Equal(t, user.Email, msg.To)
+
+	link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(msg.Body))
+	assert.Nil(t, err)
+	token := link.Query().Get("token")
+	// Only the hash of the mailed token is stored
+	assert.Equal(t, auth.HashResetToken(token), saved.TokenHash)
+	assert.Equal(t, user.ID, saved.UserID)
+	assert.WithinDuration(t, time.Now().UTC().Add(testResetPolicy.TTL), saved.ExpiresAt, time.Minute)
+}
+
+// The token is stored after the response, so a failed save can only be logged
+func Test_RequestReset_SaveFailureIsNotReturned(t *testing.T) {
+	mockUserRepo := NewUserMockRepository()
+	mockResetRepo := NewPasswordResetMockRepository()
+	mailer := newFakeMailer()
+
+	user := &model.User{ID: 21, PublicID: uuid.New(), Username: "AdaLovelace", Email: "ada@engines.org"}
+	ctx := context.Background()
+	mockUserRepo.On("GetByEmail", ctx, user.Email).Return(user, nil)
+	mockResetRepo.On("Save", mock.Anything, mock.AnythingOfType("*model.PasswordResetToken")).Return(errors.New("connection refused"))
+
+	svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, NewRefreshTokenMockRepository(), mockTransactor{}, mailer, testResetPolicy, &fakeLoginGuard{})
+	err := svc.RequestReset(ctx, user.Email)
+	svc.Wait()
+
+	assert.Nil(t, err)
+	mockResetRepo.AssertExpectations(t)
+	assert.Empty(t, mailer.sent)
+}
+
+// Holds every send until the test releases it
+type blockingMailer struct {
+	release     chan struct{}
+	hasDeadline bool
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	_, m.hasDeadline = ctx.Deadline()
+	<-m.release
+	return nil
+}
+
+func Test_RequestReset_WaitFinishesSend(t *testing.T) {
+	mockUserRepo := NewUserMockRepository()
+	mockResetRepo := NewPasswordResetMockRepository()
+	mailer := &blockingMailer{release: make(chan struct{})}
+
+	user := &model.User{ID: 21, PublicID: uuid.New(), Username: "AdaLovelace", Email: "ada@engines.org"}
+	ctx := context.Background()
+	mockUserRepo.On("GetByEmail", ctx, user.Email).Return(user, nil)
+	mockResetRepo.On("Save", mock.Anything, mock.AnythingOfType("*model.PasswordResetToken")).Return(nil)
+
+	svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, NewRefreshTokenMockRepository(), mockTransactor{}, mailer, testResetPolicy, &fakeLoginGuard{})
+	assert.Nil(t, svc.RequestReset(ctx, user.Email))
+
+	waited := make(chan struct{})
+	go func() {
+		svc.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while the mail was still being sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(mailer.release)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the mail was sent")
+	}
+	// A hanging mail server can't block the shutdown forever
+	assert.True(t, mailer.hasDeadline)
+}
+
+func Test_ResetPassword_Success(t *testing.T) {
+	mockUserRepo := NewUserMockRepository()
+	mockResetRepo := NewPasswordResetMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	token := "mailed-token"
+	userID := int32(21)
+	newPassword := "analytical1843"
+	ctx := context.Background()
+
+	mockResetRepo.On("GetByHashForUpdate", ctx, auth.HashResetToken(token)).Return(&model.PasswordResetToken{
+		ID:        3,
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(time.Minute),
+	}, nil)
+	mockUserRepo.On("GetByID", ctx, userID).Return(&model.User{ID: userID, Username: "AdaLovelace"}, nil)
+	mockUserRepo.On("UpdatePassword", ctx, userID, mock.MatchedBy(func(hash string) bool {
+		valid, err := auth.CheckPasswordHash(newPassword, hash)
+		return err == nil && valid
+	})).Return(nil)
+	mockResetRepo.On("UseAllForUser", ctx, userID).Return(nil)
+	mockTokenRepo.On("RevokeAllForUser", ctx, userID).Return(nil)
+
+	guard := &fakeLoginGuard{}
+	svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, mockTokenRepo, mockTransactor{}, newFakeMailer(), testResetPolicy, guard)
+	err := svc.ResetPassword(ctx, token, newPassword)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"AdaLovelace"}, guard.succeeded)
+	mockUserRepo.AssertExpectations(t)
+	mockResetRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_ResetPassword_UsedOrExpiredToken(t *testing.T) {
+	tests := map[string]*model.PasswordResetToken{
+		"used": {
+			UserID:    21,
+			ExpiresAt: time.Now().UTC().Add(time.Minute),
+			UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		},
+		"expired": {
+			UserID:    21,
+			ExpiresAt: time.Now().UTC().Add(-time.Minute),
+		},
+	}
+
+	for name, stored := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockUserRepo := NewUserMockRepository()
+			mockResetRepo := NewPasswordResetMockRepository()
+
+			ctx := context.Background()
+			mockResetRepo.On("GetByHashForUpdate", ctx, auth.HashResetToken("mailed-token")).Return(stored, nil)
+
+			svc := service.NewPasswordResetService(mockUserRepo, mockResetRepo, NewRefreshTokenMockRepository(), mockTransactor{}, newFakeMailer(), testResetPolicy, &fakeLoginGuard{})
+			err := svc.ResetPassword(ctx, "mailed-token", "analytical1843")
+
+			assert.ErrorIs(t, err, apperror.ErrInvalidResetToken)
+			mockUserRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
+	"math"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/metrics"
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
 	"github.com/rigofekete/vhs-club-mvc/model"
 	"github.com/rigofekete/vhs-club-mvc/repository"
 )
@@ -12,91 +16,335 @@ import (
 type RentalService interface {
 	RentTape(ctx context.Context, tapeID string, userID string) (*model.Rental, error)
 	ReturnTape(ctx context.Context, userID, rentalID string) error
+	RenewRental(ctx context.Context, userID, rentalID string) (*model.Rental, error)
 	GetAllActiveRentals(ctx context.Context) ([]*model.Rental, error)
+	GetOverdueRentals(ctx context.Context) ([]*model.Rental, error)
+	PayLateFee(ctx context.Context, rentalID string) error
+	GetRentalHistory(ctx context.Context, userID string, filter *model.RentalFilter) ([]*model.Rental, error)
 	DeleteAllRentals(ctx context.Context) error
 }
 
 type rentalService struct {
-	tapeRepo   repository.TapeRepository
-	userRepo   repository.UserRepository
-	rentalRepo repository.RentalRepository
+	tapeRepo        repository.TapeRepository
+	userRepo        repository.UserRepository
+	rentalRepo      repository.RentalRepository
+	reservationRepo repository.ReservationRepository
+	copyRepo        repository.TapeCopyRepository
+	tx              repository.Transactor
+	policy          RentalPolicy
+	metrics         RentalMetrics
 }
 
-func NewRentalService(r repository.RentalRepository, t repository.TapeRepository, u repository.UserRepository) RentalService {
+// Club rules that can be tuned per deployment
+type RentalPolicy struct {
+	// Time a member has to return a tape, due_at is set from it when renting
+	Period             time.Duration
+	LateFeePerDayCents int32
+	// Times a member can push the due date back by another Period
+	MaxRenewals int32
+	// Tapes a member can have out at the same time
+	MaxRentalsPerUser int32
+}
+
+// Rental events counted for monitoring, implemented by internal/metrics
+type RentalMetrics interface {
+	RentalCreated()
+	RentalReturned()
+	RentalRejected(reason string)
+}
+
+func NewRentalService(r repository.RentalRepository, t repository.TapeRepository, u repository.UserRepository, res repository.ReservationRepository, c repository.TapeCopyRepository, tx repository.Transactor, policy RentalPolicy, m RentalMetrics) RentalService {
 	return &rentalService{
-		rentalRepo: r,
-		tapeRepo:   t,
-		userRepo:   u,
+		rentalRepo:      r,
+		tapeRepo:        t,
+		userRepo:        u,
+		reservationRepo: res,
+		copyRepo:        c,
+		tx:              tx,
+		policy:          policy,
+		metrics:         m,
 	}
 }
 
-// Business logic local constants
-const maxRentalsPerUser = 2
+func (s *rentalService) RentTape(ctx context.Context, tapePublicID, userPublicID string) (_ *model.Rental, err error) {
+	ctx, span := tracing.Start(ctx, "RentalService.RentTape")
+	defer func() { tracing.End(span, err) }()
 
-func (s *rentalService) RentTape(ctx context.Context, tapePublicID, userPublicID string) (*model.Rental, error) {
-	tapeUUID, err := uuid.Parse(tapePublicID)
+	tapeUUID, err := parseID(tapePublicID)
 	if err != nil {
 		return nil, err
 	}
-	userUUID, err := uuid.Parse(userPublicID)
+	userUUID, err := parseID(userPublicID)
 	if err != nil {
 		return nil, err
 	}
 
-	tape, err := s.tapeRepo.GetByPublicID(ctx, tapeUUID)
+	// The tape and user rows stay locked until the rental is saved, so concurrent
+	// RentTape calls for the same tape or user are serialized and cannot both pass
+	// the availability and per user limit checks
+	var rental *model.Rental
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tape, err := s.tapeRepo.GetByPublicIDForUpdate(ctx, tapeUUID)
+		if err != nil {
+			return err
+		}
+
+		user, err := s.userRepo.GetByPublicIDForUpdate(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		standing, err := s.rentalRepo.GetStanding(ctx, user.ID, now)
+		if err != nil {
+			return err
+		}
+
+		if standing.OverdueCount > 0 || standing.UnpaidFeesCents > 0 {
+			return apperror.ErrRentalBlocked
+		}
+
+		freeCopies, err := syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, now)
+		if err != nil {
+			return err
+		}
+
+		// A copy held for this user's reservation can be rented even when no other copy is free
+		reservation, err := s.reservationRepo.GetOpen(ctx, user.ID, tape.ID)
+		if err != nil && !errors.Is(err, apperror.ErrReservationNotFound) {
+			return err
+		}
+		hasHold := err == nil && reservation.Status == model.ReservationStatusHeld
+
+		if !hasHold && freeCopies <= 0 {
+			return apperror.ErrTapeUnavailable
+		}
+
+		countByUser, err := s.rentalRepo.GetActiveRentCountByUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if int32(*countByUser) >= s.policy.MaxRentalsPerUser {
+			return apperror.ErrMaxRentalsPerUser
+		}
+
+		// A held copy is not set aside physically, any copy on the shelf will do
+		tapeCopy, err := s.copyRepo.GetAvailable(ctx, tape.ID)
+		if err != nil {
+			return err
+		}
+
+		rental, err = s.rentalRepo.Save(ctx, tape.ID, user.ID, tapeCopy.ID, now.Add(s.policy.Period))
+		if err != nil {
+			return err
+		}
+
+		if err := s.copyRepo.SetStatus(ctx, tapeCopy.ID, model.CopyStatusRented); err != nil {
+			return err
+		}
+
+		if hasHold {
+			return s.reservationRepo.Fulfill(ctx, reservation.ID)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, apperror.ErrTapeUnavailable):
+		s.metrics.RentalRejected(metrics.ReasonTapeUnavailable)
+	case errors.Is(err, apperror.ErrMaxRentalsPerUser):
+		s.metrics.RentalRejected(metrics.ReasonMaxRentalsPerUser)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+	s.metrics.RentalCreated()
+	return rental, nil
+}
+
+func (s *rentalService) ReturnTape(ctx context.Context, userPublicID, rentalPublicID string) (err error) {
+	ctx, span := tracing.Start(ctx, "RentalService.ReturnTape")
+	defer func() { tracing.End(span, err) }()
+
+	rentalUUID, err := parseID(rentalPublicID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	countByTape, err := s.rentalRepo.GetActiveRentCountByTape(ctx, tape.ID)
+	userUUID, err := parseID(userPublicID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if int32(*countByTape) >= tape.Quantity {
-		return nil, apperror.ErrTapeUnavailable
+	// The freed copy goes on hold for the first waiting reservation in the same transaction
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		rental, err := s.rentalRepo.GetActiveForUpdate(ctx, rentalUUID, user.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		lateFee := lateFeeCents(rental.DueAt, now, s.policy.LateFeePerDayCents)
+		if err := s.rentalRepo.ReturnTape(ctx, rental.ID, now, lateFee); err != nil {
+			return err
+		}
+
+		tape, err := s.tapeRepo.GetByIDForUpdate(ctx, rental.TapeID)
+		if err != nil {
+			return err
+		}
+
+		if rental.CopyID.Valid {
+			if err := s.copyRepo.SetStatus(ctx, rental.CopyID.Int32, model.CopyStatusAvailable); err != nil {
+				return err
+			}
+		}
+
+		_, err = syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, now)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	countByUser, err := s.rentalRepo.GetActiveRentCountByUser(ctx, user.ID)
+	s.metrics.RentalReturned()
+	return nil
+}
+
+// Pushes the due date back by one rental period, counted from the current due date.
+// Refused once the renewal limit is reached, when the tape is already overdue or when
+// another member is waiting for the tape.
+func (s *rentalService) RenewRental(ctx context.Context, userPublicID, rentalPublicID string) (_ *model.Rental, err error) {
+	ctx, span := tracing.Start(ctx, "RentalService.RenewRental")
+	defer func() { tracing.End(span, err) }()
+
+	rentalUUID, err := parseID(rentalPublicID)
 	if err != nil {
 		return nil, err
 	}
 
-	if int32(*countByUser) >= maxRentalsPerUser {
-		return nil, apperror.ErrMaxRentalsPerUser
+	userUUID, err := parseID(userPublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rental *model.Rental
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		// Same lock order as ReturnTape, the rental row first and then the tape
+		activeRental, err := s.rentalRepo.GetActiveForUpdate(ctx, rentalUUID, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if activeRental.Renewals >= s.policy.MaxRenewals {
+			return apperror.ErrRenewalLimit
+		}
+
+		now := time.Now().UTC()
+		if now.After(activeRental.DueAt) {
+			return apperror.ErrRenewalOverdue
+		}
+
+		tape, err := s.tapeRepo.GetByIDForUpdate(ctx, activeRental.TapeID)
+		if err != nil {
+			return err
+		}
+
+		// Free copies go to the queue first, whoever is still waiting after that needs this one back
+		if _, err := syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, now); err != nil {
+			return err
+		}
+
+		waiting, err := s.reservationRepo.CountWaitingByTape(ctx, tape.ID)
+		if err != nil {
+			return err
+		}
+
+		if waiting > 0 {
+			return apperror.ErrRenewalReserved
+		}
+
+		rental, err = s.rentalRepo.Renew(ctx, activeRental.ID, activeRental.DueAt.Add(s.policy.Period))
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.rentalRepo.Save(ctx, tape.ID, user.ID)
+	return rental, nil
 }
 
-func (s *rentalService) ReturnTape(ctx context.Context, userPublicID, rentalPublicID string) error {
-	rentalUUID, err := uuid.Parse(rentalPublicID)
+func (s *rentalService) GetAllActiveRentals(ctx context.Context) ([]*model.Rental, error) {
+	return s.rentalRepo.GetAllActive(ctx)
+}
+
+func (s *rentalService) GetOverdueRentals(ctx context.Context) ([]*model.Rental, error) {
+	return s.rentalRepo.GetOverdue(ctx, time.Now().UTC())
+}
+
+// Settles the late fee of a returned rental, e.g. once the member paid at the counter
+func (s *rentalService) PayLateFee(ctx context.Context, rentalPublicID string) error {
+	rentalUUID, err := parseID(rentalPublicID)
 	if err != nil {
 		return err
 	}
+	return s.rentalRepo.PayLateFee(ctx, rentalUUID)
+}
 
-	userUUID, err := uuid.Parse(userPublicID)
+func (s *rentalService) GetRentalHistory(ctx context.Context, userPublicID string, filter *model.RentalFilter) ([]*model.Rental, error) {
+	userUUID, err := parseID(userPublicID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	user, err := s.userRepo.GetByPublicID(ctx, userUUID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.rentalRepo.ReturnTape(ctx, rentalUUID, user.ID)
-}
+	if filter.TapePublicID != nil {
+		tape, err := s.tapeRepo.GetByPublicID(ctx, *filter.TapePublicID)
+		if err != nil {
+			return nil, err
+		}
+		filter.TapeID = &tape.ID
+	}
 
-func (s *rentalService) GetAllActiveRentals(ctx context.Context) ([]*model.Rental, error) {
-	return s.rentalRepo.GetAllActive(ctx)
+	return s.rentalRepo.GetHistoryByUser(ctx, user.ID, filter)
 }
 
 func (s *rentalService) DeleteAllRentals(ctx context.Context) error {
-	return s.rentalRepo.DeleteAllRentals(ctx)
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.rentalRepo.DeleteAllRentals(ctx); err != nil {
+			return err
+		}
+		return s.copyRepo.ReleaseAllRented(ctx)
+	})
+}
+
+// Helpers
+
+// Every started day past the due date is charged in full. Computed in int64 and capped at the
+// largest fee late_fee_cents can hold, a tape years overdue must not wrap around to a refund.
+func lateFeeCents(dueAt, returnedAt time.Time, perDayCents int32) int32 {
+	if !returnedAt.After(dueAt) {
+		return 0
+	}
+	lateDays := int64((returnedAt.Sub(dueAt) + 24*time.Hour - 1) / (24 * time.Hour))
+	fee := lateDays * int64(perDayCents)
+	if fee > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(fee)
 }
@@ -2,11 +2,18 @@ package service_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/internal/metrics"
 	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/repository"
 	"github.com/rigofekete/vhs-club-mvc/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -20,16 +27,53 @@ func NewRentalMockRepository() *mockRentalRepository {
 	return &mockRentalRepository{}
 }
 
-func (m *mockRentalRepository) Save(ctx context.Context, userID, tapeID int32) (*model.Rental, error) {
-	args := m.Called(ctx, userID, tapeID)
+func (m *mockRentalRepository) Save(ctx context.Context, tapeID, userID, copyID int32, dueAt time.Time) (*model.Rental, error) {
+	args := m.Called(ctx, tapeID, userID, copyID, dueAt)
 	if r := args.Get(0); r != nil {
 		return r.(*model.Rental), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *mockRentalRepository) ReturnTape(ctx context.Context, rentalID uuid.UUID, userID int32) error {
+func (m *mockRentalRepository) GetActiveForUpdate(ctx context.Context, rentalID uuid.UUID, userID int32) (*model.Rental, error) {
 	args := m.Called(ctx, rentalID, userID)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Rental), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRentalRepository) ReturnTape(ctx context.Context, id int32, returnedAt time.Time, lateFeeCents int32) error {
+	args := m.Called(ctx, id, returnedAt, lateFeeCents)
+	return args.Error(0)
+}
+
+func (m *mockRentalRepository) Renew(ctx context.Context, id int32, dueAt time.Time) (*model.Rental, error) {
+	args := m.Called(ctx, id, dueAt)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Rental), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRentalRepository) GetOverdue(ctx context.Context, now time.Time) ([]*model.Rental, error) {
+	args := m.Called(ctx, now)
+	if rentals := args.Get(0); rentals != nil {
+		return rentals.([]*model.Rental), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRentalRepository) GetStanding(ctx context.Context, userID int32, now time.Time) (*model.RentalStanding, error) {
+	args := m.Called(ctx, userID, now)
+	if standing := args.Get(0); standing != nil {
+		return standing.(*model.RentalStanding), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRentalRepository) PayLateFee(ctx context.Context, rentalID uuid.UUID) error {
+	args := m.Called(ctx, rentalID)
 	return args.Error(0)
 }
 
@@ -41,10 +85,10 @@ func (m *mockRentalRepository) GetAllActive(ctx context.Context) ([]*model.Renta
 	return nil, args.Error(1)
 }
 
-func (m *mockRentalRepository) GetActiveRentCountByTape(ctx context.Context, id int32) (*int64, error) {
-	args := m.Called(ctx, id)
-	if count := args.Get(0); count != nil {
-		return count.(*int64), args.Error(1)
+func (m *mockRentalRepository) GetHistoryByUser(ctx context.Context, userID int32, filter *model.RentalFilter) ([]*model.Rental, error) {
+	args := m.Called(ctx, userID, filter)
+	if rentals := args.Get(0); rentals != nil {
+		return rentals.([]*model.Rental), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
@@ -62,17 +106,62 @@ func (m *mockRentalRepository) DeleteAllRentals(ctx context.Context) error {
 	return args.Error(0)
 }
 
+var testRentalPolicy = service.RentalPolicy{
+	Period:             7 * 24 * time.Hour,
+	LateFeePerDayCents: 150,
+	MaxRenewals:        2,
+	MaxRentalsPerUser:  2,
+}
+
+// Runs the unit of work in place, repository mocks see the caller's ctx unchanged
+type mockTransactor struct{}
+
+func (mockTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// Traced service methods hand their repositories a ctx derived from the caller's one,
+// carrying the method's span
+var tracedCtx = mock.Anything
+
+// Records rental events, safe for the concurrent tests
+type fakeRentalMetrics struct {
+	mu       sync.Mutex
+	created  int
+	returned int
+	rejected []string
+}
+
+func (m *fakeRentalMetrics) RentalCreated() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.created++
+}
+
+func (m *fakeRentalMetrics) RentalReturned() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.returned++
+}
+
+func (m *fakeRentalMetrics) RentalRejected(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected = append(m.rejected, reason)
+}
+
 func Test_RentTape_Success(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
 	tapeUUID := uuid.New()
 	userUUID := uuid.New()
 	tapeID := int32(8)
 	userID := int32(14)
 	userRentCount := int64(1)
-	tapeRentCount := int64(0)
 
 	user := &model.User{
 		ID:       userID,
@@ -85,8 +174,8 @@ func Test_RentTape_Success(t *testing.T) {
 		Title:    "The Matrix",
 		Director: "Wachowski sisters",
 		Genre:    "Cyberpunk",
-		Quantity: 1,
 	}
+	tapeCopy := &model.TapeCopy{ID: 51, TapeID: tapeID}
 
 	rentalID := int32(23)
 	dbRental := &model.Rental{
@@ -96,33 +185,46 @@ func Test_RentTape_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(tape, nil)
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(user, nil)
-	mockRentalRepo.On("GetActiveRentCountByUser", ctx, userID).Return(&userRentCount, nil)
-	mockRentalRepo.On("GetActiveRentCountByTape", ctx, tapeID).Return(&tapeRentCount, nil)
-	mockRentalRepo.On("Save", ctx, tapeID, userID).Return(dbRental, nil)
-
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(tape, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(user, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	mockRentalRepo.On("GetActiveRentCountByUser", tracedCtx, userID).Return(&userRentCount, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+	mockReservationRepo.On("GetOpen", tracedCtx, userID, tapeID).Return(nil, apperror.ErrReservationNotFound)
+	mockCopyRepo.On("GetAvailable", tracedCtx, tapeID).Return(tapeCopy, nil)
+	mockRentalRepo.On("Save", tracedCtx, tapeID, userID, tapeCopy.ID, mock.MatchedBy(func(dueAt time.Time) bool {
+		// Due one rental period from now
+		return time.Until(dueAt) > testRentalPolicy.Period-time.Minute
+	})).Return(dbRental, nil)
+	mockCopyRepo.On("SetStatus", tracedCtx, tapeCopy.ID, model.CopyStatusRented).Return(nil)
+
+	rentalMetrics := &fakeRentalMetrics{}
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, rentalMetrics)
 	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
 
 	assert.Nil(t, err)
 	assert.Equal(t, dbRental, rental)
+	assert.Equal(t, 1, rentalMetrics.created)
 
 	mockRentalRepo.AssertExpectations(t)
+	mockCopyRepo.AssertExpectations(t)
 }
 
 func Test_RentTape_TapeNotFound(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 
 	userUUID := uuid.New()
 	tapeUUID := uuid.New()
 
 	ctx := context.Background()
-	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(nil, apperror.ErrTapeNotFound)
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(nil, apperror.ErrTapeNotFound)
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
 
 	assert.Error(t, err)
@@ -135,16 +237,18 @@ func Test_RentTape_TapeNotFound(t *testing.T) {
 func Test_RentTape_Fail_UserNotFound(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 
 	userUUID := uuid.New()
 	tapeUUID := uuid.New()
 
 	ctx := context.Background()
-	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(&model.Tape{}, nil)
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(nil, apperror.ErrUserNotFound)
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(&model.Tape{}, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(nil, apperror.ErrUserNotFound)
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
 
 	assert.Error(t, err)
@@ -157,29 +261,36 @@ func Test_RentTape_Fail_UserNotFound(t *testing.T) {
 func Test_RentTape_Fail_TapeUnavailable(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 
 	userUUID := uuid.New()
 	tapeUUID := uuid.New()
 	tapeID := int32(14)
-	tapeRentCount := int64(1)
 
 	returnedTape := &model.Tape{
-		ID:       tapeID,
-		Quantity: 1,
+		ID: tapeID,
 	}
 
 	ctx := context.Background()
-	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(returnedTape, nil)
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{}, nil)
-	mockRentalRepo.On("GetActiveRentCountByTape", ctx, tapeID).Return(&tapeRentCount, nil)
-
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(returnedTape, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(&model.User{}, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, int32(0), mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	// The only copy is rented out
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+	mockReservationRepo.On("GetOpen", tracedCtx, int32(0), tapeID).Return(nil, apperror.ErrReservationNotFound)
+
+	rentalMetrics := &fakeRentalMetrics{}
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, rentalMetrics)
 	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
 
 	assert.Error(t, err)
 	assert.Equal(t, err, apperror.ErrTapeUnavailable)
 	assert.Nil(t, rental)
+	assert.Equal(t, []string{metrics.ReasonTapeUnavailable}, rentalMetrics.rejected)
+	assert.Zero(t, rentalMetrics.created)
 
 	mockRentalRepo.AssertExpectations(t)
 }
@@ -187,19 +298,19 @@ func Test_RentTape_Fail_TapeUnavailable(t *testing.T) {
 func Test_RentTape_Fail_MaxRentalsPerUser(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 
 	userUUID := uuid.New()
 	tapeUUID := uuid.New()
 	tapeID := int32(14)
 	userID := int32(80)
-	tapeRentCount := int64(1)
 	// User set to have max allowed active rented tapes (2)
 	userRentCount := int64(2)
 
 	returnedTape := &model.Tape{
-		ID:       tapeID,
-		Quantity: 2,
+		ID: tapeID,
 	}
 
 	returnedUser := &model.User{
@@ -207,25 +318,155 @@ func Test_RentTape_Fail_MaxRentalsPerUser(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(returnedTape, nil)
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(returnedUser, nil)
-	mockRentalRepo.On("GetActiveRentCountByTape", ctx, tapeID).Return(&tapeRentCount, nil)
-	mockRentalRepo.On("GetActiveRentCountByUser", ctx, userID).Return(&userRentCount, nil)
-
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(returnedTape, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(returnedUser, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+	mockReservationRepo.On("GetOpen", tracedCtx, userID, tapeID).Return(nil, apperror.ErrReservationNotFound)
+	mockRentalRepo.On("GetActiveRentCountByUser", tracedCtx, userID).Return(&userRentCount, nil)
+
+	rentalMetrics := &fakeRentalMetrics{}
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, rentalMetrics)
 	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
 
 	assert.Error(t, err)
 	assert.Equal(t, err, apperror.ErrMaxRentalsPerUser)
 	assert.Nil(t, rental)
+	assert.Equal(t, []string{metrics.ReasonMaxRentalsPerUser}, rentalMetrics.rejected)
 
 	mockRentalRepo.AssertExpectations(t)
 }
 
+func Test_RentTape_Fail_OverdueTapes(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(33)
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(&model.Tape{ID: 2}, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{OverdueCount: 1}, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, rental)
+	assert.ErrorIs(t, err, apperror.ErrRentalBlocked)
+	mockRentalRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_RentTape_Fail_UnpaidLateFees(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(34)
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(&model.Tape{ID: 2}, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{UnpaidFeesCents: 300}, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, rental)
+	assert.ErrorIs(t, err, apperror.ErrRentalBlocked)
+}
+
+func Test_RentTape_HeldCopy_FulfillsReservation(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(6)
+	userID := int32(21)
+	userRentCount := int64(0)
+	hold := &model.Reservation{
+		ID:     40,
+		TapeID: tapeID,
+		UserID: userID,
+		Status: model.ReservationStatusHeld,
+	}
+	tapeCopy := &model.TapeCopy{ID: 52, TapeID: tapeID}
+	dbRental := &model.Rental{ID: 9, TapeID: tapeID, UserID: userID}
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(&model.Tape{ID: tapeID}, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("ExpireHolds", tracedCtx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	// The only copy is held for this user, so no copy is free for anyone else
+	mockReservationRepo.On("CountHeldByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("GetOpen", tracedCtx, userID, tapeID).Return(hold, nil)
+	mockRentalRepo.On("GetActiveRentCountByUser", tracedCtx, userID).Return(&userRentCount, nil)
+	mockCopyRepo.On("GetAvailable", tracedCtx, tapeID).Return(tapeCopy, nil)
+	mockRentalRepo.On("Save", tracedCtx, tapeID, userID, tapeCopy.ID, mock.AnythingOfType("time.Time")).Return(dbRental, nil)
+	mockCopyRepo.On("SetStatus", tracedCtx, tapeCopy.ID, model.CopyStatusRented).Return(nil)
+	mockReservationRepo.On("Fulfill", tracedCtx, hold.ID).Return(nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, err)
+	assert.Equal(t, dbRental, rental)
+
+	mockRentalRepo.AssertExpectations(t)
+	mockReservationRepo.AssertExpectations(t)
+}
+
+func Test_RentTape_CopyHeldForSomeoneElse(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(6)
+	userID := int32(22)
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", tracedCtx, tapeUUID).Return(&model.Tape{ID: tapeID}, nil)
+	mockUserRepo.On("GetByPublicIDForUpdate", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetStanding", tracedCtx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("ExpireHolds", tracedCtx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockReservationRepo.On("CountHeldByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	// Still waiting in the queue, the held copy belongs to the member ahead
+	mockReservationRepo.On("GetOpen", tracedCtx, userID, tapeID).Return(&model.Reservation{Status: model.ReservationStatusWaiting}, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rental, err := svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, rental)
+	assert.ErrorIs(t, err, apperror.ErrTapeUnavailable)
+	mockRentalRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func Test_ReturnTape_Success(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
 	ctx := context.Background()
 	rentalUUID := uuid.New()
@@ -234,29 +475,160 @@ func Test_ReturnTape_Success(t *testing.T) {
 	user := &model.User{
 		ID: userID,
 	}
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(user, nil)
-	mockRentalRepo.On("ReturnTape", ctx, rentalUUID, user.ID).Return(nil)
+	tapeID := int32(4)
+	tape := &model.Tape{
+		ID: tapeID,
+	}
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(user, nil)
+	rental := &model.Rental{
+		ID:     15,
+		TapeID: tapeID,
+		CopyID: sql.NullInt32{Int32: 53, Valid: true},
+		DueAt:  time.Now().UTC().Add(24 * time.Hour),
+	}
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, user.ID).Return(rental, nil)
+	// Returned before the due date, no late fee
+	mockRentalRepo.On("ReturnTape", tracedCtx, rental.ID, mock.AnythingOfType("time.Time"), int32(0)).Return(nil)
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(tape, nil)
+	// The returned copy goes back on the shelf
+	mockCopyRepo.On("SetStatus", tracedCtx, rental.CopyID.Int32, model.CopyStatusAvailable).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+
+	rentalMetrics := &fakeRentalMetrics{}
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, rentalMetrics)
+	err := svc.ReturnTape(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, rentalMetrics.returned)
+
+	mockRentalRepo.AssertExpectations(t)
+	mockCopyRepo.AssertExpectations(t)
+}
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+func Test_ReturnTape_ChargesLateFee(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	tapeID := int32(4)
+	// 2 days and 2 hours late, every started day is charged
+	rental := &model.Rental{
+		ID:     17,
+		TapeID: tapeID,
+		CopyID: sql.NullInt32{Int32: 54, Valid: true},
+		DueAt:  time.Now().UTC().Add(-50 * time.Hour),
+	}
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+	mockRentalRepo.On("ReturnTape", tracedCtx, rental.ID, mock.AnythingOfType("time.Time"), 3*testRentalPolicy.LateFeePerDayCents).Return(nil)
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("SetStatus", tracedCtx, rental.CopyID.Int32, model.CopyStatusAvailable).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	err := svc.ReturnTape(ctx, userUUID.String(), rentalUUID.String())
 
 	assert.Nil(t, err)
+	mockRentalRepo.AssertExpectations(t)
+}
+
+func Test_ReturnTape_CapsLateFee(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	tapeID := int32(4)
+	// Ten years late at a steep daily fee, far past what an int32 of cents holds
+	rental := &model.Rental{
+		ID:     17,
+		TapeID: tapeID,
+		CopyID: sql.NullInt32{Int32: 54, Valid: true},
+		DueAt:  time.Now().UTC().AddDate(-10, 0, 0),
+	}
+	policy := testRentalPolicy
+	policy.LateFeePerDayCents = 1_000_000
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+	mockRentalRepo.On("ReturnTape", tracedCtx, rental.ID, mock.AnythingOfType("time.Time"), int32(math.MaxInt32)).Return(nil)
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("SetStatus", tracedCtx, rental.CopyID.Int32, model.CopyStatusAvailable).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, policy, &fakeRentalMetrics{})
+	err := svc.ReturnTape(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, err)
 	mockRentalRepo.AssertExpectations(t)
 }
 
+func Test_ReturnTape_PromotesFirstReservation(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	tapeID := int32(4)
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	rental := &model.Rental{
+		ID:     16,
+		TapeID: tapeID,
+		CopyID: sql.NullInt32{Int32: 55, Valid: true},
+		DueAt:  time.Now().UTC(),
+	}
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+	mockRentalRepo.On("ReturnTape", tracedCtx, rental.ID, mock.AnythingOfType("time.Time"), mock.AnythingOfType("int32")).Return(nil)
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("SetStatus", tracedCtx, rental.CopyID.Int32, model.CopyStatusAvailable).Return(nil)
+	// The returned copy is the only one on the shelf and nobody holds the tape yet
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("ExpireHolds", tracedCtx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockReservationRepo.On("CountHeldByTape", tracedCtx, tapeID).Return(int64(0), nil)
+	mockReservationRepo.On("PromoteWaiting", tracedCtx, tapeID, int32(1), mock.AnythingOfType("time.Time")).Return(int64(1), nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	err := svc.ReturnTape(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, err)
+	mockReservationRepo.AssertExpectations(t)
+}
+
 func Test_ReturnTape_UserNotFound(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
 	ctx := context.Background()
 	rentalUUID := uuid.New()
 	userUUID := uuid.New()
 
-	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(nil, apperror.ErrUserNotFound)
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(nil, apperror.ErrUserNotFound)
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	err := svc.ReturnTape(ctx, userUUID.String(), rentalUUID.String())
 
 	assert.Error(t, err)
@@ -265,10 +637,142 @@ func Test_ReturnTape_UserNotFound(t *testing.T) {
 	mockRentalRepo.AssertExpectations(t)
 }
 
+func Test_RenewRental_Success(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	tapeID := int32(4)
+	rental := &model.Rental{
+		ID:       18,
+		TapeID:   tapeID,
+		DueAt:    time.Now().UTC().Add(24 * time.Hour),
+		Renewals: 1,
+	}
+	// The new due date is counted from the current one, not from today
+	newDueAt := rental.DueAt.Add(testRentalPolicy.Period)
+	renewedRental := &model.Rental{ID: rental.ID, TapeID: tapeID, DueAt: newDueAt, Renewals: 2}
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+	mockReservationRepo.On("CountWaitingByTape", tracedCtx, tapeID).Return(int64(0), nil)
+	mockRentalRepo.On("Renew", tracedCtx, rental.ID, newDueAt).Return(renewedRental, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	result, err := svc.RenewRental(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, err)
+	assert.Equal(t, renewedRental, result)
+
+	mockRentalRepo.AssertExpectations(t)
+	mockReservationRepo.AssertExpectations(t)
+}
+
+func Test_RenewRental_Fail_LimitReached(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	rental := &model.Rental{
+		ID:       19,
+		TapeID:   4,
+		DueAt:    time.Now().UTC().Add(24 * time.Hour),
+		Renewals: testRentalPolicy.MaxRenewals,
+	}
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	result, err := svc.RenewRental(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, apperror.ErrRenewalLimit)
+	mockRentalRepo.AssertNotCalled(t, "Renew", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_RenewRental_Fail_Overdue(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	rental := &model.Rental{
+		ID:     20,
+		TapeID: 4,
+		DueAt:  time.Now().UTC().Add(-time.Hour),
+	}
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	result, err := svc.RenewRental(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, apperror.ErrRenewalOverdue)
+}
+
+func Test_RenewRental_Fail_MemberWaiting(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	ctx := context.Background()
+	rentalUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(10)
+	tapeID := int32(4)
+	rental := &model.Rental{
+		ID:     21,
+		TapeID: tapeID,
+		DueAt:  time.Now().UTC().Add(24 * time.Hour),
+	}
+
+	mockUserRepo.On("GetByPublicID", tracedCtx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockRentalRepo.On("GetActiveForUpdate", tracedCtx, rentalUUID, userID).Return(rental, nil)
+	// The only copy is rented out by this member and another one is in the queue
+	mockTapeRepo.On("GetByIDForUpdate", tracedCtx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("CountAvailableByTape", tracedCtx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, tracedCtx, tapeID)
+	mockReservationRepo.On("CountWaitingByTape", tracedCtx, tapeID).Return(int64(1), nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	result, err := svc.RenewRental(ctx, userUUID.String(), rentalUUID.String())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, apperror.ErrRenewalReserved)
+	mockRentalRepo.AssertNotCalled(t, "Renew", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func Test_GetAllActiveRentals(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
 	dbRentals := []*model.Rental{
 		{
@@ -282,7 +786,7 @@ func Test_GetAllActiveRentals(t *testing.T) {
 	ctx := context.Background()
 	mockRentalRepo.On("GetAllActive", ctx).Return(dbRentals, nil)
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	rentals, err := svc.GetAllActiveRentals(ctx)
 
 	assert.Nil(t, err)
@@ -291,18 +795,372 @@ func Test_GetAllActiveRentals(t *testing.T) {
 	mockRentalRepo.AssertExpectations(t)
 }
 
+func Test_GetOverdueRentals(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	dbRentals := []*model.Rental{
+		{
+			Username: "SteveWozniak",
+			DueAt:    time.Now().Add(-72 * time.Hour),
+		},
+	}
+
+	ctx := context.Background()
+	mockRentalRepo.On("GetOverdue", ctx, mock.AnythingOfType("time.Time")).Return(dbRentals, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rentals, err := svc.GetOverdueRentals(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, dbRentals, rentals)
+
+	mockRentalRepo.AssertExpectations(t)
+}
+
+func Test_PayLateFee_NothingOwed(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	rentalUUID := uuid.New()
+
+	ctx := context.Background()
+	mockRentalRepo.On("PayLateFee", ctx, rentalUUID).Return(apperror.ErrRentalNotFound)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	err := svc.PayLateFee(ctx, rentalUUID.String())
+
+	assert.ErrorIs(t, err, apperror.ErrRentalNotFound)
+}
+
+func Test_GetRentalHistory_WithTapeFilter(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	userUUID := uuid.New()
+	tapeUUID := uuid.New()
+	userID := int32(3)
+	tapeID := int32(9)
+
+	filter := &model.RentalFilter{
+		TapePublicID: &tapeUUID,
+		Status:       model.RentalStatusReturned,
+	}
+	dbRentals := []*model.Rental{
+		{
+			TapeID:     tapeID,
+			UserID:     userID,
+			TapeTitle:  "Solaris",
+			ReturnedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		},
+	}
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockTapeRepo.On("GetByPublicID", ctx, tapeUUID).Return(&model.Tape{ID: tapeID}, nil)
+	mockRentalRepo.On("GetHistoryByUser", ctx, userID, mock.MatchedBy(func(f *model.RentalFilter) bool {
+		return f.TapeID != nil && *f.TapeID == tapeID && f.Status == model.RentalStatusReturned
+	})).Return(dbRentals, nil)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rentals, err := svc.GetRentalHistory(ctx, userUUID.String(), filter)
+
+	assert.Nil(t, err)
+	assert.Equal(t, dbRentals, rentals)
+
+	mockRentalRepo.AssertExpectations(t)
+	mockTapeRepo.AssertExpectations(t)
+}
+
+func Test_GetRentalHistory_UserNotFound(t *testing.T) {
+	mockRentalRepo := NewRentalMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+
+	userUUID := uuid.New()
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(nil, apperror.ErrUserNotFound)
+
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
+	rentals, err := svc.GetRentalHistory(ctx, userUUID.String(), &model.RentalFilter{})
+
+	assert.Nil(t, rentals)
+	assert.ErrorIs(t, err, apperror.ErrUserNotFound)
+
+	mockRentalRepo.AssertExpectations(t)
+}
+
 func Test_DeleteAllRentals(t *testing.T) {
 	mockRentalRepo := NewRentalMockRepository()
 	mockTapeRepo := NewTapeMockRepository()
 	mockUserRepo := NewUserMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
 
 	ctx := context.Background()
 	mockRentalRepo.On("DeleteAllRentals", ctx).Return(nil)
+	// Copies that were out go back on the shelf with their rentals gone
+	mockCopyRepo.On("ReleaseAllRented", ctx).Return(nil)
 
-	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo)
+	svc := service.NewRentalService(mockRentalRepo, mockTapeRepo, mockUserRepo, mockReservationRepo, mockCopyRepo, mockTransactor{}, testRentalPolicy, &fakeRentalMetrics{})
 	err := svc.DeleteAllRentals(ctx)
 
 	assert.Nil(t, err)
 
 	mockRentalRepo.AssertExpectations(t)
+	mockCopyRepo.AssertExpectations(t)
+}
+
+// In memory club used to exercise RentTape concurrency without a database.
+// Row locks taken through the ForUpdate methods are held until the surrounding
+// WithinTx call returns, mirroring SELECT ... FOR UPDATE inside a postgres transaction.
+// It is a model of postgres' locking, not the real thing: it checks that RentTape locks
+// the right rows in the right order, while the integration build tag runs the same race
+// against a database (Test_RentTape_Concurrent_SingleCopy_Postgres).
+type lockingClub struct {
+	mu       sync.Mutex
+	rowLocks map[string]*sync.Mutex
+	tapes    map[uuid.UUID]*model.Tape
+	users    map[uuid.UUID]*model.User
+	copies   []*model.TapeCopy
+	rentals  []*model.Rental
+}
+
+type lockingTx struct {
+	held []*sync.Mutex
+}
+
+type lockingTxKey struct{}
+
+func newLockingClub() *lockingClub {
+	return &lockingClub{
+		rowLocks: make(map[string]*sync.Mutex),
+		tapes:    make(map[uuid.UUID]*model.Tape),
+		users:    make(map[uuid.UUID]*model.User),
+	}
+}
+
+func (c *lockingClub) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx := &lockingTx{}
+	defer func() {
+		for i := len(tx.held) - 1; i >= 0; i-- {
+			tx.held[i].Unlock()
+		}
+	}()
+	return fn(context.WithValue(ctx, lockingTxKey{}, tx))
+}
+
+func (c *lockingClub) lockRow(ctx context.Context, key string) {
+	c.mu.Lock()
+	rowLock, ok := c.rowLocks[key]
+	if !ok {
+		rowLock = &sync.Mutex{}
+		c.rowLocks[key] = rowLock
+	}
+	c.mu.Unlock()
+
+	rowLock.Lock()
+	tx := ctx.Value(lockingTxKey{}).(*lockingTx)
+	tx.held = append(tx.held, rowLock)
+}
+
+func (c *lockingClub) countActive(match func(*model.Rental) bool) *int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := int64(0)
+	for _, rental := range c.rentals {
+		if match(rental) {
+			count++
+		}
+	}
+	return &count
+}
+
+// Only the methods RentTape relies on are implemented, the embedded interfaces panic on anything else
+type lockingTapeRepository struct {
+	repository.TapeRepository
+	club *lockingClub
+}
+
+func (r *lockingTapeRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.Tape, error) {
+	r.club.lockRow(ctx, "tape:"+id.String())
+	return r.club.tapes[id], nil
+}
+
+type lockingUserRepository struct {
+	repository.UserRepository
+	club *lockingClub
+}
+
+func (r *lockingUserRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	r.club.lockRow(ctx, "user:"+id.String())
+	return r.club.users[id], nil
+}
+
+type lockingRentalRepository struct {
+	repository.RentalRepository
+	club *lockingClub
+}
+
+func (r *lockingRentalRepository) GetActiveRentCountByUser(ctx context.Context, userID int32) (*int64, error) {
+	return r.club.countActive(func(rental *model.Rental) bool { return rental.UserID == userID }), nil
+}
+
+func (r *lockingRentalRepository) GetStanding(ctx context.Context, userID int32, now time.Time) (*model.RentalStanding, error) {
+	return &model.RentalStanding{}, nil
+}
+
+func (r *lockingRentalRepository) Save(ctx context.Context, tapeID, userID, copyID int32, dueAt time.Time) (*model.Rental, error) {
+	r.club.mu.Lock()
+	defer r.club.mu.Unlock()
+	rental := &model.Rental{
+		ID:       int32(len(r.club.rentals) + 1),
+		PublicID: uuid.New(),
+		TapeID:   tapeID,
+		UserID:   userID,
+		CopyID:   sql.NullInt32{Int32: copyID, Valid: true},
+	}
+	r.club.rentals = append(r.club.rentals, rental)
+	return rental, nil
+}
+
+type lockingTapeCopyRepository struct {
+	repository.TapeCopyRepository
+	club *lockingClub
+}
+
+func (r *lockingTapeCopyRepository) CountAvailableByTape(ctx context.Context, tapeID int32) (int64, error) {
+	r.club.mu.Lock()
+	defer r.club.mu.Unlock()
+	count := int64(0)
+	for _, tapeCopy := range r.club.copies {
+		if tapeCopy.TapeID == tapeID && tapeCopy.Status == model.CopyStatusAvailable {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *lockingTapeCopyRepository) GetAvailable(ctx context.Context, tapeID int32) (*model.TapeCopy, error) {
+	r.club.mu.Lock()
+	defer r.club.mu.Unlock()
+	for _, tapeCopy := range r.club.copies {
+		if tapeCopy.TapeID == tapeID && tapeCopy.Status == model.CopyStatusAvailable {
+			return tapeCopy, nil
+		}
+	}
+	return nil, apperror.ErrTapeUnavailable
+}
+
+func (r *lockingTapeCopyRepository) SetStatus(ctx context.Context, id int32, status string) error {
+	r.club.mu.Lock()
+	defer r.club.mu.Unlock()
+	for _, tapeCopy := range r.club.copies {
+		if tapeCopy.ID == id {
+			tapeCopy.Status = status
+		}
+	}
+	return nil
+}
+
+// Nobody in the club reserves, so holds never take a copy away
+type lockingReservationRepository struct {
+	repository.ReservationRepository
+}
+
+func (r *lockingReservationRepository) ExpireHolds(ctx context.Context, tapeID int32, now time.Time) error {
+	return nil
+}
+
+func (r *lockingReservationRepository) CountHeldByTape(ctx context.Context, tapeID int32) (int64, error) {
+	return 0, nil
+}
+
+func (r *lockingReservationRepository) PromoteWaiting(ctx context.Context, tapeID, slots int32, holdExpiresAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *lockingReservationRepository) GetOpen(ctx context.Context, userID, tapeID int32) (*model.Reservation, error) {
+	return nil, apperror.ErrReservationNotFound
+}
+
+// Model check on lockingClub, it proves nothing about the SQL itself
+func Test_RentTape_Concurrent_SingleCopy(t *testing.T) {
+	club := newLockingClub()
+
+	tapeUUID := uuid.New()
+	club.tapes[tapeUUID] = &model.Tape{
+		ID:       1,
+		PublicID: tapeUUID,
+		Title:    "Stalker",
+	}
+	club.copies = append(club.copies, &model.TapeCopy{
+		ID:     1,
+		TapeID: 1,
+		Status: model.CopyStatusAvailable,
+	})
+
+	// Every caller is a different member so only the single copy can stop them
+	const callers = 50
+	userUUIDs := make([]uuid.UUID, callers)
+	for i := range userUUIDs {
+		userUUIDs[i] = uuid.New()
+		club.users[userUUIDs[i]] = &model.User{
+			ID:       int32(i + 1),
+			PublicID: userUUIDs[i],
+		}
+	}
+
+	rentalMetrics := &fakeRentalMetrics{}
+	svc := service.NewRentalService(
+		&lockingRentalRepository{club: club},
+		&lockingTapeRepository{club: club},
+		&lockingUserRepository{club: club},
+		&lockingReservationRepository{},
+		&lockingTapeCopyRepository{club: club},
+		club,
+		testRentalPolicy,
+		rentalMetrics,
+	)
+
+	ctx := context.Background()
+	errs := make([]error, callers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, userUUID := range userUUIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = svc.RentTape(ctx, tapeUUID.String(), userUUID.String())
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.True(t, errors.Is(err, apperror.ErrTapeUnavailable))
+	}
+
+	assert.Equal(t, 1, succeeded)
+	assert.Len(t, club.rentals, 1)
+	assert.Equal(t, 1, rentalMetrics.created)
+	assert.Len(t, rentalMetrics.rejected, callers-1)
 }
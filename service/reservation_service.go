@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/repository"
+)
+
+type ReservationService interface {
+	ReserveTape(ctx context.Context, tapeID, userID string) (*model.Reservation, error)
+	GetMyReservations(ctx context.Context, userID string) ([]*model.Reservation, error)
+	CancelReservation(ctx context.Context, userID, reservationID string) error
+	ExpireHolds(ctx context.Context) error
+}
+
+type reservationService struct {
+	reservationRepo repository.ReservationRepository
+	copyRepo        repository.TapeCopyRepository
+	tapeRepo        repository.TapeRepository
+	userRepo        repository.UserRepository
+	tx              repository.Transactor
+}
+
+func NewReservationService(res repository.ReservationRepository, c repository.TapeCopyRepository, t repository.TapeRepository, u repository.UserRepository, tx repository.Transactor) ReservationService {
+	return &reservationService{
+		reservationRepo: res,
+		copyRepo:        c,
+		tapeRepo:        t,
+		userRepo:        u,
+		tx:              tx,
+	}
+}
+
+// How long a returned copy stays reserved for the member at the head of the queue
+const holdDuration = 48 * time.Hour
+
+// Joining the queue only makes sense while every copy is rented out or held
+func (s *reservationService) ReserveTape(ctx context.Context, tapePublicID, userPublicID string) (*model.Reservation, error) {
+	tapeUUID, err := parseID(tapePublicID)
+	if err != nil {
+		return nil, err
+	}
+	userUUID, err := parseID(userPublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservation *model.Reservation
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tape, err := s.tapeRepo.GetByPublicIDForUpdate(ctx, tapeUUID)
+		if err != nil {
+			return err
+		}
+
+		user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		freeCopies, err := syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = s.reservationRepo.GetOpen(ctx, user.ID, tape.ID)
+		if err == nil {
+			return apperror.ErrReservationExists
+		}
+		if !errors.Is(err, apperror.ErrReservationNotFound) {
+			return err
+		}
+
+		if freeCopies > 0 {
+			return apperror.ErrTapeAvailable
+		}
+
+		reservation, err = s.reservationRepo.Save(ctx, tape.ID, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func (s *reservationService) GetMyReservations(ctx context.Context, userPublicID string) ([]*model.Reservation, error) {
+	userUUID, err := parseID(userPublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reservationRepo.GetOpenByUser(ctx, user.ID)
+}
+
+// Cancelling a hold hands the copy to the next member in line
+func (s *reservationService) CancelReservation(ctx context.Context, userPublicID, reservationPublicID string) error {
+	reservationUUID, err := parseID(reservationPublicID)
+	if err != nil {
+		return err
+	}
+	userUUID, err := parseID(userPublicID)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetByPublicID(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+
+		// The tape of a reservation never changes, so the plain read is enough to find the tape
+		// row to lock. Locking the tape before the reservation keeps the lock order of syncHolds.
+		found, err := s.reservationRepo.GetByPublicID(ctx, reservationUUID, user.ID)
+		if err != nil {
+			return err
+		}
+		tape, err := s.tapeRepo.GetByIDForUpdate(ctx, found.TapeID)
+		if err != nil {
+			return err
+		}
+		reservation, err := s.reservationRepo.GetByPublicIDForUpdate(ctx, reservationUUID, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := s.reservationRepo.Cancel(ctx, reservation.ID); err != nil {
+			return err
+		}
+
+		_, err = syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, time.Now().UTC())
+		return err
+	})
+}
+
+// Sweeps tapes whose holds ran out while nobody rented or returned a copy, so the
+// next members in line still get their hold. Meant to run periodically.
+func (s *reservationService) ExpireHolds(ctx context.Context) error {
+	tapeIDs, err := s.reservationRepo.GetTapeIDsWithExpiredHolds(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	for _, tapeID := range tapeIDs {
+		err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+			tape, err := s.tapeRepo.GetByIDForUpdate(ctx, tapeID)
+			if err != nil {
+				return err
+			}
+
+			_, err = syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helpers
+
+// Expires the tape's stale holds and turns the copies on the shelf nobody holds into holds for
+// the oldest waiting reservations. Returns the copies still free for anyone to rent.
+// Must run inside Transactor.WithinTx with the tape row locked.
+func syncHolds(ctx context.Context, reservationRepo repository.ReservationRepository, copyRepo repository.TapeCopyRepository, tape *model.Tape, now time.Time) (int32, error) {
+	if err := reservationRepo.ExpireHolds(ctx, tape.ID, now); err != nil {
+		return 0, err
+	}
+
+	onShelf, err := copyRepo.CountAvailableByTape(ctx, tape.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	onHold, err := reservationRepo.CountHeldByTape(ctx, tape.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	freeCopies := int32(onShelf) - int32(onHold)
+	if freeCopies <= 0 {
+		return 0, nil
+	}
+
+	promoted, err := reservationRepo.PromoteWaiting(ctx, tape.ID, freeCopies, now.Add(holdDuration))
+	if err != nil {
+		return 0, err
+	}
+	return freeCopies - int32(promoted), nil
+}
+
+// Holds are not tied to a copy, so taking a copy off the shelf can leave more holds than copies
+// to honour them. The newest excess holds go back to waiting, ahead of everyone who joined later.
+// Must run inside Transactor.WithinTx with the tape row locked.
+func releaseUnbackedHolds(ctx context.Context, reservationRepo repository.ReservationRepository, copyRepo repository.TapeCopyRepository, tape *model.Tape, now time.Time) error {
+	if err := reservationRepo.ExpireHolds(ctx, tape.ID, now); err != nil {
+		return err
+	}
+
+	onShelf, err := copyRepo.CountAvailableByTape(ctx, tape.ID)
+	if err != nil {
+		return err
+	}
+
+	onHold, err := reservationRepo.CountHeldByTape(ctx, tape.ID)
+	if err != nil {
+		return err
+	}
+
+	if onHold <= onShelf {
+		return nil
+	}
+	_, err = reservationRepo.DemoteHeld(ctx, tape.ID, int32(onHold-onShelf))
+	return err
+}
@@ -0,0 +1,322 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockReservationRepository struct {
+	mock.Mock
+}
+
+func NewReservationMockRepository() *mockReservationRepository {
+	return &mockReservationRepository{}
+}
+
+func (m *mockReservationRepository) Save(ctx context.Context, tapeID, userID int32) (*model.Reservation, error) {
+	args := m.Called(ctx, tapeID, userID)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Reservation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockReservationRepository) GetByPublicID(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error) {
+	args := m.Called(ctx, id, userID)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Reservation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockReservationRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID, userID int32) (*model.Reservation, error) {
+	args := m.Called(ctx, id, userID)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Reservation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockReservationRepository) GetOpen(ctx context.Context, userID, tapeID int32) (*model.Reservation, error) {
+	args := m.Called(ctx, userID, tapeID)
+	if r := args.Get(0); r != nil {
+		return r.(*model.Reservation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockReservationRepository) GetOpenByUser(ctx context.Context, userID int32) ([]*model.Reservation, error) {
+	args := m.Called(ctx, userID)
+	if r := args.Get(0); r != nil {
+		return r.([]*model.Reservation), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockReservationRepository) CountHeldByTape(ctx context.Context, tapeID int32) (int64, error) {
+	args := m.Called(ctx, tapeID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockReservationRepository) CountWaitingByTape(ctx context.Context, tapeID int32) (int64, error) {
+	args := m.Called(ctx, tapeID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockReservationRepository) ExpireHolds(ctx context.Context, tapeID int32, now time.Time) error {
+	args := m.Called(ctx, tapeID, now)
+	return args.Error(0)
+}
+
+func (m *mockReservationRepository) PromoteWaiting(ctx context.Context, tapeID, slots int32, holdExpiresAt time.Time) (int64, error) {
+	args := m.Called(ctx, tapeID, slots, holdExpiresAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockReservationRepository) DemoteHeld(ctx context.Context, tapeID, slots int32) (int64, error) {
+	args := m.Called(ctx, tapeID, slots)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockReservationRepository) Fulfill(ctx context.Context, id int32) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockReservationRepository) Cancel(ctx context.Context, id int32) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockReservationRepository) GetTapeIDsWithExpiredHolds(ctx context.Context, now time.Time) ([]int32, error) {
+	args := m.Called(ctx, now)
+	if ids := args.Get(0); ids != nil {
+		return ids.([]int32), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+// Stubs the hold bookkeeping for a tape nobody has reserved
+func expectNoReservations(m *mockReservationRepository, ctx any, tapeID int32) {
+	m.On("ExpireHolds", ctx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	m.On("CountHeldByTape", ctx, tapeID).Return(int64(0), nil)
+	m.On("PromoteWaiting", ctx, tapeID, mock.AnythingOfType("int32"), mock.AnythingOfType("time.Time")).Return(int64(0), nil).Maybe()
+}
+
+func Test_ReserveTape_Success(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(5)
+	userID := int32(12)
+	tape := &model.Tape{
+		ID:    tapeID,
+		Title: "Paris, Texas",
+	}
+	savedReservation := &model.Reservation{
+		ID:        1,
+		TapeID:    tapeID,
+		UserID:    userID,
+		TapeTitle: "Paris, Texas",
+		Status:    model.ReservationStatusWaiting,
+		Position:  1,
+	}
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", ctx, tapeUUID).Return(tape, nil)
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	// Every copy is rented out
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, ctx, tapeID)
+	mockReservationRepo.On("GetOpen", ctx, userID, tapeID).Return(nil, apperror.ErrReservationNotFound)
+	mockReservationRepo.On("Save", ctx, tapeID, userID).Return(savedReservation, nil)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	reservation, err := svc.ReserveTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, err)
+	assert.Equal(t, savedReservation, reservation)
+
+	mockReservationRepo.AssertExpectations(t)
+	mockReservationRepo.AssertNotCalled(t, "PromoteWaiting", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_ReserveTape_TapeAvailable(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(5)
+	userID := int32(12)
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", ctx, tapeUUID).Return(&model.Tape{ID: tapeID}, nil)
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(1), nil)
+	expectNoReservations(mockReservationRepo, ctx, tapeID)
+	mockReservationRepo.On("GetOpen", ctx, userID, tapeID).Return(nil, apperror.ErrReservationNotFound)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	reservation, err := svc.ReserveTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, reservation)
+	assert.ErrorIs(t, err, apperror.ErrTapeAvailable)
+	mockReservationRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_ReserveTape_AlreadyQueued(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	tapeUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(5)
+	userID := int32(12)
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", ctx, tapeUUID).Return(&model.Tape{ID: tapeID}, nil)
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, ctx, tapeID)
+	mockReservationRepo.On("GetOpen", ctx, userID, tapeID).Return(&model.Reservation{Status: model.ReservationStatusWaiting}, nil)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	reservation, err := svc.ReserveTape(ctx, tapeUUID.String(), userUUID.String())
+
+	assert.Nil(t, reservation)
+	assert.ErrorIs(t, err, apperror.ErrReservationExists)
+}
+
+func Test_CancelReservation_HandsHoldToNextInLine(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	reservationUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(7)
+	userID := int32(2)
+	reservation := &model.Reservation{
+		ID:     30,
+		TapeID: tapeID,
+		UserID: userID,
+		Status: model.ReservationStatusHeld,
+	}
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockReservationRepo.On("GetByPublicID", ctx, reservationUUID, userID).Return(reservation, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockReservationRepo.On("GetByPublicIDForUpdate", ctx, reservationUUID, userID).Return(reservation, nil)
+	mockReservationRepo.On("Cancel", ctx, reservation.ID).Return(nil)
+	mockReservationRepo.On("ExpireHolds", ctx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("CountHeldByTape", ctx, tapeID).Return(int64(0), nil)
+	// The cancelled hold frees the only copy for the next waiting member
+	mockReservationRepo.On("PromoteWaiting", ctx, tapeID, int32(1), mock.AnythingOfType("time.Time")).Return(int64(1), nil)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	err := svc.CancelReservation(ctx, userUUID.String(), reservationUUID.String())
+
+	assert.Nil(t, err)
+	mockReservationRepo.AssertExpectations(t)
+}
+
+func Test_CancelReservation_NotFound(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	reservationUUID := uuid.New()
+	userUUID := uuid.New()
+	userID := int32(2)
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockReservationRepo.On("GetByPublicID", ctx, reservationUUID, userID).Return(nil, apperror.ErrReservationNotFound)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	err := svc.CancelReservation(ctx, userUUID.String(), reservationUUID.String())
+
+	assert.ErrorIs(t, err, apperror.ErrReservationNotFound)
+	mockTapeRepo.AssertNotCalled(t, "GetByIDForUpdate", mock.Anything, mock.Anything)
+}
+
+// The reservation was found, but another request cancelled it before the tape lock was taken
+func Test_CancelReservation_AlreadyCancelled(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	reservationUUID := uuid.New()
+	userUUID := uuid.New()
+	tapeID := int32(7)
+	userID := int32(2)
+	reservation := &model.Reservation{
+		ID:     30,
+		TapeID: tapeID,
+		UserID: userID,
+		Status: model.ReservationStatusWaiting,
+	}
+	locked := *reservation
+	locked.Status = model.ReservationStatusCancelled
+
+	ctx := context.Background()
+	mockUserRepo.On("GetByPublicID", ctx, userUUID).Return(&model.User{ID: userID}, nil)
+	mockReservationRepo.On("GetByPublicID", ctx, reservationUUID, userID).Return(reservation, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockReservationRepo.On("GetByPublicIDForUpdate", ctx, reservationUUID, userID).Return(&locked, nil)
+	mockReservationRepo.On("Cancel", ctx, reservation.ID).Return(apperror.ErrReservationNotFound)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	err := svc.CancelReservation(ctx, userUUID.String(), reservationUUID.String())
+
+	assert.ErrorIs(t, err, apperror.ErrReservationNotFound)
+	mockReservationRepo.AssertNotCalled(t, "PromoteWaiting", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_ExpireHolds_PromotesNextInLine(t *testing.T) {
+	mockReservationRepo := NewReservationMockRepository()
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockUserRepo := NewUserMockRepository()
+
+	tapeID := int32(3)
+
+	ctx := context.Background()
+	mockReservationRepo.On("GetTapeIDsWithExpiredHolds", ctx, mock.AnythingOfType("time.Time")).Return([]int32{tapeID}, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockReservationRepo.On("ExpireHolds", ctx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("CountHeldByTape", ctx, tapeID).Return(int64(0), nil)
+	mockReservationRepo.On("PromoteWaiting", ctx, tapeID, int32(1), mock.MatchedBy(func(holdExpiresAt time.Time) bool {
+		// New holds last the full hold period from now
+		return time.Until(holdExpiresAt) > 47*time.Hour
+	})).Return(int64(1), nil)
+
+	svc := service.NewReservationService(mockReservationRepo, mockCopyRepo, mockTapeRepo, mockUserRepo, mockTransactor{})
+	err := svc.ExpireHolds(ctx)
+
+	assert.Nil(t, err)
+	mockReservationRepo.AssertExpectations(t)
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+)
+
+// Public IDs arrive as path params and JWT subjects, a malformed one is the caller's mistake
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %v", apperror.ErrInvalidID, err)
+	}
+	return parsed, nil
+}
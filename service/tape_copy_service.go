@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/repository"
+)
+
+type TapeCopyService interface {
+	AddCopy(ctx context.Context, tapeID string, tapeCopy *model.TapeCopy) (*model.TapeCopy, error)
+	GetCopiesByTape(ctx context.Context, tapeID string) ([]*model.TapeCopy, error)
+	GetCopy(ctx context.Context, id string) (*model.TapeCopy, error)
+	UpdateCondition(ctx context.Context, id, condition string) (*model.TapeCopy, error)
+	RetireCopy(ctx context.Context, id string) error
+}
+
+type tapeCopyService struct {
+	copyRepo        repository.TapeCopyRepository
+	tapeRepo        repository.TapeRepository
+	reservationRepo repository.ReservationRepository
+	tx              repository.Transactor
+}
+
+func NewTapeCopyService(c repository.TapeCopyRepository, t repository.TapeRepository, res repository.ReservationRepository, tx repository.Transactor) TapeCopyService {
+	return &tapeCopyService{
+		copyRepo:        c,
+		tapeRepo:        t,
+		reservationRepo: res,
+		tx:              tx,
+	}
+}
+
+// A new copy goes on hold right away when members are waiting for the tape
+func (s *tapeCopyService) AddCopy(ctx context.Context, tapePublicID string, tapeCopy *model.TapeCopy) (*model.TapeCopy, error) {
+	tapeUUID, err := parseID(tapePublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	var savedCopy *model.TapeCopy
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tape, err := s.tapeRepo.GetByPublicIDForUpdate(ctx, tapeUUID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		tapeCopy.TapeID = tape.ID
+		if tapeCopy.AcquiredAt.IsZero() {
+			tapeCopy.AcquiredAt = now
+		}
+
+		savedCopy, err = s.copyRepo.Save(ctx, tapeCopy)
+		if err != nil {
+			return err
+		}
+		savedCopy.TapePublicID = tape.PublicID
+
+		_, err = syncHolds(ctx, s.reservationRepo, s.copyRepo, tape, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return savedCopy, nil
+}
+
+func (s *tapeCopyService) GetCopiesByTape(ctx context.Context, tapePublicID string) ([]*model.TapeCopy, error) {
+	tapeUUID, err := parseID(tapePublicID)
+	if err != nil {
+		return nil, err
+	}
+
+	tape, err := s.tapeRepo.GetByPublicID(ctx, tapeUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	copies, err := s.copyRepo.GetByTape(ctx, tape.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tapeCopy := range copies {
+		tapeCopy.TapePublicID = tape.PublicID
+	}
+	return copies, nil
+}
+
+func (s *tapeCopyService) GetCopy(ctx context.Context, id string) (*model.TapeCopy, error) {
+	copyUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.copyRepo.GetByPublicID(ctx, copyUUID)
+}
+
+// Records wear and damage, the copy stays in circulation until it is retired
+func (s *tapeCopyService) UpdateCondition(ctx context.Context, id, condition string) (*model.TapeCopy, error) {
+	copyUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tapeCopy, err := s.copyRepo.GetByPublicID(ctx, copyUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedCopy, err := s.copyRepo.UpdateCondition(ctx, tapeCopy.ID, condition)
+	if err != nil {
+		return nil, err
+	}
+	updatedCopy.TapePublicID = tapeCopy.TapePublicID
+	return updatedCopy, nil
+}
+
+// Takes a copy out of circulation for good. Rented copies have to be returned first,
+// retiring an already retired copy does nothing. A hold the remaining copies can't honour
+// goes back to waiting.
+func (s *tapeCopyService) RetireCopy(ctx context.Context, id string) error {
+	copyUUID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	tapeCopy, err := s.copyRepo.GetByPublicID(ctx, copyUUID)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		tape, err := s.tapeRepo.GetByIDForUpdate(ctx, tapeCopy.TapeID)
+		if err != nil {
+			return err
+		}
+
+		// Read again under the tape lock, the copy may have been rented in the meantime
+		tapeCopy, err := s.copyRepo.GetByPublicID(ctx, copyUUID)
+		if err != nil {
+			return err
+		}
+
+		switch tapeCopy.Status {
+		case model.CopyStatusRented:
+			return apperror.ErrCopyRented
+		case model.CopyStatusRetired:
+			return nil
+		}
+
+		if err := s.copyRepo.SetStatus(ctx, tapeCopy.ID, model.CopyStatusRetired); err != nil {
+			return err
+		}
+
+		return releaseUnbackedHolds(ctx, s.reservationRepo, s.copyRepo, tape, time.Now().UTC())
+	})
+}
@@ -0,0 +1,224 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
+	"github.com/rigofekete/vhs-club-mvc/model"
+	"github.com/rigofekete/vhs-club-mvc/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockTapeCopyRepository struct {
+	mock.Mock
+}
+
+func NewTapeCopyMockRepository() *mockTapeCopyRepository {
+	return &mockTapeCopyRepository{}
+}
+
+func (m *mockTapeCopyRepository) Save(ctx context.Context, tapeCopy *model.TapeCopy) (*model.TapeCopy, error) {
+	args := m.Called(ctx, tapeCopy)
+	if c := args.Get(0); c != nil {
+		return c.(*model.TapeCopy), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*model.TapeCopy, error) {
+	args := m.Called(ctx, id)
+	if c := args.Get(0); c != nil {
+		return c.(*model.TapeCopy), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) GetByTape(ctx context.Context, tapeID int32) ([]*model.TapeCopy, error) {
+	args := m.Called(ctx, tapeID)
+	if copies := args.Get(0); copies != nil {
+		return copies.([]*model.TapeCopy), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) GetAvailable(ctx context.Context, tapeID int32) (*model.TapeCopy, error) {
+	args := m.Called(ctx, tapeID)
+	if c := args.Get(0); c != nil {
+		return c.(*model.TapeCopy), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) CountAvailableByTape(ctx context.Context, tapeID int32) (int64, error) {
+	args := m.Called(ctx, tapeID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) SetStatus(ctx context.Context, id int32, status string) error {
+	args := m.Called(ctx, id, status)
+	return args.Error(0)
+}
+
+func (m *mockTapeCopyRepository) UpdateCondition(ctx context.Context, id int32, condition string) (*model.TapeCopy, error) {
+	args := m.Called(ctx, id, condition)
+	if c := args.Get(0); c != nil {
+		return c.(*model.TapeCopy), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeCopyRepository) ReleaseAllRented(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func Test_AddCopy_HoldsForWaitingMember(t *testing.T) {
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+
+	tapeUUID := uuid.New()
+	tapeID := int32(11)
+	tape := &model.Tape{ID: tapeID, PublicID: tapeUUID}
+	tapeCopy := &model.TapeCopy{
+		Barcode:   "VHS-11-4",
+		Condition: model.CopyConditionNew,
+	}
+	savedCopy := &model.TapeCopy{
+		ID:        31,
+		TapeID:    tapeID,
+		Barcode:   "VHS-11-4",
+		Condition: model.CopyConditionNew,
+		Status:    model.CopyStatusAvailable,
+	}
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", ctx, tapeUUID).Return(tape, nil)
+	mockCopyRepo.On("Save", ctx, mock.MatchedBy(func(c *model.TapeCopy) bool {
+		return c.TapeID == tapeID && !c.AcquiredAt.IsZero()
+	})).Return(savedCopy, nil)
+	mockReservationRepo.On("ExpireHolds", ctx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("CountHeldByTape", ctx, tapeID).Return(int64(0), nil)
+	// The new copy goes straight to the first member in the queue
+	mockReservationRepo.On("PromoteWaiting", ctx, tapeID, int32(1), mock.AnythingOfType("time.Time")).Return(int64(1), nil)
+
+	svc := service.NewTapeCopyService(mockCopyRepo, mockTapeRepo, mockReservationRepo, mockTransactor{})
+	result, err := svc.AddCopy(ctx, tapeUUID.String(), tapeCopy)
+
+	assert.Nil(t, err)
+	assert.Equal(t, savedCopy, result)
+	assert.Equal(t, tapeUUID, result.TapePublicID)
+
+	mockCopyRepo.AssertExpectations(t)
+	mockReservationRepo.AssertExpectations(t)
+}
+
+func Test_AddCopy_DuplicateBarcode(t *testing.T) {
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+
+	tapeUUID := uuid.New()
+	tapeCopy := &model.TapeCopy{
+		Barcode:    "VHS-11-1",
+		Condition:  model.CopyConditionGood,
+		AcquiredAt: time.Date(1994, time.March, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	ctx := context.Background()
+	mockTapeRepo.On("GetByPublicIDForUpdate", ctx, tapeUUID).Return(&model.Tape{ID: 11}, nil)
+	mockCopyRepo.On("Save", ctx, tapeCopy).Return(nil, apperror.ErrCopyExists)
+
+	svc := service.NewTapeCopyService(mockCopyRepo, mockTapeRepo, mockReservationRepo, mockTransactor{})
+	result, err := svc.AddCopy(ctx, tapeUUID.String(), tapeCopy)
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, apperror.ErrCopyExists)
+	mockReservationRepo.AssertNotCalled(t, "PromoteWaiting", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_RetireCopy_Success(t *testing.T) {
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+
+	copyUUID := uuid.New()
+	tapeID := int32(12)
+	tapeCopy := &model.TapeCopy{
+		ID:     40,
+		TapeID: tapeID,
+		Status: model.CopyStatusAvailable,
+	}
+
+	ctx := context.Background()
+	mockCopyRepo.On("GetByPublicID", ctx, copyUUID).Return(tapeCopy, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("SetStatus", ctx, tapeCopy.ID, model.CopyStatusRetired).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(0), nil)
+	expectNoReservations(mockReservationRepo, ctx, tapeID)
+
+	svc := service.NewTapeCopyService(mockCopyRepo, mockTapeRepo, mockReservationRepo, mockTransactor{})
+	err := svc.RetireCopy(ctx, copyUUID.String())
+
+	assert.Nil(t, err)
+	mockCopyRepo.AssertExpectations(t)
+	mockReservationRepo.AssertNotCalled(t, "DemoteHeld", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_RetireCopy_OnlyHeldCopy(t *testing.T) {
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+
+	copyUUID := uuid.New()
+	tapeID := int32(12)
+	tapeCopy := &model.TapeCopy{
+		ID:     40,
+		TapeID: tapeID,
+		Status: model.CopyStatusAvailable,
+	}
+
+	ctx := context.Background()
+	mockCopyRepo.On("GetByPublicID", ctx, copyUUID).Return(tapeCopy, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+	mockCopyRepo.On("SetStatus", ctx, tapeCopy.ID, model.CopyStatusRetired).Return(nil)
+	// The retired copy was the one on the shelf, a member still holds the tape
+	mockReservationRepo.On("ExpireHolds", ctx, tapeID, mock.AnythingOfType("time.Time")).Return(nil)
+	mockCopyRepo.On("CountAvailableByTape", ctx, tapeID).Return(int64(0), nil)
+	mockReservationRepo.On("CountHeldByTape", ctx, tapeID).Return(int64(1), nil)
+	mockReservationRepo.On("DemoteHeld", ctx, tapeID, int32(1)).Return(int64(1), nil)
+
+	svc := service.NewTapeCopyService(mockCopyRepo, mockTapeRepo, mockReservationRepo, mockTransactor{})
+	err := svc.RetireCopy(ctx, copyUUID.String())
+
+	assert.Nil(t, err)
+	mockReservationRepo.AssertExpectations(t)
+}
+
+func Test_RetireCopy_Fail_Rented(t *testing.T) {
+	mockCopyRepo := NewTapeCopyMockRepository()
+	mockTapeRepo := NewTapeMockRepository()
+	mockReservationRepo := NewReservationMockRepository()
+
+	copyUUID := uuid.New()
+	tapeID := int32(12)
+
+	ctx := context.Background()
+	mockCopyRepo.On("GetByPublicID", ctx, copyUUID).Return(&model.TapeCopy{
+		ID:     41,
+		TapeID: tapeID,
+		Status: model.CopyStatusRented,
+	}, nil)
+	mockTapeRepo.On("GetByIDForUpdate", ctx, tapeID).Return(&model.Tape{ID: tapeID}, nil)
+
+	svc := service.NewTapeCopyService(mockCopyRepo, mockTapeRepo, mockReservationRepo, mockTransactor{})
+	err := svc.RetireCopy(ctx, copyUUID.String())
+
+	assert.ErrorIs(t, err, apperror.ErrCopyRented)
+	mockCopyRepo.AssertNotCalled(t, "SetStatus", mock.Anything, mock.Anything, mock.Anything)
+}
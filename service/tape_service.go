@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"unicode"
 
-	"github.com/google/uuid"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/model"
 	"github.com/rigofekete/vhs-club-mvc/repository"
@@ -13,6 +16,8 @@ type TapeService interface {
 	CreateTape(ctx context.Context, tape *model.Tape) (*model.Tape, error)
 	CreateTapeBatch(ctx context.Context, tapes []*model.Tape) ([]*model.Tape, *int32, error)
 	GetAllTapes(ctx context.Context) ([]*model.Tape, error)
+	ListTapes(ctx context.Context, filter *model.TapeFilter, cursor string, limit int32) (*model.TapePage, error)
+	SearchTapes(ctx context.Context, query string, limit int32) ([]*model.Tape, error)
 	GetTapeByID(ctx context.Context, id string) (*model.Tape, error)
 	UpdateTape(ctx context.Context, id string, updated *model.UpdateTape) (*model.Tape, error)
 	DeleteTape(ctx context.Context, id string) error
@@ -53,8 +58,72 @@ func (s *tapeService) GetAllTapes(ctx context.Context) ([]*model.Tape, error) {
 	return s.repo.GetAll(ctx)
 }
 
+// Business logic local constants
+const (
+	defaultTapePageSize = 20
+	maxTapePageSize     = 100
+)
+
+func (s *tapeService) ListTapes(ctx context.Context, filter *model.TapeFilter, cursor string, limit int32) (*model.TapePage, error) {
+	if filter.Sort == "" {
+		filter.Sort = model.TapeSortCreatedAt
+	}
+	if limit <= 0 {
+		limit = defaultTapePageSize
+	}
+	limit = min(limit, maxTapePageSize)
+
+	var after *model.TapeCursor
+	if cursor != "" {
+		decoded, err := decodeTapeCursor(cursor)
+		if err != nil || decoded.Sort != filter.Sort {
+			return nil, apperror.ErrInvalidCursor
+		}
+		after = decoded
+	}
+
+	// One extra row tells whether there is a next page without a second query
+	tapes, err := s.repo.List(ctx, filter, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.TapePage{
+		Tapes: tapes,
+		Total: total,
+	}
+	if int32(len(tapes)) > limit {
+		page.Tapes = tapes[:limit]
+		page.NextCursor, err = encodeTapeCursor(filter.Sort, page.Tapes[limit-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// Every word of the query must match, the last one as a prefix so results update while typing
+func (s *tapeService) SearchTapes(ctx context.Context, query string, limit int32) ([]*model.Tape, error) {
+	tsQuery := buildPrefixTSQuery(query)
+	if tsQuery == "" {
+		return nil, apperror.ErrTapeSearchQuery
+	}
+	if limit <= 0 {
+		limit = defaultTapePageSize
+	}
+	limit = min(limit, maxTapePageSize)
+
+	return s.repo.Search(ctx, tsQuery, limit)
+}
+
 func (s *tapeService) GetTapeByID(ctx context.Context, id string) (*model.Tape, error) {
-	idUUID, err := uuid.Parse(id)
+	idUUID, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +132,7 @@ func (s *tapeService) GetTapeByID(ctx context.Context, id string) (*model.Tape,
 }
 
 func (s *tapeService) UpdateTape(ctx context.Context, id string, updateTape *model.UpdateTape) (*model.Tape, error) {
-	idUUID, err := uuid.Parse(id)
+	idUUID, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +148,7 @@ func (s *tapeService) UpdateTape(ctx context.Context, id string, updateTape *mod
 }
 
 func (s *tapeService) DeleteTape(ctx context.Context, id string) error {
-	idUUID, err := uuid.Parse(id)
+	idUUID, err := parseID(id)
 	if err != nil {
 		return err
 	}
@@ -95,3 +164,49 @@ func (s *tapeService) DeleteTape(ctx context.Context, id string) error {
 func (s *tapeService) DeleteAllTapes(ctx context.Context) error {
 	return s.repo.DeleteAll(ctx)
 }
+
+// Helpers
+
+// Builds a to_tsquery expression out of free text. Only letters and digits are kept, so user
+// input can never inject tsquery operators, and every term gets the :* prefix marker.
+func buildPrefixTSQuery(query string) string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Cursors are opaque to clients: base64url encoded JSON of the last tape's sort key
+func encodeTapeCursor(sort string, tape *model.Tape) (string, error) {
+	cursor := model.TapeCursor{
+		Sort:     sort,
+		PublicID: tape.PublicID,
+	}
+	switch sort {
+	case model.TapeSortTitle, model.TapeSortTitleDesc:
+		cursor.Title = tape.Title
+	default:
+		cursor.CreatedAt = tape.CreatedAt
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeTapeCursor(encoded string) (*model.TapeCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var cursor model.TapeCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -2,8 +2,10 @@ package service_test
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
@@ -45,6 +47,27 @@ func (m *mockTapeRepository) GetAll(ctx context.Context) ([]*model.Tape, error)
 	return nil, args.Error(1)
 }
 
+func (m *mockTapeRepository) List(ctx context.Context, filter *model.TapeFilter, cursor *model.TapeCursor, limit int32) ([]*model.Tape, error) {
+	args := m.Called(ctx, filter, cursor, limit)
+	if tapes := args.Get(0); tapes != nil {
+		return tapes.([]*model.Tape), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockTapeRepository) Count(ctx context.Context, filter *model.TapeFilter) (int64, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockTapeRepository) Search(ctx context.Context, tsQuery string, limit int32) ([]*model.Tape, error) {
+	args := m.Called(ctx, tsQuery, limit)
+	if tapes := args.Get(0); tapes != nil {
+		return tapes.([]*model.Tape), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockTapeRepository) GetByID(ctx context.Context, id int32) (*model.Tape, error) {
 	args := m.Called(ctx, id)
 	if tape := args.Get(0); tape != nil {
@@ -53,6 +76,14 @@ func (m *mockTapeRepository) GetByID(ctx context.Context, id int32) (*model.Tape
 	return nil, args.Error(1)
 }
 
+func (m *mockTapeRepository) GetByIDForUpdate(ctx context.Context, id int32) (*model.Tape, error) {
+	args := m.Called(ctx, id)
+	if tape := args.Get(0); tape != nil {
+		return tape.(*model.Tape), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockTapeRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*model.Tape, error) {
 	args := m.Called(ctx, id)
 	if tape := args.Get(0); tape != nil {
@@ -61,6 +92,14 @@ func (m *mockTapeRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*
 	return nil, args.Error(1)
 }
 
+func (m *mockTapeRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.Tape, error) {
+	args := m.Called(ctx, id)
+	if tape := args.Get(0); tape != nil {
+		return tape.(*model.Tape), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockTapeRepository) Update(ctx context.Context, updateTape *model.UpdateTape) (*model.Tape, error) {
 	args := m.Called(ctx, updateTape)
 	if updTape := args.Get(0); updTape != nil {
@@ -234,6 +273,110 @@ func Test_GetAllTapes(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func Test_ListTapes_Paginates(t *testing.T) {
+	mockRepo := NewTapeMockRepository()
+
+	createdAt := time.Date(1984, time.October, 26, 0, 0, 0, 0, time.UTC)
+	batmanUUID := uuid.New()
+	fitzcarraldoUUID := uuid.New()
+	firstPage := []*model.Tape{
+		{ID: 1, PublicID: uuid.New(), Title: "Alien", CreatedAt: createdAt},
+		{ID: 2, PublicID: batmanUUID, Title: "Batman", CreatedAt: createdAt.Add(time.Hour)},
+		// Extra row fetched to detect the next page
+		{ID: 3, PublicID: fitzcarraldoUUID, Title: "Fitzcarraldo", CreatedAt: createdAt.Add(2 * time.Hour)},
+	}
+	secondPage := []*model.Tape{
+		{ID: 3, PublicID: fitzcarraldoUUID, Title: "Fitzcarraldo", CreatedAt: createdAt.Add(2 * time.Hour)},
+	}
+
+	ctx := context.Background()
+	filter := &model.TapeFilter{}
+
+	mockRepo.On("List", ctx, filter, (*model.TapeCursor)(nil), int32(3)).Return(firstPage, nil)
+	mockRepo.On("List", ctx, filter, &model.TapeCursor{
+		Sort:      model.TapeSortCreatedAt,
+		PublicID:  batmanUUID,
+		CreatedAt: createdAt.Add(time.Hour),
+	}, int32(3)).Return(secondPage, nil)
+	mockRepo.On("Count", ctx, filter).Return(int64(3), nil)
+
+	svc := service.NewTapeService(mockRepo)
+	page, err := svc.ListTapes(ctx, filter, "", 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.TapeSortCreatedAt, filter.Sort)
+	assert.Equal(t, firstPage[:2], page.Tapes)
+	assert.Equal(t, int64(3), page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+	// The cursor carries the public ID only, internal IDs never leave the API
+	decoded, err := base64.RawURLEncoding.DecodeString(page.NextCursor)
+	assert.Nil(t, err)
+	assert.Contains(t, string(decoded), batmanUUID.String())
+	assert.NotContains(t, string(decoded), `"id"`)
+
+	page, err = svc.ListTapes(ctx, filter, page.NextCursor, 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, secondPage, page.Tapes)
+	assert.Empty(t, page.NextCursor)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_ListTapes_CursorSortMismatch(t *testing.T) {
+	mockRepo := NewTapeMockRepository()
+
+	ctx := context.Background()
+	byTitle := &model.TapeFilter{Sort: model.TapeSortTitle}
+	mockRepo.On("List", ctx, byTitle, (*model.TapeCursor)(nil), int32(2)).Return([]*model.Tape{
+		{ID: 1, Title: "Alien"},
+		{ID: 2, Title: "Batman"},
+	}, nil)
+	mockRepo.On("Count", ctx, byTitle).Return(int64(2), nil)
+
+	svc := service.NewTapeService(mockRepo)
+	page, err := svc.ListTapes(ctx, byTitle, "", 1)
+	assert.Nil(t, err)
+
+	// A cursor only continues the sort order it was issued for
+	page, err = svc.ListTapes(ctx, &model.TapeFilter{Sort: model.TapeSortCreatedAt}, page.NextCursor, 1)
+
+	assert.Nil(t, page)
+	assert.ErrorIs(t, err, apperror.ErrInvalidCursor)
+
+	_, err = svc.ListTapes(ctx, byTitle, "not-a-cursor", 1)
+	assert.ErrorIs(t, err, apperror.ErrInvalidCursor)
+}
+
+func Test_SearchTapes_PrefixQuery(t *testing.T) {
+	mockRepo := NewTapeMockRepository()
+
+	ctx := context.Background()
+	expected := []*model.Tape{
+		{ID: 1, Title: "Blade Runner", Director: "Ridley Scott"},
+	}
+	// Operators typed by the user are dropped and every term is prefix matched
+	mockRepo.On("Search", ctx, "blade:* & ri:*", int32(20)).Return(expected, nil)
+
+	svc := service.NewTapeService(mockRepo)
+	tapes, err := svc.SearchTapes(ctx, "  Blade & (Ri:", 0)
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, tapes)
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_SearchTapes_EmptyQuery(t *testing.T) {
+	mockRepo := NewTapeMockRepository()
+
+	svc := service.NewTapeService(mockRepo)
+	tapes, err := svc.SearchTapes(context.Background(), " !& ", 10)
+
+	assert.Nil(t, tapes)
+	assert.ErrorIs(t, err, apperror.ErrTapeSearchQuery)
+	mockRepo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func Test_GetTapeByID_Success(t *testing.T) {
 	mockRepo := NewTapeMockRepository()
 
@@ -280,6 +423,19 @@ func TestGetTapeByID_NotFound(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func Test_GetTapeByID_InvalidID(t *testing.T) {
+	mockRepo := NewTapeMockRepository()
+
+	svc := service.NewTapeService(mockRepo)
+
+	tape, err := svc.GetTapeByID(context.Background(), "not-a-uuid")
+
+	assert.ErrorIs(t, err, apperror.ErrInvalidID)
+	assert.Nil(t, tape)
+
+	mockRepo.AssertNotCalled(t, "GetByPublicID", mock.Anything, mock.Anything)
+}
+
 func Test_UpdateTape_Success(t *testing.T) {
 	mockRepo := NewTapeMockRepository()
 
@@ -2,12 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/auth"
+	"github.com/rigofekete/vhs-club-mvc/internal/tracing"
 	"github.com/rigofekete/vhs-club-mvc/model"
 	"github.com/rigofekete/vhs-club-mvc/repository"
 )
@@ -17,21 +19,57 @@ type UserService interface {
 	CreateUserBatch(context.Context, []*model.User) ([]*model.User, *int32, error)
 	GetUserByID(ctx context.Context, id string) (*model.User, error)
 	UserLogin(ctx context.Context, user *model.User) (*model.User, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*model.User, error)
+	Logout(ctx context.Context, refreshToken string) error
 	GetAllUsers(context.Context) ([]*model.User, error)
+	UpdateUser(ctx context.Context, id string, updateUser *model.UpdateUser) (*model.User, error)
+	ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (*model.User, error)
+	SetPassword(ctx context.Context, username, password string) error
+	GetAccountStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error)
+	UpdateUserRole(ctx context.Context, actorID uuid.UUID, id, role string) (*model.User, error)
+	DisableUser(ctx context.Context, actorID uuid.UUID, id string) (*model.User, error)
+	DeleteUser(ctx context.Context, actorID uuid.UUID, id string) error
 	DeleteAllUsers(context.Context) error
 }
 
 type userService struct {
-	repo repository.UserRepository
+	repo       repository.UserRepository
+	tokenRepo  repository.RefreshTokenRepository
+	rentalRepo repository.RentalRepository
+	tx         repository.Transactor
+	tokens     TokenPolicy
+	guard      LoginGuard
 }
 
-func NewUserService(r repository.UserRepository) UserService {
+// Signing key and lifetimes of the JWTs handed out on login and refresh
+type TokenPolicy struct {
+	Secret     string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Throttles logins and locks accounts after repeated wrong passwords, implemented by internal/ratelimit
+type LoginGuard interface {
+	Check(ctx context.Context, username string) error
+	Failed(ctx context.Context, username string) error
+	Succeeded(ctx context.Context, username string) error
+}
+
+func NewUserService(r repository.UserRepository, t repository.RefreshTokenRepository, rentals repository.RentalRepository, tx repository.Transactor, tokens TokenPolicy, guard LoginGuard) UserService {
 	return &userService{
-		repo: r,
+		repo:       r,
+		tokenRepo:  t,
+		rentalRepo: rentals,
+		tx:         tx,
+		tokens:     tokens,
+		guard:      guard,
 	}
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	if err := applyDefaultRole(user); err != nil {
+		return nil, err
+	}
 	hashedPassword, err := auth.HashPassword(user.Password)
 	if err != nil {
 		return nil, err
@@ -42,6 +80,9 @@ func (s *userService) CreateUser(ctx context.Context, user *model.User) (*model.
 
 func (s *userService) CreateUserBatch(ctx context.Context, users []*model.User) ([]*model.User, *int32, error) {
 	for _, user := range users {
+		if err := applyDefaultRole(user); err != nil {
+			return nil, nil, err
+		}
 		hashedPassword, err := auth.HashPassword(user.Password)
 		if err != nil {
 			return nil, nil, err
@@ -52,7 +93,7 @@ func (s *userService) CreateUserBatch(ctx context.Context, users []*model.User)
 }
 
 func (s *userService) GetUserByID(ctx context.Context, id string) (*model.User, error) {
-	idUUID, err := uuid.Parse(id)
+	idUUID, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
@@ -60,34 +101,371 @@ func (s *userService) GetUserByID(ctx context.Context, id string) (*model.User,
 	return s.repo.GetByPublicID(ctx, idUUID)
 }
 
-func (s *userService) UserLogin(ctx context.Context, user *model.User) (*model.User, error) {
+// Hashed on first use rather than at start up, argon2id is deliberately slow
+var dummyPasswordHash = sync.OnceValues(func() (string, error) {
+	return auth.HashPassword("vhs-club-dummy-password")
+})
+
+// Traced since the password hash check dominates the login time
+func (s *userService) UserLogin(ctx context.Context, user *model.User) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UserLogin")
+	defer func() { tracing.End(span, err) }()
+
+	// Refused attempts never reach the costly hash comparison
+	if err := s.guard.Check(ctx, user.Username); err != nil {
+		return nil, err
+	}
+
 	foundUser, err := s.repo.GetByUsername(ctx, user.Username)
-	if err != nil {
+	if err != nil && !errors.Is(err, apperror.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// Unknown usernames are checked against a dummy hash and fail like a wrong password,
+	// so neither the answer nor the response time tells which usernames exist
+	var hash string
+	if foundUser != nil {
+		hash = foundUser.HashedPassword
+	} else if hash, err = dummyPasswordHash(); err != nil {
 		return nil, err
 	}
 
-	valid, err := auth.CheckPasswordHash(user.Password, foundUser.HashedPassword)
+	valid, err := auth.CheckPasswordHash(user.Password, hash)
 	if err != nil {
 		return nil, err
 	}
-	if !valid {
+	if foundUser == nil || !valid {
+		if err := s.guard.Failed(ctx, user.Username); err != nil {
+			return nil, err
+		}
 		return nil, apperror.ErrUserInvalidPW
 	}
+	if err := s.guard.Succeeded(ctx, user.Username); err != nil {
+		return nil, err
+	}
+	// Only reported once the password matched, so it tells guessers nothing
+	if foundUser.DisabledAt.Valid {
+		return nil, apperror.ErrAccountDisabled
+	}
 
-	token, err := auth.MakeJWT(foundUser.PublicID, foundUser.Role, config.AppConfig.JWTSecret, 24*time.Hour)
+	// Every login starts a new refresh token family
+	if err := s.issueTokens(ctx, foundUser, uuid.New()); err != nil {
+		return nil, err
+	}
+
+	return foundUser, nil
+}
+
+// Rotates the refresh token: the presented token is revoked and a new one from the same family is issued.
+// Presenting an already revoked token means it leaked or was replayed, so the whole family is revoked.
+func (s *userService) RefreshToken(ctx context.Context, refreshToken string) (*model.User, error) {
+	_, tokenID, err := auth.ValidateRefreshJWT(refreshToken, s.tokens.Secret)
+	if err != nil {
+		return nil, apperror.ErrInvalidToken
+	}
+
+	var user *model.User
+	reused := false
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		storedToken, err := s.tokenRepo.GetByTokenIDForUpdate(ctx, tokenID)
+		if err != nil {
+			return err
+		}
+
+		if storedToken.RevokedAt.Valid {
+			// Returning nil commits the family revocation, the error is raised after the tx
+			reused = true
+			return s.tokenRepo.RevokeFamily(ctx, storedToken.FamilyID)
+		}
+
+		if time.Now().UTC().After(storedToken.ExpiresAt) {
+			return apperror.ErrInvalidToken
+		}
+
+		if err := s.tokenRepo.Revoke(ctx, storedToken.ID); err != nil {
+			return err
+		}
+
+		user, err = s.repo.GetByID(ctx, storedToken.UserID)
+		if err != nil {
+			return err
+		}
+		if user.DisabledAt.Valid {
+			return apperror.ErrAccountDisabled
+		}
+
+		return s.issueTokens(ctx, user, storedToken.FamilyID)
+	})
 	if err != nil {
 		return nil, err
 	}
+	if reused {
+		return nil, apperror.ErrTokenReused
+	}
 
-	foundUser.Token = token
+	return user, nil
+}
 
-	return foundUser, nil
+// Revokes the refresh token family, logging out the session it belongs to
+func (s *userService) Logout(ctx context.Context, refreshToken string) error {
+	_, tokenID, err := auth.ValidateRefreshJWT(refreshToken, s.tokens.Secret)
+	if err != nil {
+		return apperror.ErrInvalidToken
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		storedToken, err := s.tokenRepo.GetByTokenIDForUpdate(ctx, tokenID)
+		if err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeFamily(ctx, storedToken.FamilyID)
+	})
 }
 
 func (s *userService) GetAllUsers(ctx context.Context) ([]*model.User, error) {
 	return s.repo.GetAll(ctx)
 }
 
+func (s *userService) UpdateUser(ctx context.Context, id string, updateUser *model.UpdateUser) (*model.User, error) {
+	idUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByPublicID(ctx, idUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	updateUser.ID = user.ID
+
+	return s.repo.Update(ctx, updateUser)
+}
+
+// Wrong current passwords count towards the login lockout, so this can't be used to guess it either.
+// Every other session is logged out, the returned user carries the tokens of a fresh one.
+func (s *userService) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (*model.User, error) {
+	idUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByPublicID(ctx, idUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.guard.Check(ctx, user.Username); err != nil {
+		return nil, err
+	}
+	valid, err := auth.CheckPasswordHash(currentPassword, user.HashedPassword)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		if err := s.guard.Failed(ctx, user.Username); err != nil {
+			return nil, err
+		}
+		return nil, apperror.ErrUserInvalidPW
+	}
+	if err := s.guard.Succeeded(ctx, user.Username); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		if err := s.tokenRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.issueTokens(ctx, user, uuid.New())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Replaces the password and logs the user out everywhere, old refresh tokens stop working
+func (s *userService) SetPassword(ctx context.Context, username, password string) error {
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeAllForUser(ctx, user.ID)
+	})
+}
+
+// Role and disabled flag of the account behind an access token, looked up on every authenticated request
+func (s *userService) GetAccountStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error) {
+	return s.repo.GetStatus(ctx, id)
+}
+
+// Promotes or demotes a user and records who did it. Setting the current role again changes nothing
+// and is not recorded. The new role applies from the user's next request, tokens need not be reissued.
+func (s *userService) UpdateUserRole(ctx context.Context, actorID uuid.UUID, id, role string) (*model.User, error) {
+	idUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if idUUID == actorID {
+		// An admin demoting themself could leave the club without any admin
+		return nil, apperror.ErrOwnAccount
+	}
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return nil, apperror.ErrInvalidRole
+	}
+
+	var user *model.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repo.GetByPublicIDForUpdate(ctx, idUUID)
+		if err != nil {
+			return err
+		}
+		if current.Role == role {
+			user = current
+			return nil
+		}
+
+		user, err = s.repo.UpdateRole(ctx, current.ID, role)
+		if err != nil {
+			return err
+		}
+		return s.repo.SaveRoleChange(ctx, &model.RoleChange{
+			UserID:    current.PublicID,
+			ChangedBy: actorID,
+			OldRole:   current.Role,
+			NewRole:   role,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Disabled users can't log in, their refresh tokens are revoked and the auth middleware
+// refuses their access tokens
+func (s *userService) DisableUser(ctx context.Context, actorID uuid.UUID, id string) (*model.User, error) {
+	idUUID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if idUUID == actorID {
+		return nil, apperror.ErrOwnAccount
+	}
+
+	var user *model.User
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repo.GetByPublicIDForUpdate(ctx, idUUID)
+		if err != nil {
+			return err
+		}
+		user, err = s.repo.Disable(ctx, current.ID)
+		if err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeAllForUser(ctx, current.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Users with tapes out or unpaid late fees are kept, deleting them would lose track of the tapes and fees
+func (s *userService) DeleteUser(ctx context.Context, actorID uuid.UUID, id string) error {
+	idUUID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	if idUUID == actorID {
+		return apperror.ErrOwnAccount
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// Renting locks the user row too, so no rental can start between the check and the delete
+		user, err := s.repo.GetByPublicIDForUpdate(ctx, idUUID)
+		if err != nil {
+			return err
+		}
+
+		activeCount, err := s.rentalRepo.GetActiveRentCountByUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		standing, err := s.rentalRepo.GetStanding(ctx, user.ID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if *activeCount > 0 || standing.UnpaidFeesCents > 0 {
+			return apperror.ErrUserHasRentals
+		}
+
+		return s.repo.Delete(ctx, user.ID)
+	})
+}
+
 func (s *userService) DeleteAllUsers(ctx context.Context) error {
 	return s.repo.DeleteAll(ctx)
 }
+
+// Helpers
+
+// Users created without a role are members, anything but the known roles is rejected
+func applyDefaultRole(user *model.User) error {
+	switch user.Role {
+	case "":
+		user.Role = model.RoleUser
+	case model.RoleUser, model.RoleAdmin:
+	default:
+		return apperror.ErrInvalidRole
+	}
+	return nil
+}
+
+// Sets a short lived access token and a stored refresh token of the given family on the user
+func (s *userService) issueTokens(ctx context.Context, user *model.User, familyID uuid.UUID) error {
+	accessToken, err := auth.MakeJWT(user.PublicID, user.Role, s.tokens.Secret, s.tokens.AccessTTL)
+	if err != nil {
+		return err
+	}
+
+	storedToken, err := s.tokenRepo.Save(ctx, &model.RefreshToken{
+		TokenID:   uuid.New(),
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(s.tokens.RefreshTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := auth.MakeRefreshJWT(user.PublicID, storedToken.TokenID, s.tokens.Secret, s.tokens.RefreshTTL)
+	if err != nil {
+		return err
+	}
+
+	user.Token = accessToken
+	user.RefreshToken = refreshToken
+	return nil
+}
@@ -2,11 +2,11 @@ package service_test
 
 import (
 	"context"
-	"os"
+	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/rigofekete/vhs-club-mvc/config"
 	"github.com/rigofekete/vhs-club-mvc/internal/apperror"
 	"github.com/rigofekete/vhs-club-mvc/internal/auth"
 	"github.com/rigofekete/vhs-club-mvc/model"
@@ -15,10 +15,11 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-// Needed to load secret for MakeJWT calls across the service_test package
-func TestMain(m *testing.M) {
-	config.AppConfig = &config.Config{JWTSecret: "test-secret"}
-	os.Exit(m.Run())
+// Signing key and lifetimes for the MakeJWT calls across the service_test package
+var testTokenPolicy = service.TokenPolicy{
+	Secret:     "test-secret",
+	AccessTTL:  15 * time.Minute,
+	RefreshTTL: 7 * 24 * time.Hour,
 }
 
 type mockUserRepository struct {
@@ -61,6 +62,14 @@ func (m *mockUserRepository) GetByPublicID(ctx context.Context, id uuid.UUID) (*
 	return nil, args.Error(1)
 }
 
+func (m *mockUserRepository) GetByPublicIDForUpdate(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	args := m.Called(ctx, id)
+	if user := args.Get(0); user != nil {
+		return user.(*model.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockUserRepository) GetByUsername(ctx context.Context, username string) (*model.User, error) {
 	args := m.Called(ctx, username)
 	if user := args.Get(0); user != nil {
@@ -69,6 +78,14 @@ func (m *mockUserRepository) GetByUsername(ctx context.Context, username string)
 	return nil, args.Error(1)
 }
 
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	args := m.Called(ctx, email)
+	if user := args.Get(0); user != nil {
+		return user.(*model.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
 func (m *mockUserRepository) GetAll(ctx context.Context) ([]*model.User, error) {
 	args := m.Called(ctx)
 	if users := args.Get(0); users != nil {
@@ -77,11 +94,118 @@ func (m *mockUserRepository) GetAll(ctx context.Context) ([]*model.User, error)
 	return nil, args.Error(1)
 }
 
+func (m *mockUserRepository) Update(ctx context.Context, updateUser *model.UpdateUser) (*model.User, error) {
+	args := m.Called(ctx, updateUser)
+	if u := args.Get(0); u != nil {
+		return u.(*model.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockUserRepository) UpdatePassword(ctx context.Context, id int32, hashedPassword string) error {
+	args := m.Called(ctx, id, hashedPassword)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) GetStatus(ctx context.Context, id uuid.UUID) (*model.AccountStatus, error) {
+	args := m.Called(ctx, id)
+	if status := args.Get(0); status != nil {
+		return status.(*model.AccountStatus), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockUserRepository) UpdateRole(ctx context.Context, id int32, role string) (*model.User, error) {
+	args := m.Called(ctx, id, role)
+	if u := args.Get(0); u != nil {
+		return u.(*model.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockUserRepository) SaveRoleChange(ctx context.Context, change *model.RoleChange) error {
+	args := m.Called(ctx, change)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) Disable(ctx context.Context, id int32) (*model.User, error) {
+	args := m.Called(ctx, id)
+	if u := args.Get(0); u != nil {
+		return u.(*model.User), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockUserRepository) Delete(ctx context.Context, id int32) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
 func (m *mockUserRepository) DeleteAll(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
 
+type mockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func NewRefreshTokenMockRepository() *mockRefreshTokenRepository {
+	return &mockRefreshTokenRepository{}
+}
+
+func (m *mockRefreshTokenRepository) Save(ctx context.Context, token *model.RefreshToken) (*model.RefreshToken, error) {
+	args := m.Called(ctx, token)
+	if t := args.Get(0); t != nil {
+		return t.(*model.RefreshToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRefreshTokenRepository) GetByTokenIDForUpdate(ctx context.Context, tokenID uuid.UUID) (*model.RefreshToken, error) {
+	args := m.Called(ctx, tokenID)
+	if t := args.Get(0); t != nil {
+		return t.(*model.RefreshToken), args.Error(1)
+	}
+	return nil, args.Error(1)
+}
+
+func (m *mockRefreshTokenRepository) Revoke(ctx context.Context, id int32) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *mockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *mockRefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int32) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// Records the login outcomes reported to the guard, refuses every attempt when refuse is set
+type fakeLoginGuard struct {
+	refuse    error
+	failed    []string
+	succeeded []string
+}
+
+func (g *fakeLoginGuard) Check(ctx context.Context, username string) error {
+	return g.refuse
+}
+
+func (g *fakeLoginGuard) Failed(ctx context.Context, username string) error {
+	g.failed = append(g.failed, username)
+	return nil
+}
+
+func (g *fakeLoginGuard) Succeeded(ctx context.Context, username string) error {
+	g.succeeded = append(g.succeeded, username)
+	return nil
+}
+
 func Test_CreateUser_Success(t *testing.T) {
 	mockRepo := NewUserMockRepository()
 
@@ -103,7 +227,7 @@ func Test_CreateUser_Success(t *testing.T) {
 
 	mockRepo.On("Save", ctx, inputUser).Return(createdUser, nil)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	user, err := svc.CreateUser(ctx, inputUser)
 
 	assert.Nil(t, err)
@@ -124,7 +248,7 @@ func Test_CreateUser_Fail(t *testing.T) {
 
 	mockRepo.On("Save", ctx, inputUser).Return(nil, apperror.ErrUserExists)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	user, err := svc.CreateUser(ctx, inputUser)
 
 	assert.Nil(t, user)
@@ -134,6 +258,49 @@ func Test_CreateUser_Fail(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func Test_CreateUser_DefaultsToUserRole(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	inputUser := &model.User{
+		Username: "HedyLamarr",
+		Email:    "frequency.hopping@patent.gov",
+		Password: "12345678",
+	}
+
+	ctx := context.Background()
+	mockRepo.On("Save", ctx, mock.MatchedBy(func(u *model.User) bool {
+		return u.Role == model.RoleUser
+	})).Return(&model.User{ID: 15, Role: model.RoleUser}, nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.CreateUser(ctx, inputUser)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.RoleUser, user.Role)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_CreateUser_InvalidRole(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	inputUser := &model.User{
+		Username: "HedyLamarr",
+		Email:    "frequency.hopping@patent.gov",
+		Role:     "projectionist",
+		Password: "12345678",
+	}
+
+	ctx := context.Background()
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.CreateUser(ctx, inputUser)
+
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, apperror.ErrInvalidRole)
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
 func Test_UserLogin_Success(t *testing.T) {
 	mockRepo := NewUserMockRepository()
 
@@ -158,14 +325,28 @@ func Test_UserLogin_Success(t *testing.T) {
 
 	ctx := context.Background()
 
-	mockRepo.On("GetByUsername", ctx, user.Username).Return(foundUser, nil)
-	svc := service.NewUserService(mockRepo)
+	mockTokenRepo := NewRefreshTokenMockRepository()
+	storedToken := &model.RefreshToken{
+		ID:       3,
+		TokenID:  uuid.New(),
+		FamilyID: uuid.New(),
+	}
+
+	mockRepo.On("GetByUsername", tracedCtx, user.Username).Return(foundUser, nil)
+	mockTokenRepo.On("Save", tracedCtx, mock.AnythingOfType("*model.RefreshToken")).Return(storedToken, nil)
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	loggedUser, err := svc.UserLogin(ctx, user)
 
 	assert.Nil(t, err)
 	assert.NotEqual(t, loggedUser.Token, "")
+	assert.NotEqual(t, loggedUser.RefreshToken, "")
+
+	_, tokenID, err := auth.ValidateRefreshJWT(loggedUser.RefreshToken, testTokenPolicy.Secret)
+	assert.Nil(t, err)
+	assert.Equal(t, storedToken.TokenID, tokenID)
 
 	mockRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
 }
 
 func Test_UserLogin_UserNotFound(t *testing.T) {
@@ -185,13 +366,17 @@ func Test_UserLogin_UserNotFound(t *testing.T) {
 
 	ctx := context.Background()
 
-	mockRepo.On("GetByUsername", ctx, user.Username).Return(nil, apperror.ErrUserNotFound)
-	svc := service.NewUserService(mockRepo)
+	mockRepo.On("GetByUsername", tracedCtx, user.Username).Return(nil, apperror.ErrUserNotFound)
+	guard := &fakeLoginGuard{}
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, guard)
 	nullUser, err := svc.UserLogin(ctx, user)
 
+	// Unknown usernames look exactly like a wrong password and count towards the lockout
 	assert.Nil(t, nullUser)
 	assert.Error(t, err)
-	assert.Equal(t, err, apperror.ErrUserNotFound)
+	assert.Equal(t, err, apperror.ErrUserInvalidPW)
+	assert.Equal(t, []string{"JohnRomero"}, guard.failed)
+	assert.Empty(t, guard.succeeded)
 
 	mockRepo.AssertExpectations(t)
 }
@@ -213,8 +398,8 @@ func Test_UserLogin_InvalidPW(t *testing.T) {
 
 	ctx := context.Background()
 
-	mockRepo.On("GetByUsername", ctx, user.Username).Return(nil, apperror.ErrUserInvalidPW)
-	svc := service.NewUserService(mockRepo)
+	mockRepo.On("GetByUsername", tracedCtx, user.Username).Return(nil, apperror.ErrUserInvalidPW)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	nullUser, err := svc.UserLogin(ctx, user)
 
 	assert.Nil(t, nullUser)
@@ -224,6 +409,65 @@ func Test_UserLogin_InvalidPW(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func Test_UserLogin_WrongPasswordCountsTowardsLockout(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	hashed, _ := auth.HashPassword("DoomGuy")
+	foundUser := &model.User{
+		ID:             5,
+		PublicID:       uuid.New(),
+		Username:       "JohnRomero",
+		HashedPassword: hashed,
+	}
+
+	mockRepo.On("GetByUsername", tracedCtx, foundUser.Username).Return(foundUser, nil)
+	guard := &fakeLoginGuard{}
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, guard)
+	nullUser, err := svc.UserLogin(context.Background(), &model.User{Username: foundUser.Username, Password: "Quake"})
+
+	assert.Nil(t, nullUser)
+	assert.Equal(t, apperror.ErrUserInvalidPW, err)
+	assert.Equal(t, []string{"JohnRomero"}, guard.failed)
+	assert.Empty(t, guard.succeeded)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_UserLogin_DisabledAccount(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	hashed, _ := auth.HashPassword("DoomGuy")
+	foundUser := &model.User{
+		ID:             5,
+		PublicID:       uuid.New(),
+		Username:       "JohnRomero",
+		HashedPassword: hashed,
+		DisabledAt:     sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}
+
+	mockRepo.On("GetByUsername", tracedCtx, foundUser.Username).Return(foundUser, nil)
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	nullUser, err := svc.UserLogin(context.Background(), &model.User{Username: foundUser.Username, Password: "DoomGuy"})
+
+	assert.Nil(t, nullUser)
+	assert.ErrorIs(t, err, apperror.ErrAccountDisabled)
+	mockTokenRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func Test_UserLogin_LockedAccountSkipsPasswordCheck(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	locked := apperror.WithRetryAfter(apperror.ErrAccountLocked, time.Minute)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{refuse: locked})
+	nullUser, err := svc.UserLogin(context.Background(), &model.User{Username: "JohnRomero", Password: "DoomGuy"})
+
+	assert.Nil(t, nullUser)
+	assert.ErrorIs(t, err, apperror.ErrAccountLocked)
+
+	mockRepo.AssertNotCalled(t, "GetByUsername", mock.Anything, mock.Anything)
+}
+
 func Test_CreateUserBatch_Success(t *testing.T) {
 	mockRepo := NewUserMockRepository()
 
@@ -263,7 +507,7 @@ func Test_CreateUserBatch_Success(t *testing.T) {
 
 	mockRepo.On("SaveBatch", ctx, userBatch).Return(savedBatch, &countArg, nil)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	users, existCount, err := svc.CreateUserBatch(ctx, userBatch)
 
 	assert.Nil(t, err)
@@ -289,7 +533,7 @@ func Test_GetUserByID_Success(t *testing.T) {
 
 	mockRepo.On("GetByPublicID", ctx, idUUID).Return(returnedUser, nil)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	user, err := svc.GetUserByID(ctx, idUUID.String())
 
 	assert.Nil(t, err)
@@ -307,7 +551,7 @@ func Test_GetUserByID_Fail(t *testing.T) {
 
 	mockRepo.On("GetByPublicID", ctx, idUUID).Return(nil, apperror.ErrUserNotFound)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	user, err := svc.GetUserByID(ctx, idUUID.String())
 
 	assert.Nil(t, user)
@@ -326,7 +570,7 @@ func Test_GetAllUsers_Success(t *testing.T) {
 
 	mockRepo.On("GetAll", ctx).Return(dbUsers, nil)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	users, err := svc.GetAllUsers(ctx)
 
 	assert.Nil(t, err)
@@ -341,10 +585,354 @@ func Test_DeleteAllUsers(t *testing.T) {
 	ctx := context.Background()
 	mockRepo.On("DeleteAll", ctx).Return(nil)
 
-	svc := service.NewUserService(mockRepo)
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
 	err := svc.DeleteAllUsers(ctx)
 
 	assert.Nil(t, err)
 
 	mockRepo.AssertExpectations(t)
 }
+
+func Test_RefreshToken_Success(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	userID := int32(7)
+	userPublicID := uuid.New()
+	familyID := uuid.New()
+	presentedToken := &model.RefreshToken{
+		ID:        11,
+		TokenID:   uuid.New(),
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+	}
+	rotatedToken := &model.RefreshToken{
+		ID:       12,
+		TokenID:  uuid.New(),
+		FamilyID: familyID,
+		UserID:   userID,
+	}
+	user := &model.User{
+		ID:       userID,
+		PublicID: userPublicID,
+		Username: "LinusTorvalds",
+		Role:     "user",
+	}
+
+	refreshToken, _ := auth.MakeRefreshJWT(userPublicID, presentedToken.TokenID, testTokenPolicy.Secret, time.Hour)
+
+	ctx := context.Background()
+	mockTokenRepo.On("GetByTokenIDForUpdate", ctx, presentedToken.TokenID).Return(presentedToken, nil)
+	mockTokenRepo.On("Revoke", ctx, presentedToken.ID).Return(nil)
+	mockRepo.On("GetByID", ctx, userID).Return(user, nil)
+	mockTokenRepo.On("Save", ctx, mock.MatchedBy(func(token *model.RefreshToken) bool {
+		// Rotation keeps the token family
+		return token.FamilyID == familyID && token.UserID == userID
+	})).Return(rotatedToken, nil)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	refreshedUser, err := svc.RefreshToken(ctx, refreshToken)
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", refreshedUser.Token)
+
+	_, tokenID, err := auth.ValidateRefreshJWT(refreshedUser.RefreshToken, testTokenPolicy.Secret)
+	assert.Nil(t, err)
+	assert.Equal(t, rotatedToken.TokenID, tokenID)
+
+	mockRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_RefreshToken_Reused_RevokesFamily(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	familyID := uuid.New()
+	revokedToken := &model.RefreshToken{
+		ID:        11,
+		TokenID:   uuid.New(),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}
+
+	refreshToken, _ := auth.MakeRefreshJWT(uuid.New(), revokedToken.TokenID, testTokenPolicy.Secret, time.Hour)
+
+	ctx := context.Background()
+	mockTokenRepo.On("GetByTokenIDForUpdate", ctx, revokedToken.TokenID).Return(revokedToken, nil)
+	mockTokenRepo.On("RevokeFamily", ctx, familyID).Return(nil)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	refreshedUser, err := svc.RefreshToken(ctx, refreshToken)
+
+	assert.Nil(t, refreshedUser)
+	assert.ErrorIs(t, err, apperror.ErrTokenReused)
+
+	mockTokenRepo.AssertExpectations(t)
+	mockTokenRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func Test_RefreshToken_AccessTokenRejected(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	accessToken, _ := auth.MakeJWT(uuid.New(), "user", testTokenPolicy.Secret, time.Hour)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	refreshedUser, err := svc.RefreshToken(context.Background(), accessToken)
+
+	assert.Nil(t, refreshedUser)
+	assert.ErrorIs(t, err, apperror.ErrInvalidToken)
+
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_Logout_RevokesFamily(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	storedToken := &model.RefreshToken{
+		ID:       11,
+		TokenID:  uuid.New(),
+		FamilyID: uuid.New(),
+	}
+
+	refreshToken, _ := auth.MakeRefreshJWT(uuid.New(), storedToken.TokenID, testTokenPolicy.Secret, time.Hour)
+
+	ctx := context.Background()
+	mockTokenRepo.On("GetByTokenIDForUpdate", ctx, storedToken.TokenID).Return(storedToken, nil)
+	mockTokenRepo.On("RevokeFamily", ctx, storedToken.FamilyID).Return(nil)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	err := svc.Logout(ctx, refreshToken)
+
+	assert.Nil(t, err)
+
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_UpdateUser_Email(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	publicID := uuid.New()
+	email := "ada@engines.org"
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicID", ctx, publicID).Return(&model.User{ID: 21, PublicID: publicID}, nil)
+	mockRepo.On("Update", ctx, &model.UpdateUser{ID: 21, Email: &email}).Return(&model.User{ID: 21, PublicID: publicID, Email: email}, nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.UpdateUser(ctx, publicID.String(), &model.UpdateUser{Email: &email})
+
+	assert.Nil(t, err)
+	assert.Equal(t, email, user.Email)
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_ChangePassword_IssuesNewSession(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	publicID := uuid.New()
+	userID := int32(21)
+	hashed, _ := auth.HashPassword("difference1822")
+	newPassword := "analytical1843"
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicID", ctx, publicID).Return(&model.User{ID: userID, PublicID: publicID, Username: "AdaLovelace", Role: model.RoleUser, HashedPassword: hashed}, nil)
+	mockRepo.On("UpdatePassword", ctx, userID, mock.MatchedBy(func(hash string) bool {
+		valid, err := auth.CheckPasswordHash(newPassword, hash)
+		return err == nil && valid
+	})).Return(nil)
+	mockTokenRepo.On("RevokeAllForUser", ctx, userID).Return(nil)
+	mockTokenRepo.On("Save", ctx, mock.AnythingOfType("*model.RefreshToken")).Return(&model.RefreshToken{TokenID: uuid.New()}, nil)
+
+	guard := &fakeLoginGuard{}
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, guard)
+	user, err := svc.ChangePassword(ctx, publicID.String(), "difference1822", newPassword)
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, user.Token)
+	assert.NotEmpty(t, user.RefreshToken)
+	// The right current password clears earlier failures like a login does
+	assert.Equal(t, []string{"AdaLovelace"}, guard.succeeded)
+	mockRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_ChangePassword_WrongCurrentPassword(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	publicID := uuid.New()
+	hashed, _ := auth.HashPassword("difference1822")
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicID", ctx, publicID).Return(&model.User{ID: 21, PublicID: publicID, Username: "AdaLovelace", HashedPassword: hashed}, nil)
+
+	guard := &fakeLoginGuard{}
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, guard)
+	user, err := svc.ChangePassword(ctx, publicID.String(), "guess", "analytical1843")
+
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, apperror.ErrUserInvalidPW)
+	assert.Equal(t, []string{"AdaLovelace"}, guard.failed)
+	mockRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func Test_SetPassword_RevokesSessions(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	username := "AdaLovelace"
+	userID := int32(21)
+	newPassword := "analytical1843"
+
+	ctx := context.Background()
+	mockRepo.On("GetByUsername", ctx, username).Return(&model.User{ID: userID, Username: username}, nil)
+	mockRepo.On("UpdatePassword", ctx, userID, mock.MatchedBy(func(hash string) bool {
+		valid, err := auth.CheckPasswordHash(newPassword, hash)
+		return err == nil && valid
+	})).Return(nil)
+	mockTokenRepo.On("RevokeAllForUser", ctx, userID).Return(nil)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	err := svc.SetPassword(ctx, username, newPassword)
+
+	assert.Nil(t, err)
+	mockRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_SetPassword_UserNotFound(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	ctx := context.Background()
+	mockRepo.On("GetByUsername", ctx, "Nobody").Return(nil, apperror.ErrUserNotFound)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	err := svc.SetPassword(ctx, "Nobody", "whatever123")
+
+	assert.ErrorIs(t, err, apperror.ErrUserNotFound)
+	mockTokenRepo.AssertNotCalled(t, "RevokeAllForUser", mock.Anything, mock.Anything)
+}
+
+func Test_UpdateUserRole_RecordsChange(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	adminID := uuid.New()
+	publicID := uuid.New()
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicIDForUpdate", ctx, publicID).Return(&model.User{ID: 21, PublicID: publicID, Role: model.RoleUser}, nil)
+	mockRepo.On("UpdateRole", ctx, int32(21), model.RoleAdmin).Return(&model.User{ID: 21, PublicID: publicID, Role: model.RoleAdmin}, nil)
+	mockRepo.On("SaveRoleChange", ctx, &model.RoleChange{
+		UserID:    publicID,
+		ChangedBy: adminID,
+		OldRole:   model.RoleUser,
+		NewRole:   model.RoleAdmin,
+	}).Return(nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.UpdateUserRole(ctx, adminID, publicID.String(), model.RoleAdmin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.RoleAdmin, user.Role)
+	mockRepo.AssertExpectations(t)
+}
+
+func Test_UpdateUserRole_SameRoleNotRecorded(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	publicID := uuid.New()
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicIDForUpdate", ctx, publicID).Return(&model.User{ID: 21, PublicID: publicID, Role: model.RoleAdmin}, nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.UpdateUserRole(ctx, uuid.New(), publicID.String(), model.RoleAdmin)
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.RoleAdmin, user.Role)
+	mockRepo.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "SaveRoleChange", mock.Anything, mock.Anything)
+}
+
+func Test_UpdateUserRole_OwnAccount(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+
+	adminID := uuid.New()
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.UpdateUserRole(context.Background(), adminID, adminID.String(), model.RoleUser)
+
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, apperror.ErrOwnAccount)
+	mockRepo.AssertNotCalled(t, "GetByPublicIDForUpdate", mock.Anything, mock.Anything)
+}
+
+func Test_DisableUser_RevokesSessions(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockTokenRepo := NewRefreshTokenMockRepository()
+
+	publicID := uuid.New()
+	userID := int32(21)
+	disabledAt := sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicIDForUpdate", ctx, publicID).Return(&model.User{ID: userID, PublicID: publicID}, nil)
+	mockRepo.On("Disable", ctx, userID).Return(&model.User{ID: userID, PublicID: publicID, DisabledAt: disabledAt}, nil)
+	mockTokenRepo.On("RevokeAllForUser", ctx, userID).Return(nil)
+
+	svc := service.NewUserService(mockRepo, mockTokenRepo, NewRentalMockRepository(), mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	user, err := svc.DisableUser(ctx, uuid.New(), publicID.String())
+
+	assert.Nil(t, err)
+	assert.True(t, user.DisabledAt.Valid)
+	mockRepo.AssertExpectations(t)
+	mockTokenRepo.AssertExpectations(t)
+}
+
+func Test_DeleteUser_Success(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockRentalRepo := NewRentalMockRepository()
+
+	publicID := uuid.New()
+	userID := int32(21)
+	noRentals := int64(0)
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicIDForUpdate", ctx, publicID).Return(&model.User{ID: userID, PublicID: publicID}, nil)
+	mockRentalRepo.On("GetActiveRentCountByUser", ctx, userID).Return(&noRentals, nil)
+	mockRentalRepo.On("GetStanding", ctx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+	mockRepo.On("Delete", ctx, userID).Return(nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), mockRentalRepo, mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	err := svc.DeleteUser(ctx, uuid.New(), publicID.String())
+
+	assert.Nil(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRentalRepo.AssertExpectations(t)
+}
+
+func Test_DeleteUser_ActiveRentals(t *testing.T) {
+	mockRepo := NewUserMockRepository()
+	mockRentalRepo := NewRentalMockRepository()
+
+	publicID := uuid.New()
+	userID := int32(21)
+	active := int64(1)
+	ctx := context.Background()
+
+	mockRepo.On("GetByPublicIDForUpdate", ctx, publicID).Return(&model.User{ID: userID, PublicID: publicID}, nil)
+	mockRentalRepo.On("GetActiveRentCountByUser", ctx, userID).Return(&active, nil)
+	mockRentalRepo.On("GetStanding", ctx, userID, mock.AnythingOfType("time.Time")).Return(&model.RentalStanding{}, nil)
+
+	svc := service.NewUserService(mockRepo, NewRefreshTokenMockRepository(), mockRentalRepo, mockTransactor{}, testTokenPolicy, &fakeLoginGuard{})
+	err := svc.DeleteUser(ctx, uuid.New(), publicID.String())
+
+	assert.ErrorIs(t, err, apperror.ErrUserHasRentals)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
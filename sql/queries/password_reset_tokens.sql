@@ -0,0 +1,19 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+VALUES (
+  $1,
+  $2,
+  $3
+);
+
+-- name: GetPasswordResetTokenForUpdate :one
+-- Row lock held until the surrounding transaction ends
+SELECT * FROM password_reset_tokens
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: UseUserPasswordResetTokens :exec
+-- Marks every outstanding token of the user as used, not just the one presented
+UPDATE password_reset_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,30 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token_id, family_id, user_id, expires_at)
+VALUES (
+  $1,
+  $2,
+  $3,
+  $4
+)
+RETURNING *;
+
+-- name: GetRefreshTokenForUpdate :one
+-- Row lock held until the surrounding transaction ends
+SELECT * FROM refresh_tokens
+WHERE token_id = $1
+FOR UPDATE;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
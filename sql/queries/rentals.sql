@@ -1,16 +1,18 @@
 -- name: CreateRental :one
 WITH new_rental AS (
-  INSERT INTO rentals (user_id, tape_id)
-  VALUES ($1, $2)
+  INSERT INTO rentals (user_id, tape_id, copy_id, due_at)
+  VALUES ($1, $2, $3, $4)
   RETURNING *
 )
 SELECT
   new_rental.*,
   tapes.title,
-  users.username
+  users.username,
+  tape_copies.barcode
 FROM new_rental
 JOIN tapes ON new_rental.tape_id = tapes.id
-JOIN users ON new_rental.user_id = users.id;
+JOIN users ON new_rental.user_id = users.id
+LEFT JOIN tape_copies ON new_rental.copy_id = tape_copies.id;
 
 
 INSERT INTO rentals (user_id, tape_id)
@@ -22,12 +24,15 @@ RETURNING *;
 
 -- name: ReturnTape :exec
 UPDATE rentals
-SET returned_at = NOW()
-WHERE id = $1;
+SET
+  returned_at = sqlc.arg('returned_at')::timestamp,
+  late_fee_cents = sqlc.arg('late_fee_cents')
+WHERE id = sqlc.arg('id');
 
 -- name: GetActiveRental :one
 SELECT * FROM rentals
-WHERE public_id = $1 AND user_id = $2 AND returned_at IS NULL;
+WHERE public_id = $1 AND user_id = $2 AND returned_at IS NULL
+FOR UPDATE;
 
 -- name: GetActiveRentalsByUser :many
 SELECT * FROM rentals
@@ -50,13 +55,80 @@ WHERE tape_id = $1 AND returned_at IS NULL;
 SELECT
   rentals.*,
   tapes.title,
-  users.username
+  users.username,
+  tape_copies.barcode
 FROM rentals
 JOIN tapes ON rentals.tape_id = tapes.id
 JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
 WHERE returned_at IS NULL
 ORDER BY rentals.created_at ASC;
 
+-- name: GetRentalHistoryByUser :many
+-- Active and returned rentals of a user, NULL filters are ignored
+SELECT
+  rentals.*,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM rentals
+JOIN tapes ON rentals.tape_id = tapes.id
+JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
+WHERE rentals.user_id = sqlc.arg('user_id')
+  AND (sqlc.narg('tape_id')::int IS NULL OR rentals.tape_id = sqlc.narg('tape_id')::int)
+  AND (sqlc.narg('rented_from')::timestamp IS NULL OR rentals.rented_at >= sqlc.narg('rented_from')::timestamp)
+  AND (sqlc.narg('rented_to')::timestamp IS NULL OR rentals.rented_at < sqlc.narg('rented_to')::timestamp)
+  AND (
+    sqlc.narg('status')::text IS NULL
+    OR (sqlc.narg('status')::text = 'active' AND rentals.returned_at IS NULL)
+    OR (sqlc.narg('status')::text = 'returned' AND rentals.returned_at IS NOT NULL)
+  )
+ORDER BY rentals.rented_at DESC;
+
+-- name: GetOverdueRentals :many
+SELECT
+  rentals.*,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM rentals
+JOIN tapes ON rentals.tape_id = tapes.id
+JOIN users ON rentals.user_id = users.id
+LEFT JOIN tape_copies ON rentals.copy_id = tape_copies.id
+WHERE rentals.returned_at IS NULL AND rentals.due_at < sqlc.arg('now')::timestamp
+ORDER BY rentals.due_at ASC;
+
+-- name: GetUserRentalStanding :one
+-- Overdue tapes still out and late fees not paid yet, either one blocks new rentals
+SELECT
+  COUNT(*) FILTER (WHERE returned_at IS NULL AND due_at < sqlc.arg('now')::timestamp) AS overdue_count,
+  COALESCE(SUM(late_fee_cents) FILTER (WHERE fee_paid_at IS NULL), 0)::bigint AS unpaid_fees_cents
+FROM rentals
+WHERE user_id = sqlc.arg('user_id');
+
+-- name: PayRentalLateFee :execrows
+UPDATE rentals
+SET fee_paid_at = NOW()
+WHERE public_id = $1 AND late_fee_cents > 0 AND fee_paid_at IS NULL;
+
+-- name: RenewRental :one
+-- Pushes the due date of an active rental and counts the renewal
+WITH renewed_rental AS (
+  UPDATE rentals
+  SET due_at = sqlc.arg('due_at')::timestamp, renewals = renewals + 1
+  WHERE id = sqlc.arg('id') AND returned_at IS NULL
+  RETURNING *
+)
+SELECT
+  renewed_rental.*,
+  tapes.title,
+  users.username,
+  tape_copies.barcode
+FROM renewed_rental
+JOIN tapes ON renewed_rental.tape_id = tapes.id
+JOIN users ON renewed_rental.user_id = users.id
+LEFT JOIN tape_copies ON renewed_rental.copy_id = tape_copies.id;
 
 -- name: DeleteAllRentals :exec
 DELETE FROM rentals;
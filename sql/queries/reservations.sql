@@ -0,0 +1,96 @@
+-- name: CreateReservation :one
+-- The new row is not visible to the subquery yet, hence the + 1
+WITH new_reservation AS (
+  INSERT INTO reservations (user_id, tape_id)
+  VALUES ($1, $2)
+  RETURNING *
+)
+SELECT
+  new_reservation.*,
+  tapes.public_id AS tape_public_id,
+  tapes.title,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = new_reservation.tape_id AND reservations.status = 'waiting'
+  )::int + 1 AS position
+FROM new_reservation
+JOIN tapes ON new_reservation.tape_id = tapes.id;
+
+-- name: GetReservationByPublicID :one
+SELECT * FROM reservations
+WHERE public_id = $1 AND user_id = $2;
+
+-- name: GetReservationByPublicIDForUpdate :one
+SELECT * FROM reservations
+WHERE public_id = $1 AND user_id = $2
+FOR UPDATE;
+
+-- name: GetOpenReservation :one
+SELECT * FROM reservations
+WHERE user_id = $1 AND tape_id = $2 AND status IN ('waiting', 'held');
+
+-- name: GetOpenReservationsByUser :many
+-- position is the 1-based place in the tape queue, only meaningful for waiting reservations
+SELECT
+  reservations.*,
+  tapes.public_id AS tape_public_id,
+  tapes.title,
+  (
+    SELECT COUNT(*) FROM reservations AS ahead
+    WHERE ahead.tape_id = reservations.tape_id
+      AND ahead.status = 'waiting'
+      AND (ahead.created_at, ahead.id) <= (reservations.created_at, reservations.id)
+  )::int AS position
+FROM reservations
+JOIN tapes ON reservations.tape_id = tapes.id
+WHERE reservations.user_id = $1 AND reservations.status IN ('waiting', 'held')
+ORDER BY reservations.created_at ASC;
+
+-- name: CountHeldReservationsByTape :one
+SELECT COUNT(*) FROM reservations
+WHERE tape_id = $1 AND status = 'held';
+
+-- name: CountWaitingReservationsByTape :one
+SELECT COUNT(*) FROM reservations
+WHERE tape_id = $1 AND status = 'waiting';
+
+-- name: ExpireReservationHolds :exec
+UPDATE reservations
+SET status = 'expired', updated_at = NOW()
+WHERE tape_id = sqlc.arg('tape_id') AND status = 'held' AND hold_expires_at <= sqlc.arg('now')::timestamp;
+
+-- name: PromoteWaitingReservations :execrows
+-- FIFO, the oldest waiting reservations get the free copies
+UPDATE reservations
+SET status = 'held', hold_expires_at = sqlc.arg('hold_expires_at')::timestamp, updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM reservations
+  WHERE tape_id = sqlc.arg('tape_id') AND status = 'waiting'
+  ORDER BY created_at ASC, id ASC
+  LIMIT sqlc.arg('slots')
+);
+
+-- name: DemoteNewestHolds :execrows
+-- The newest holds go back to waiting, their created_at keeps them first in line
+UPDATE reservations
+SET status = 'waiting', hold_expires_at = NULL, updated_at = NOW()
+WHERE id IN (
+  SELECT id FROM reservations
+  WHERE tape_id = sqlc.arg('tape_id') AND status = 'held'
+  ORDER BY hold_expires_at DESC, id DESC
+  LIMIT sqlc.arg('slots')
+);
+
+-- name: FulfillReservation :exec
+UPDATE reservations
+SET status = 'fulfilled', updated_at = NOW()
+WHERE id = $1;
+
+-- name: CancelReservation :execrows
+UPDATE reservations
+SET status = 'cancelled', updated_at = NOW()
+WHERE id = $1 AND status IN ('waiting', 'held');
+
+-- name: GetTapeIDsWithExpiredHolds :many
+SELECT DISTINCT tape_id FROM reservations
+WHERE status = 'held' AND hold_expires_at <= sqlc.arg('now')::timestamp;
@@ -0,0 +1,49 @@
+-- name: CreateTapeCopy :one
+INSERT INTO tape_copies (tape_id, barcode, condition, acquired_at)
+VALUES (
+  $1,
+  $2,
+  $3,
+  $4
+)
+RETURNING *;
+
+-- name: GetTapeCopyByPublicID :one
+SELECT
+  tape_copies.*,
+  tapes.public_id AS tape_public_id
+FROM tape_copies
+JOIN tapes ON tape_copies.tape_id = tapes.id
+WHERE tape_copies.public_id = $1;
+
+-- name: GetTapeCopiesByTape :many
+SELECT * FROM tape_copies
+WHERE tape_id = $1
+ORDER BY id ASC;
+
+-- name: GetAvailableTapeCopy :one
+-- Oldest copy on the shelf first
+SELECT * FROM tape_copies
+WHERE tape_id = $1 AND status = 'available'
+ORDER BY id ASC
+LIMIT 1;
+
+-- name: CountAvailableTapeCopies :one
+SELECT COUNT(*) FROM tape_copies
+WHERE tape_id = $1 AND status = 'available';
+
+-- name: SetTapeCopyStatus :exec
+UPDATE tape_copies
+SET status = sqlc.arg('status'), updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: UpdateTapeCopyCondition :one
+UPDATE tape_copies
+SET condition = sqlc.arg('condition'), updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: ReleaseRentedTapeCopies :exec
+UPDATE tape_copies
+SET status = 'available', updated_at = NOW()
+WHERE status = 'rented';
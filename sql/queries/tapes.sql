@@ -1,35 +1,196 @@
 -- name: CreateTape :one
-INSERT INTO tapes (title, director, genre, quantity)
-VALUES (
-  $1,
-  $2,
-  $3,
-  $4
+-- The tape and its first copies are inserted in one statement
+WITH new_tape AS (
+  INSERT INTO tapes (title, director, genre)
+  VALUES (
+    $1,
+    $2,
+    $3
+  )
+  RETURNING *
+),
+new_copies AS (
+  INSERT INTO tape_copies (tape_id, barcode)
+  SELECT new_tape.id, 'VHS-' || new_tape.id || '-' || n
+  FROM new_tape, generate_series(1, sqlc.arg('quantity')::int) AS n
+  RETURNING id
 )
-RETURNING *;
+SELECT
+  new_tape.*,
+  (SELECT COUNT(*) FROM new_copies)::int AS quantity
+FROM new_tape;
 
 -- name: GetTapes :many
-SELECT * FROM tapes
+-- quantity counts the copies in circulation, rented_out and on_hold the ones RentTape cannot hand out
+SELECT
+  tapes.*,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 ORDER BY created_at ASC;
 
+-- name: ListTapes :many
+-- Keyset pagination, the cursor columns follow the sort order and public_id breaks ties
+SELECT
+  tapes.*,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
+WHERE (sqlc.narg('genre')::text IS NULL OR LOWER(genre) = LOWER(sqlc.narg('genre')::text))
+  AND (sqlc.narg('director')::text IS NULL OR LOWER(director) = LOWER(sqlc.narg('director')::text))
+  AND (
+    NOT sqlc.arg('available_only')::bool
+    OR (
+      SELECT COUNT(*) FROM tape_copies
+      WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'available'
+    ) > (
+      SELECT COUNT(*) FROM reservations
+      WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+    )
+  )
+  AND (
+    sqlc.narg('cursor_public_id')::uuid IS NULL
+    OR (sqlc.arg('sort')::text = 'created_at' AND (created_at, public_id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_public_id')::uuid))
+    OR (sqlc.arg('sort')::text = '-created_at' AND (created_at, public_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_public_id')::uuid))
+    OR (sqlc.arg('sort')::text = 'title' AND (title, public_id) > (sqlc.narg('cursor_title')::text, sqlc.narg('cursor_public_id')::uuid))
+    OR (sqlc.arg('sort')::text = '-title' AND (title, public_id) < (sqlc.narg('cursor_title')::text, sqlc.narg('cursor_public_id')::uuid))
+  )
+ORDER BY
+  CASE WHEN sqlc.arg('sort')::text = 'created_at' THEN created_at END ASC,
+  CASE WHEN sqlc.arg('sort')::text = '-created_at' THEN created_at END DESC,
+  CASE WHEN sqlc.arg('sort')::text = 'title' THEN title END ASC,
+  CASE WHEN sqlc.arg('sort')::text = '-title' THEN title END DESC,
+  CASE WHEN sqlc.arg('sort')::text LIKE '-%' THEN public_id END DESC,
+  public_id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: CountTapes :one
+SELECT COUNT(*) FROM tapes
+WHERE (sqlc.narg('genre')::text IS NULL OR LOWER(genre) = LOWER(sqlc.narg('genre')::text))
+  AND (sqlc.narg('director')::text IS NULL OR LOWER(director) = LOWER(sqlc.narg('director')::text))
+  AND (
+    NOT sqlc.arg('available_only')::bool
+    OR (
+      SELECT COUNT(*) FROM tape_copies
+      WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'available'
+    ) > (
+      SELECT COUNT(*) FROM reservations
+      WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+    )
+  );
+
+-- name: SearchTapes :many
+-- Ranked full text search, title matches weigh more than director and genre ones
+SELECT
+  tapes.*,
+  ts_rank(tapes.search_vector, to_tsquery('simple', sqlc.arg('query')::text))::real AS rank,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
+WHERE tapes.search_vector @@ to_tsquery('simple', sqlc.arg('query')::text)
+ORDER BY rank DESC, tapes.title ASC
+LIMIT sqlc.arg('page_limit');
+
 -- name: GetTapeByID :one
-SELECT * FROM tapes
+SELECT
+  tapes.*,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 WHERE id = $1;
 
--- name: GetTapeFromPublicID :one
+-- name: GetTapeByIDForUpdate :one
+-- Row lock held until the surrounding transaction ends
 SELECT * FROM tapes
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetTapeFromPublicID :one
+SELECT
+  tapes.*,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold
+FROM tapes
 WHERE public_id = $1;
 
+-- name: GetTapeFromPublicIDForUpdate :one
+-- Row lock held until the surrounding transaction ends
+SELECT * FROM tapes
+WHERE public_id = $1
+FOR UPDATE;
+
 -- name: UpdateTape :one
 UPDATE tapes
 SET
   updated_at =  NOW(),
   title =       COALESCE(sqlc.narg('title'), title),
   director =    COALESCE(sqlc.narg('director'), director),
-  genre =       COALESCE(sqlc.narg('genre'), genre),
-  quantity =    COALESCE(sqlc.narg('quantity'), quantity)
+  genre =       COALESCE(sqlc.narg('genre'), genre)
 WHERE id = $1
-RETURNING *;
+RETURNING
+  tapes.*,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+  )::int AS quantity,
+  (
+    SELECT COUNT(*) FROM tape_copies
+    WHERE tape_copies.tape_id = tapes.id AND tape_copies.status = 'rented'
+  )::int AS rented_out,
+  (
+    SELECT COUNT(*) FROM reservations
+    WHERE reservations.tape_id = tapes.id AND reservations.status = 'held'
+  )::int AS on_hold;
 
 -- name: DeleteTape :exec
 DELETE FROM tapes
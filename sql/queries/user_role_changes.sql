@@ -0,0 +1,8 @@
+-- name: CreateUserRoleChange :exec
+INSERT INTO user_role_changes(user_id, changed_by, old_role, new_role)
+VALUES (
+  $1,
+  $2,
+  $3,
+  $4
+);
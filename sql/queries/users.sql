@@ -1,12 +1,17 @@
 -- name: CreateUser :one
-INSERT INTO users(username, email, hashed_password)
+INSERT INTO users(username, email, role, hashed_password)
 VALUES (
   $1,
   $2,
-  $3
+  $3,
+  $4
 )
 RETURNING *;
 
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1;
+
 -- name: GetUserByID :one
 SELECT * FROM users
 WHERE id = $1;
@@ -15,17 +20,54 @@ WHERE id = $1;
 SELECT * FROM users
 WHERE public_id = $1;
 
+-- name: GetUserByPublicIDForUpdate :one
+-- Row lock held until the surrounding transaction ends
+SELECT * FROM users
+WHERE public_id = $1
+FOR UPDATE;
+
 -- name: GetUserByUsername :one
 SELECT * FROM users
 WHERE username = $1;
 
+-- name: GetUserStatus :one
+-- Checked on every authenticated request
+SELECT role, disabled_at FROM users
+WHERE public_id = $1;
+
 -- name: GetUsers :many
 SELECT * FROM users
 ORDER BY created_at ASC;
 
--- name: DeleteAllUsers :exec
-DELETE FROM users;
+-- name: UpdateUser :one
+UPDATE users
+SET
+  updated_at = NOW(),
+  email =      COALESCE(sqlc.narg('email'), email)
+WHERE id = $1
+RETURNING *;
 
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
 
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
 
+-- name: DisableUser :one
+-- Disabling twice keeps the first timestamp
+UPDATE users
+SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
 
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
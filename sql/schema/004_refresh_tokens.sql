@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE refresh_tokens(
+  id          INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+  token_id    UUID UNIQUE NOT NULL,
+  family_id   UUID NOT NULL,
+  user_id     INT NOT NULL,
+  created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at  TIMESTAMP NOT NULL,
+  revoked_at  TIMESTAMP,
+  CONSTRAINT fk_refresh_tokens_user
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- 'simple' keeps names and titles unstemmed, which suits prefix (typeahead) matching
+ALTER TABLE tapes
+ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+  setweight(to_tsvector('simple', title), 'A') ||
+  setweight(to_tsvector('simple', director), 'B') ||
+  setweight(to_tsvector('simple', genre), 'C')
+) STORED;
+
+CREATE INDEX idx_tapes_search_vector ON tapes USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX idx_tapes_search_vector;
+ALTER TABLE tapes DROP COLUMN search_vector;
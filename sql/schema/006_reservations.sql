@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE reservations(
+  id               INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+  public_id        UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
+  created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+  user_id          INT NOT NULL,
+  tape_id          INT NOT NULL,
+  status           TEXT NOT NULL DEFAULT 'waiting'
+                   CHECK (status IN ('waiting', 'held', 'fulfilled', 'cancelled', 'expired')),
+  hold_expires_at  TIMESTAMP,
+  CONSTRAINT fk_reservations_user
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_reservations_tape
+  FOREIGN KEY (tape_id) REFERENCES tapes(id) ON DELETE CASCADE
+);
+
+-- A member can only queue once per tape at a time
+CREATE UNIQUE INDEX idx_reservations_open_user_tape ON reservations(user_id, tape_id)
+WHERE status IN ('waiting', 'held');
+
+CREATE INDEX idx_reservations_tape_queue ON reservations(tape_id, created_at)
+WHERE status = 'waiting';
+
+-- +goose Down
+DROP TABLE reservations;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE rentals
+ADD COLUMN due_at TIMESTAMP,
+ADD COLUMN late_fee_cents INT NOT NULL DEFAULT 0,
+ADD COLUMN fee_paid_at TIMESTAMP;
+
+-- Rentals made before due dates existed get the default 7 day period
+UPDATE rentals SET due_at = rented_at + INTERVAL '7 days';
+
+ALTER TABLE rentals ALTER COLUMN due_at SET NOT NULL;
+
+CREATE INDEX idx_rentals_active_due_at ON rentals(due_at)
+WHERE returned_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_rentals_active_due_at;
+ALTER TABLE rentals
+DROP COLUMN fee_paid_at,
+DROP COLUMN late_fee_cents,
+DROP COLUMN due_at;
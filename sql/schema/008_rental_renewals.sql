@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE rentals
+ADD COLUMN renewals INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE rentals
+DROP COLUMN renewals;
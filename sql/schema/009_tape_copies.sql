@@ -0,0 +1,71 @@
+-- +goose Up
+CREATE TABLE tape_copies (
+  id           INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+  public_id    UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
+  created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+  updated_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+  tape_id      INT NOT NULL,
+  barcode      TEXT NOT NULL UNIQUE,
+  condition    TEXT NOT NULL DEFAULT 'good'
+               CHECK (condition IN ('new', 'good', 'worn', 'damaged')),
+  status       TEXT NOT NULL DEFAULT 'available'
+               CHECK (status IN ('available', 'rented', 'retired')),
+  acquired_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+  CONSTRAINT fk_tape_copies_tape
+  FOREIGN KEY (tape_id) REFERENCES tapes(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_tape_copies_tape_status ON tape_copies(tape_id, status);
+
+-- One copy per unit of the old quantity counter
+INSERT INTO tape_copies (tape_id, barcode, acquired_at)
+SELECT tapes.id, 'VHS-' || tapes.id || '-' || n, tapes.created_at
+FROM tapes, generate_series(1, tapes.quantity) AS n;
+
+ALTER TABLE rentals
+ADD COLUMN copy_id INT,
+ADD CONSTRAINT fk_rentals_copy
+FOREIGN KEY (copy_id) REFERENCES tape_copies(id);
+
+-- Active rentals get a copy of their tape each, returned ones keep copy_id NULL
+WITH numbered_rentals AS (
+  SELECT id, tape_id, ROW_NUMBER() OVER (PARTITION BY tape_id ORDER BY id) AS n
+  FROM rentals
+  WHERE returned_at IS NULL
+),
+numbered_copies AS (
+  SELECT id, tape_id, ROW_NUMBER() OVER (PARTITION BY tape_id ORDER BY id) AS n
+  FROM tape_copies
+)
+UPDATE rentals
+SET copy_id = numbered_copies.id
+FROM numbered_rentals
+JOIN numbered_copies
+  ON numbered_rentals.tape_id = numbered_copies.tape_id AND numbered_rentals.n = numbered_copies.n
+WHERE rentals.id = numbered_rentals.id;
+
+UPDATE tape_copies
+SET status = 'rented'
+WHERE id IN (SELECT copy_id FROM rentals WHERE returned_at IS NULL);
+
+ALTER TABLE tapes
+DROP COLUMN quantity;
+
+-- +goose Down
+ALTER TABLE tapes
+ADD COLUMN quantity INT NOT NULL DEFAULT 0;
+
+UPDATE tapes
+SET quantity = (
+  SELECT COUNT(*) FROM tape_copies
+  WHERE tape_copies.tape_id = tapes.id AND tape_copies.status <> 'retired'
+);
+
+ALTER TABLE tapes
+ALTER COLUMN quantity DROP DEFAULT;
+
+ALTER TABLE rentals
+DROP CONSTRAINT fk_rentals_copy,
+DROP COLUMN copy_id;
+
+DROP TABLE tape_copies;
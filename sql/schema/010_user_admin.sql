@@ -0,0 +1,40 @@
+-- +goose Up
+-- Disabled accounts keep their data but can't log in or use their tokens
+ALTER TABLE users
+ADD COLUMN disabled_at TIMESTAMP;
+
+-- The rental history outlives a deleted account, its rentals just lose the renter.
+-- Accounts with tapes out or unpaid fees can't be deleted.
+ALTER TABLE rentals
+ALTER COLUMN user_id DROP NOT NULL,
+DROP CONSTRAINT fk_rentals_user,
+ADD CONSTRAINT fk_rentals_user
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Audit trail of promotions and demotions. Public IDs without foreign keys, so the
+-- trail outlives the accounts it mentions.
+CREATE TABLE user_role_changes(
+  id          INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+  created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+  user_id     UUID NOT NULL,
+  changed_by  UUID NOT NULL,
+  old_role    TEXT NOT NULL,
+  new_role    TEXT NOT NULL
+);
+
+CREATE INDEX idx_user_role_changes_user_id ON user_role_changes(user_id);
+
+-- +goose Down
+DROP TABLE user_role_changes;
+
+-- Rentals of deleted accounts have no renter to restore
+DELETE FROM rentals WHERE user_id IS NULL;
+
+ALTER TABLE rentals
+ALTER COLUMN user_id SET NOT NULL,
+DROP CONSTRAINT fk_rentals_user,
+ADD CONSTRAINT fk_rentals_user
+FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE users
+DROP COLUMN disabled_at;
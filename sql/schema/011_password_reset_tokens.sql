@@ -0,0 +1,17 @@
+-- +goose Up
+-- Only a SHA-256 hash of the emailed token is kept, a leaked table can't be used to reset passwords
+CREATE TABLE password_reset_tokens(
+  id          INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+  token_hash  TEXT UNIQUE NOT NULL,
+  user_id     INT NOT NULL,
+  created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+  expires_at  TIMESTAMP NOT NULL,
+  used_at     TIMESTAMP,
+  CONSTRAINT fk_password_reset_tokens_user
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
@@ -1,17 +1,5 @@
-CREATE DATABASE vhs_club;
-
-\c vhs_club
-
-CREATE TABLE users (
-  id               INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
-  public_id        UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
-  created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at       TIMESTAMP NOT NULL DEFAULT NOW(),
-  username         TEXT  NOT NULL UNIQUE,
-  email            TEXT  NOT NULL UNIQUE,
-  role             TEXT NOT NULL DEFAULT 'user',
-  hashed_password  TEXT NOT NULL
-);
+-- Sample data for a migrated database, see `migrate up`.
+-- Rows that already exist are skipped so the script can be run again safely.
 
 INSERT INTO users (username, email, role, hashed_password) VALUES
   (
@@ -25,42 +13,30 @@ INSERT INTO users (username, email, role, hashed_password) VALUES
   (
     'MilesDavis', 'grumpy.genius@cool.com', DEFAULT,
     '$argon2id$v=19$m=65536,t=1,p=24$SeQs/E+zWqjrpkfLKWCWNQ$fELoZMYpNKXuociqF/RL38OxTh5Zxc97DU0CdY0j3hc'
-  );
-
-
-CREATE TABLE tapes (
-  id          INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
-  public_id   UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
-  created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at  TIMESTAMP NOT NULL DEFAULT NOW(),
-  title       TEXT NOT NULL UNIQUE,
-  director    TEXT NOT NULL,
-  genre       TEXT NOT NULL,
-  quantity    INT NOT NULL
-);
-
-INSERT INTO tapes (title, director, genre, quantity) VALUES
-  ('Amarcord', 'Federico Fellini', 'Drama', 1),
-  ('Taxi Driver', 'Martin Scorsese', 'Thriller', 2),
-  ('Back to the Future', 'Robert Zemeckis', 'Adventure', 5),
-  ('Alien', 'Ridley Scott', 'Horror', 10),
-  ('A torinói ló', 'Béla Tarr', 'Drama', 3),
-  ('Batman', 'Tim Burton', 'Action', 4),
-  ('Fitzcarraldo', 'Werner Herzog', 'Drama', 11);
-
-CREATE TABLE rentals (
-  id            INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
-  public_id     UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
-  created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
-  user_id       INT NOT NULL,
-  tape_id       INT NOT NULL,
-  rented_at     TIMESTAMP NOT NULL DEFAULT NOW(),
-  returned_at   TIMESTAMP,
-  CONSTRAINT fk_rentals_user
-  FOREIGN KEY (user_id) REFERENCES users(id),
-  CONSTRAINT fk_rentals_tape
-  FOREIGN KEY (tape_id) REFERENCES tapes(id)
-);
-
-
-
+  )
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tapes (title, director, genre) VALUES
+  ('Amarcord', 'Federico Fellini', 'Drama'),
+  ('Taxi Driver', 'Martin Scorsese', 'Thriller'),
+  ('Back to the Future', 'Robert Zemeckis', 'Adventure'),
+  ('Alien', 'Ridley Scott', 'Horror'),
+  ('A torinói ló', 'Béla Tarr', 'Drama'),
+  ('Batman', 'Tim Burton', 'Action'),
+  ('Fitzcarraldo', 'Werner Herzog', 'Drama')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO tape_copies (tape_id, barcode)
+SELECT tapes.id, 'VHS-' || tapes.id || '-' || n
+FROM tapes
+JOIN (VALUES
+  ('Amarcord', 1),
+  ('Taxi Driver', 2),
+  ('Back to the Future', 5),
+  ('Alien', 10),
+  ('A torinói ló', 3),
+  ('Batman', 4),
+  ('Fitzcarraldo', 11)
+) AS stock(title, copies) ON tapes.title = stock.title,
+generate_series(1, stock.copies) AS n
+ON CONFLICT DO NOTHING;